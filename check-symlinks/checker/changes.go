@@ -0,0 +1,177 @@
+package checker
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChangeSet is the set of paths touched by a change. Paths are absolute.
+type ChangeSet struct {
+	// Changed are paths added, modified, copied or renamed to
+	Changed []string
+	// Removed are paths deleted or renamed from
+	Removed []string
+}
+
+// StagedChanges returns the paths changed in the index relative to HEAD
+func StagedChanges(topLevel string) (ChangeSet, error) {
+	return gitDiff(topLevel, "--cached")
+}
+
+// ChangesSince returns the paths changed in the working tree since the point
+// the current branch diverged from ref
+func ChangesSince(topLevel, ref string) (ChangeSet, error) {
+	return gitDiff(topLevel, "--merge-base", ref)
+}
+
+func gitDiff(topLevel string, args ...string) (ChangeSet, error) {
+	cmdArgs := append([]string{"-C", topLevel, "diff", "--name-status", "-z", "-M", "--no-ext-diff"}, args...)
+	cmd := exec.Command("git", cmdArgs...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("git diff: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseNameStatus(topLevel, output)
+}
+
+// parseNameStatus parses the output of 'git diff --name-status -z'
+func parseNameStatus(topLevel string, output []byte) (ChangeSet, error) {
+	var changes ChangeSet
+	fields := strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00")
+	if len(fields) == 1 && fields[0] == "" {
+		return changes, nil
+	}
+	abs := func(path string) string { return filepath.Join(topLevel, filepath.FromSlash(path)) }
+
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" {
+			return changes, fmt.Errorf("unexpected empty status in git diff output")
+		}
+		switch status[0] {
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return changes, fmt.Errorf("truncated git diff output after %q", status)
+			}
+			if status[0] == 'R' {
+				changes.Removed = append(changes.Removed, abs(fields[i+1]))
+			}
+			changes.Changed = append(changes.Changed, abs(fields[i+2]))
+			i += 2
+		case 'D':
+			if i+1 >= len(fields) {
+				return changes, fmt.Errorf("truncated git diff output after %q", status)
+			}
+			changes.Removed = append(changes.Removed, abs(fields[i+1]))
+			i++
+		default:
+			if i+1 >= len(fields) {
+				return changes, fmt.Errorf("truncated git diff output after %q", status)
+			}
+			changes.Changed = append(changes.Changed, abs(fields[i+1]))
+			i++
+		}
+	}
+	return changes, nil
+}
+
+// ListedChanges treats files named on the command line as the change. Files
+// that no longer exist are considered removed.
+func ListedChanges(files []string) ChangeSet {
+	var changes ChangeSet
+	for _, file := range files {
+		absPath, err := filepath.Abs(file)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Lstat(absPath); err != nil {
+			changes.Removed = append(changes.Removed, absPath)
+		} else {
+			changes.Changed = append(changes.Changed, absPath)
+		}
+	}
+	return changes
+}
+
+// indexedSymlinks returns the absolute paths of the symlinks tracked in the
+// repository at topLevel
+func indexedSymlinks(topLevel string) ([]string, error) {
+	output, err := exec.Command("git", "-C", topLevel, "ls-files", "--stage", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %v", err)
+	}
+	var links []string
+	for _, entry := range strings.Split(string(output), "\x00") {
+		// Entries look like "<mode> <object> <stage>\t<path>"
+		meta, path, ok := strings.Cut(entry, "\t")
+		if !ok || !strings.HasPrefix(meta, "120000 ") {
+			continue
+		}
+		links = append(links, filepath.Join(topLevel, filepath.FromSlash(path)))
+	}
+	return links, nil
+}
+
+// dependentLinks returns the links whose target is, contains or is inside a
+// removed path. Those may have been broken by the change even though the
+// links themselves weren't touched.
+func dependentLinks(links, removed []string) []string {
+	var dependents []string
+	for _, link := range links {
+		target, err := os.Readlink(link)
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(link), target)
+		}
+		target = filepath.Clean(target)
+		for _, path := range removed {
+			if IsWithin(path, target) || IsWithin(target, path) {
+				dependents = append(dependents, link)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+// LinksToCheck returns the paths to check for a change: the changed paths and
+// the tracked links that depend on removed ones. Paths are made relative to
+// the working directory when possible, to match the output of a full scan.
+func (c ChangeSet) LinksToCheck(topLevel string) ([]string, error) {
+	paths := append([]string(nil), c.Changed...)
+	if len(c.Removed) > 0 && topLevel != "" {
+		links, err := indexedSymlinks(topLevel)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, dependentLinks(links, c.Removed)...)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var result []string
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if rel, err := filepath.Rel(cwd, path); err == nil && IsWithin(cwd, path) {
+			path = rel
+		}
+		result = append(result, path)
+	}
+	sort.Strings(result)
+	return result, nil
+}
@@ -0,0 +1,123 @@
+package checker
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, output)
+	}
+}
+
+func TestParseNameStatus(t *testing.T) {
+	output := []byte("A\x00added\x00M\x00dir/modified\x00D\x00deleted\x00R087\x00old\x00new\x00C100\x00source\x00copy\x00T\x00typechange\x00")
+	changes, err := parseNameStatus("/repo", output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChanged := []string{"/repo/added", "/repo/dir/modified", "/repo/new", "/repo/copy", "/repo/typechange"}
+	if !reflect.DeepEqual(changes.Changed, wantChanged) {
+		t.Errorf("changed = %v, want %v", changes.Changed, wantChanged)
+	}
+	wantRemoved := []string{"/repo/deleted", "/repo/old"}
+	if !reflect.DeepEqual(changes.Removed, wantRemoved) {
+		t.Errorf("removed = %v, want %v", changes.Removed, wantRemoved)
+	}
+
+	if changes, err := parseNameStatus("/repo", nil); err != nil || changes.Changed != nil || changes.Removed != nil {
+		t.Errorf("expected no changes for empty output, got %+v, %v", changes, err)
+	}
+	if _, err := parseNameStatus("/repo", []byte("R100\x00old\x00")); err == nil {
+		t.Error("expected an error for truncated output")
+	}
+}
+
+func TestStagedChanges(t *testing.T) {
+	root := t.TempDir()
+	t.Chdir(root)
+	git(t, root, "init", "--quiet")
+	writeFiles(t, root, map[string]string{
+		"docs/guide.md": "",
+		"renamed.md":    "",
+		"unrelated.md":  "",
+	})
+	must(os.Symlink("docs/guide.md", filepath.Join(root, "to_deleted")))
+	must(os.Symlink("docs", filepath.Join(root, "to_dir")))
+	must(os.Symlink("renamed.md", filepath.Join(root, "to_renamed")))
+	must(os.Symlink("unrelated.md", filepath.Join(root, "untouched")))
+	git(t, root, "add", ".")
+	git(t, root, "commit", "--quiet", "-m", "initial")
+
+	git(t, root, "rm", "--quiet", "docs/guide.md")
+	git(t, root, "mv", "renamed.md", "moved.md")
+	must(os.Symlink("moved.md", filepath.Join(root, "new_link")))
+	git(t, root, "add", "new_link")
+
+	changes, err := StagedChanges(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := changes.LinksToCheck(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"moved.md", "new_link", "to_deleted", "to_dir", "to_renamed"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("linksToCheck() = %v, want %v", got, want)
+	}
+}
+
+func TestChangesSince(t *testing.T) {
+	root := t.TempDir()
+	t.Chdir(root)
+	git(t, root, "init", "--quiet", "--initial-branch", "main")
+	writeFiles(t, root, map[string]string{"file": ""})
+	git(t, root, "add", ".")
+	git(t, root, "commit", "--quiet", "-m", "initial")
+	git(t, root, "checkout", "--quiet", "-b", "feature")
+	must(os.Symlink("missing", filepath.Join(root, "broken")))
+	git(t, root, "add", ".")
+	git(t, root, "commit", "--quiet", "-m", "add link")
+
+	changes, err := ChangesSince(root, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := changes.LinksToCheck(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"broken"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("linksToCheck() = %v, want %v", got, want)
+	}
+
+	if _, err := ChangesSince(root, "no-such-ref"); err == nil {
+		t.Error("expected an error for an unknown ref")
+	}
+}
+
+func TestListedChanges(t *testing.T) {
+	root := t.TempDir()
+	t.Chdir(root)
+	writeFiles(t, root, map[string]string{"file": ""})
+
+	changes := ListedChanges([]string{"file", "gone"})
+	if want := []string{filepath.Join(root, "file")}; !reflect.DeepEqual(changes.Changed, want) {
+		t.Errorf("changed = %v, want %v", changes.Changed, want)
+	}
+	if want := []string{filepath.Join(root, "gone")}; !reflect.DeepEqual(changes.Removed, want) {
+		t.Errorf("removed = %v, want %v", changes.Removed, want)
+	}
+}
@@ -0,0 +1,230 @@
+// Package checker finds problems with symbolic links, such as links whose
+// target is missing or that escape the repository they live in.
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/charlievieth/fastwalk"
+	log "github.com/sirupsen/logrus"
+)
+
+// Options configures a Checker
+type Options struct {
+	// Categories are the problems to check for. Defaults to DefaultCategories.
+	Categories []Category
+	// TopLevel is the repository root. The escape and ignored checks are
+	// skipped without one.
+	TopLevel string
+	// IncludeHidden walks into hidden files and directories
+	IncludeHidden bool
+	// Ignore skips the paths it matches while walking. Nil skips nothing.
+	Ignore Matcher
+	// Concurrency is the number of paths checked at once. Defaults to one
+	// less than the number of CPUs.
+	Concurrency int
+}
+
+// Checker walks paths and checks the symlinks it finds. A Checker runs one
+// check at a time.
+type Checker struct {
+	Options
+
+	filesChecked atomic.Int64
+	mu           sync.Mutex
+	err          error
+}
+
+// New returns a Checker with the given options
+func New(opts Options) *Checker {
+	return &Checker{Options: opts}
+}
+
+// Check walks paths and sends every problem found. Paths that aren't
+// directories are checked directly. The channel is closed when the walk is
+// done or ctx is cancelled, after which Err reports what went wrong.
+func (c *Checker) Check(ctx context.Context, paths []string) <-chan Finding {
+	findings := make(chan Finding, 100)
+	results := c.Results(ctx, paths)
+	go func() {
+		defer close(findings)
+		for result := range results {
+			for _, f := range result.Findings {
+				select {
+				case findings <- f:
+				case <-ctx.Done():
+					// Drain so the workers can exit
+					for range results {
+					}
+					return
+				}
+			}
+		}
+	}()
+	return findings
+}
+
+// Results is like Check but sends a result for every symlink checked,
+// including those without problems
+func (c *Checker) Results(ctx context.Context, paths []string) <-chan Result {
+	return c.run(ctx, paths, true)
+}
+
+// FileResults checks exactly the given files, such as those touched by a
+// change, without walking directories. Hidden and ignored files are skipped
+// like they are while walking.
+func (c *Checker) FileResults(ctx context.Context, files []string) <-chan Result {
+	return c.run(ctx, files, false)
+}
+
+func (c *Checker) run(ctx context.Context, paths []string, walk bool) <-chan Result {
+	c.filesChecked.Store(0)
+	c.setErr(nil)
+
+	categories := c.Categories
+	if categories == nil {
+		categories = DefaultCategories
+	}
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = max(runtime.NumCPU()-1, 1)
+	}
+
+	var wg sync.WaitGroup
+	candidates := make(chan string, 100)
+	results := make(chan Result, 100)
+
+	// Worker pool
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range candidates {
+				c.filesChecked.Add(1)
+				fi, err := os.Lstat(path)
+				if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+					continue
+				}
+				target, _ := os.Readlink(path)
+				result := Result{Path: path, Target: target, Findings: checkLink(path, c.TopLevel, categories)}
+				select {
+				case results <- result:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	// Process each path
+	go func() {
+		defer close(candidates)
+		var errs []error
+		for _, rootPath := range paths {
+			if ctx.Err() != nil {
+				break
+			}
+			if !walk && c.skipFile(rootPath) {
+				log.Debug("Skipping: ", rootPath)
+				continue
+			}
+			if info, err := os.Stat(rootPath); !walk || err != nil || !info.IsDir() {
+				select {
+				case candidates <- rootPath:
+				case <-ctx.Done():
+				}
+				continue
+			}
+			err := fastwalk.Walk(nil, rootPath, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if c.skip(path, d.IsDir()) {
+					log.Debug("Skipping: ", path)
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				select {
+				case candidates <- path:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			if err != nil && ctx.Err() == nil {
+				errs = append(errs, fmt.Errorf("walking directory %s: %w", rootPath, err))
+			}
+		}
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+		}
+		c.setErr(errors.Join(errs...))
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// skip reports whether a path found while walking is left out, either
+// because it's hidden or because it's ignored
+func (c *Checker) skip(path string, isDir bool) bool {
+	if !c.IncludeHidden && IsHidden(path) {
+		return true
+	}
+	return c.Ignore != nil && c.Ignore.Match(path, isDir)
+}
+
+// skipFile is like skip for a path given directly, whose parent directories
+// were never walked
+func (c *Checker) skipFile(path string) bool {
+	if !c.IncludeHidden && hasHiddenComponent(path) {
+		return true
+	}
+	return c.Ignore != nil && c.Ignore.Match(path, false)
+}
+
+// FilesChecked returns the number of paths looked at by the last check,
+// symlinks or not
+func (c *Checker) FilesChecked() int64 {
+	return c.filesChecked.Load()
+}
+
+// Err returns the errors that stopped part of the last check from running,
+// once its channel has been closed
+func (c *Checker) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Checker) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// IsHidden checks if a file or directory is hidden (starts with '.')
+// It checks only the base name, not the full path
+func IsHidden(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasPrefix(base, ".") && base != "." && base != ".."
+}
+
+// hasHiddenComponent checks if any element of a relative path is hidden
+func hasHiddenComponent(path string) bool {
+	return slices.ContainsFunc(strings.Split(filepath.ToSlash(path), "/"), IsHidden)
+}
@@ -0,0 +1,139 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// prefixMatcher ignores every path containing a prefix
+type prefixMatcher string
+
+func (m prefixMatcher) Match(path string, isDir bool) bool {
+	return strings.HasPrefix(filepath.Base(path), string(m))
+}
+
+func setUpTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"file":             "",
+		"sub/file":         "",
+		"skip_dir/file":    "",
+		".hidden_dir/file": "",
+	})
+	links := map[string]string{
+		"valid":                "file",
+		"broken":               "missing",
+		"sub/broken":           "missing",
+		"sub/loop":             "loop",
+		"skip_dir/broken":      "missing",
+		"skip_broken":          "missing",
+		".hidden_dir/broken":   "missing",
+		"sub/valid_to_sub_dir": "..",
+	}
+	for name, target := range links {
+		must(os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))))
+	}
+	return root
+}
+
+func collect(findings <-chan Finding) []string {
+	var paths []string
+	for f := range findings {
+		paths = append(paths, string(f.Category)+" "+f.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestCheck(t *testing.T) {
+	root := setUpTree(t)
+	c := New(Options{Ignore: prefixMatcher("skip_"), Concurrency: 2})
+
+	got := collect(c.Check(context.Background(), []string{root}))
+	want := []string{
+		"broken " + filepath.Join(root, "broken"),
+		"broken " + filepath.Join(root, "sub", "broken"),
+		"loop " + filepath.Join(root, "sub", "loop"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %v, want %v", got, want)
+	}
+	if err := c.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+	if c.FilesChecked() == 0 {
+		t.Error("expected files to be counted")
+	}
+}
+
+func TestCheckOptions(t *testing.T) {
+	root := setUpTree(t)
+	c := New(Options{Categories: []Category{Loop}, IncludeHidden: true, Concurrency: 1})
+
+	got := collect(c.Check(context.Background(), []string{filepath.Join(root, "sub")}))
+	if want := []string{"loop " + filepath.Join(root, "sub", "loop")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %v, want %v", got, want)
+	}
+
+	c = New(Options{IncludeHidden: true})
+	got = collect(c.Check(context.Background(), []string{filepath.Join(root, ".hidden_dir")}))
+	if want := []string{"broken " + filepath.Join(root, ".hidden_dir", "broken")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() with hidden files = %v, want %v", got, want)
+	}
+}
+
+func TestResults(t *testing.T) {
+	root := setUpTree(t)
+	c := New(Options{})
+
+	var links []string
+	for result := range c.Results(context.Background(), []string{filepath.Join(root, "valid"), filepath.Join(root, "file")}) {
+		links = append(links, result.Path)
+		if len(result.Findings) != 0 {
+			t.Errorf("unexpected findings %v", result.Findings)
+		}
+	}
+	if want := []string{filepath.Join(root, "valid")}; !reflect.DeepEqual(links, want) {
+		t.Errorf("Results() = %v, want %v", links, want)
+	}
+	if c.FilesChecked() != 2 {
+		t.Errorf("FilesChecked() = %d, want 2", c.FilesChecked())
+	}
+}
+
+func TestFileResults(t *testing.T) {
+	root := setUpTree(t)
+	t.Chdir(root)
+	c := New(Options{Ignore: prefixMatcher("skip_")})
+
+	var links []string
+	files := []string{"sub/valid_to_sub_dir", "skip_broken", ".hidden_dir/broken", "broken"}
+	for result := range c.FileResults(context.Background(), files) {
+		links = append(links, result.Path)
+	}
+	sort.Strings(links)
+	// Links to directories are checked rather than walked into
+	if want := []string{"broken", "sub/valid_to_sub_dir"}; !reflect.DeepEqual(links, want) {
+		t.Errorf("FileResults() = %v, want %v", links, want)
+	}
+}
+
+func TestCheckCancelled(t *testing.T) {
+	root := setUpTree(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := New(Options{})
+	for range c.Check(ctx, []string{root}) {
+	}
+	if err := c.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err() = %v, want %v", err, context.Canceled)
+	}
+}
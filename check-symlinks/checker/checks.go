@@ -0,0 +1,170 @@
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// Category is the kind of problem found with a symlink
+type Category string
+
+const (
+	// Broken is a link whose target does not exist
+	Broken Category = "broken"
+	// Loop is a link that resolves back to itself (ELOOP)
+	Loop Category = "loop"
+	// Escape is a link whose target is outside the repository root
+	Escape Category = "escape"
+	// Absolute is a link with an absolute target, which won't survive
+	// a checkout at another location
+	Absolute Category = "absolute"
+	// Ignored is a link whose target is ignored by git
+	Ignored Category = "ignored"
+	// Permission is a link whose target can't be accessed
+	Permission Category = "permission"
+)
+
+var AllCategories = []Category{
+	Broken,
+	Loop,
+	Escape,
+	Absolute,
+	Ignored,
+	Permission,
+}
+
+// DefaultCategories are the problems checked for unless others are selected
+var DefaultCategories = []Category{Broken, Loop}
+
+// Description is the human-readable label used in text output
+func (c Category) Description() string {
+	switch c {
+	case Broken:
+		return "Broken symlink"
+	case Loop:
+		return "Symlink loop"
+	case Escape:
+		return "Symlink escapes repository"
+	case Absolute:
+		return "Absolute symlink"
+	case Ignored:
+		return "Symlink to ignored file"
+	case Permission:
+		return "Symlink target permission denied"
+	default:
+		return string(c)
+	}
+}
+
+// ParseCategories validates the names of checks, as passed to --checks.
+// "all" selects every category.
+func ParseCategories(names []string) ([]Category, error) {
+	var categories []Category
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			return AllCategories, nil
+		}
+		c := Category(name)
+		if !slices.Contains(AllCategories, c) {
+			return nil, fmt.Errorf("unknown check %q", name)
+		}
+		if !slices.Contains(categories, c) {
+			categories = append(categories, c)
+		}
+	}
+	return categories, nil
+}
+
+// Finding is a problem found with a symlink
+type Finding struct {
+	Path     string
+	Target   string
+	Category Category
+}
+
+func (f Finding) String() string {
+	switch f.Category {
+	case Broken, Loop, Permission:
+		return fmt.Sprintf("%s: %s", f.Category.Description(), f.Path)
+	default:
+		return fmt.Sprintf("%s: %s -> %s", f.Category.Description(), f.Path, f.Target)
+	}
+}
+
+// checkLink runs the enabled checks against path, which must be a symlink
+func checkLink(path, topLevel string, categories []Category) []Finding {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return nil
+	}
+	enabled := func(c Category) bool { return slices.Contains(categories, c) }
+
+	var findings []Finding
+	_, err = os.Stat(path)
+	switch {
+	case err == nil:
+	case errors.Is(err, syscall.ELOOP):
+		if enabled(Loop) {
+			findings = append(findings, Finding{Path: path, Target: target, Category: Loop})
+		}
+	case errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR):
+		if enabled(Broken) {
+			findings = append(findings, Finding{Path: path, Target: target, Category: Broken})
+		}
+	case errors.Is(err, fs.ErrPermission):
+		if enabled(Permission) {
+			findings = append(findings, Finding{Path: path, Target: target, Category: Permission})
+		}
+	}
+
+	if enabled(Absolute) && filepath.IsAbs(target) {
+		findings = append(findings, Finding{Path: path, Target: target, Category: Absolute})
+	}
+
+	if topLevel == "" {
+		return findings
+	}
+
+	resolved := target
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(filepath.Dir(path), resolved)
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return findings
+	}
+	escapes := !IsWithin(topLevel, resolved)
+
+	if enabled(Escape) && escapes {
+		findings = append(findings, Finding{Path: path, Target: target, Category: Escape})
+	}
+
+	if enabled(Ignored) && !escapes && isGitIgnored(topLevel, resolved) {
+		findings = append(findings, Finding{Path: path, Target: target, Category: Ignored})
+	}
+
+	return findings
+}
+
+// IsWithin reports whether path is root or is inside of it
+func IsWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isGitIgnored reports whether git ignores path in the repository at topLevel
+func isGitIgnored(topLevel, path string) bool {
+	cmd := exec.Command("git", "-C", topLevel, "check-ignore", "--quiet", path)
+	return cmd.Run() == nil
+}
@@ -0,0 +1,107 @@
+package checker
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCategories(t *testing.T) {
+	categories, err := ParseCategories([]string{"broken", " escape", "broken"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Category{Broken, Escape}; !reflect.DeepEqual(categories, want) {
+		t.Errorf("parseCategories() = %v, want %v", categories, want)
+	}
+
+	categories, err = ParseCategories([]string{"broken", "all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(categories, AllCategories) {
+		t.Errorf("parseCategories(all) = %v, want %v", categories, AllCategories)
+	}
+
+	if _, err := ParseCategories([]string{"bogus"}); err == nil {
+		t.Error("expected an error for an unknown check")
+	}
+}
+
+func TestCheckLink(t *testing.T) {
+	root := t.TempDir()
+	cmd := exec.Command("git", "init", "--quiet", root)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, output)
+	}
+	writeFiles(t, root, map[string]string{
+		".gitignore":      "ignored_file\n",
+		"ignored_file":    "",
+		"some_file":       "",
+		"locked/contents": "",
+	})
+	links := map[string]string{
+		"valid":        "some_file",
+		"broken":       "missing",
+		"not_dir":      "some_file/child",
+		"loop":         "loop",
+		"absolute":     filepath.Join(root, "some_file"),
+		"escape":       "../outside",
+		"ignored":      "ignored_file",
+		"locked_child": "locked/contents",
+	}
+	for name, target := range links {
+		must(os.Symlink(target, filepath.Join(root, name)))
+	}
+
+	tests := []struct {
+		link string
+		want []Category
+	}{
+		{"valid", nil},
+		{"broken", []Category{Broken}},
+		{"not_dir", []Category{Broken}},
+		{"loop", []Category{Loop}},
+		{"absolute", []Category{Absolute}},
+		{"escape", []Category{Broken, Escape}},
+		{"ignored", []Category{Ignored}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			path := filepath.Join(root, tt.link)
+			var got []Category
+			for _, f := range checkLink(path, root, AllCategories) {
+				if f.Path != path || f.Target != links[tt.link] {
+					t.Errorf("unexpected Finding %+v", f)
+				}
+				got = append(got, f.Category)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkLink(%s) = %v, want %v", tt.link, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		if findings := checkLink(filepath.Join(root, "absolute"), root, []Category{Broken}); len(findings) != 0 {
+			t.Errorf("expected no findings, got %v", findings)
+		}
+	})
+
+	t.Run("permission", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("permissions are not enforced for root")
+		}
+		locked := filepath.Join(root, "locked")
+		must(os.Chmod(locked, 0))
+		defer func() { must(os.Chmod(locked, 0o755)) }()
+
+		findings := checkLink(filepath.Join(root, "locked_child"), root, AllCategories)
+		if len(findings) != 1 || findings[0].Category != Permission {
+			t.Errorf("expected a permission Finding, got %v", findings)
+		}
+	})
+}
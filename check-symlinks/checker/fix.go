@@ -0,0 +1,167 @@
+package checker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/charlievieth/fastwalk"
+	log "github.com/sirupsen/logrus"
+)
+
+// FixAction is the kind of repair made to a symlink
+type FixAction string
+
+const (
+	// Relativize rewrites an absolute link inside the repository to a
+	// relative one
+	Relativize FixAction = "relativize"
+	// Repoint points a broken link at the only file with the same basename
+	Repoint FixAction = "repoint"
+	// Delete removes a broken link
+	Delete FixAction = "delete"
+)
+
+// Fix is a planned repair of a symlink
+type Fix struct {
+	Path      string
+	OldTarget string
+	NewTarget string
+	Action    FixAction
+}
+
+// Describe returns a human-readable summary of the fix, phrased as planned
+// or as done
+func (f Fix) Describe(planned bool) string {
+	verbs := map[FixAction][2]string{
+		Relativize: {"Would rewrite", "Rewrote"},
+		Repoint:    {"Would re-point", "Re-pointed"},
+		Delete:     {"Would delete", "Deleted"},
+	}
+	verb := verbs[f.Action][1]
+	if planned {
+		verb = verbs[f.Action][0]
+	}
+	if f.Action == Delete {
+		return fmt.Sprintf("%s %s (target %s does not exist)", verb, f.Path, f.OldTarget)
+	}
+	return fmt.Sprintf("%s %s -> %s (was %s)", verb, f.Path, f.NewTarget, f.OldTarget)
+}
+
+// Apply makes the planned change on disk. Rewritten links are replaced
+// atomically by renaming a new link over the old one.
+func (f Fix) Apply() error {
+	if f.Action == Delete {
+		return os.Remove(f.Path)
+	}
+	tmp := filepath.Join(filepath.Dir(f.Path), fmt.Sprintf(".%s.check-symlinks-tmp", filepath.Base(f.Path)))
+	if err := os.Symlink(f.NewTarget, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, f.Path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// BasenameIndex maps file basenames to every path in the tree with that name
+type BasenameIndex map[string][]string
+
+// BuildBasenameIndex walks roots and records every entry that is not a
+// symlink, skipping hidden and ignored paths like the check itself does
+func BuildBasenameIndex(roots []string, ignore Matcher, includeHidden bool) BasenameIndex {
+	index := make(BasenameIndex)
+	var mu sync.Mutex
+	for _, root := range roots {
+		err := fastwalk.Walk(nil, root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.Name() == ".git" || (!includeHidden && IsHidden(path)) || (ignore != nil && ignore.Match(path, d.IsDir())) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type()&os.ModeSymlink != 0 {
+				return nil
+			}
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return nil
+			}
+			mu.Lock()
+			index[d.Name()] = append(index[d.Name()], absPath)
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			log.Debugf("Error indexing %s: %v", root, err)
+		}
+	}
+	return index
+}
+
+// Unique returns the only path with the given basename, if there is exactly one
+func (index BasenameIndex) Unique(name string) (string, bool) {
+	paths := index[name]
+	if len(paths) != 1 {
+		return "", false
+	}
+	return paths[0], true
+}
+
+// PlanFixes decides how to repair each link with findings. Links that can't
+// be repaired are returned as unfixed findings.
+func PlanFixes(findings []Finding, topLevel string, index BasenameIndex) ([]Fix, []Finding) {
+	byPath := make(map[string][]Finding)
+	var paths []string
+	for _, f := range findings {
+		if _, ok := byPath[f.Path]; !ok {
+			paths = append(paths, f.Path)
+		}
+		byPath[f.Path] = append(byPath[f.Path], f)
+	}
+	sort.Strings(paths)
+
+	var fixes []Fix
+	var unfixed []Finding
+	for _, path := range paths {
+		linkFindings := byPath[path]
+		categories := make(map[Category]bool)
+		for _, f := range linkFindings {
+			categories[f.Category] = true
+		}
+		target := linkFindings[0].Target
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			unfixed = append(unfixed, linkFindings...)
+			continue
+		}
+
+		switch {
+		case categories[Broken]:
+			if candidate, ok := index.Unique(filepath.Base(target)); ok && candidate != absPath {
+				newTarget, err := filepath.Rel(filepath.Dir(absPath), candidate)
+				if err == nil {
+					fixes = append(fixes, Fix{Path: path, OldTarget: target, NewTarget: newTarget, Action: Repoint})
+					continue
+				}
+			}
+			fixes = append(fixes, Fix{Path: path, OldTarget: target, Action: Delete})
+		case categories[Absolute] && topLevel != "" && IsWithin(topLevel, target):
+			newTarget, err := filepath.Rel(filepath.Dir(absPath), target)
+			if err != nil {
+				unfixed = append(unfixed, linkFindings...)
+				continue
+			}
+			fixes = append(fixes, Fix{Path: path, OldTarget: target, NewTarget: newTarget, Action: Relativize})
+		default:
+			unfixed = append(unfixed, linkFindings...)
+		}
+	}
+	return fixes, unfixed
+}
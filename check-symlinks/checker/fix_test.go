@@ -0,0 +1,61 @@
+package checker
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlanFixes(t *testing.T) {
+	root := t.TempDir()
+	index := BasenameIndex{
+		"guide.md":  {filepath.Join(root, "docs", "guide.md")},
+		"common.md": {filepath.Join(root, "a", "common.md"), filepath.Join(root, "b", "common.md")},
+	}
+	findings := []Finding{
+		{Path: filepath.Join(root, "sub", "moved"), Target: "guide.md", Category: Broken},
+		{Path: filepath.Join(root, "ambiguous"), Target: "common.md", Category: Broken},
+		{Path: filepath.Join(root, "absolute"), Target: filepath.Join(root, "docs", "guide.md"), Category: Absolute},
+		{Path: filepath.Join(root, "outside"), Target: "/etc/hosts", Category: Absolute},
+		{Path: filepath.Join(root, "loop"), Target: "loop", Category: Loop},
+	}
+
+	fixes, unfixed := PlanFixes(findings, root, index)
+
+	wantFixes := []Fix{
+		{Path: filepath.Join(root, "absolute"), OldTarget: filepath.Join(root, "docs", "guide.md"), NewTarget: "docs/guide.md", Action: Relativize},
+		{Path: filepath.Join(root, "ambiguous"), OldTarget: "common.md", Action: Delete},
+		{Path: filepath.Join(root, "sub", "moved"), OldTarget: "guide.md", NewTarget: "../docs/guide.md", Action: Repoint},
+	}
+	if !reflect.DeepEqual(fixes, wantFixes) {
+		t.Errorf("planFixes() fixes = %+v, want %+v", fixes, wantFixes)
+	}
+	wantUnfixed := []Finding{findings[4], findings[3]}
+	if !reflect.DeepEqual(unfixed, wantUnfixed) {
+		t.Errorf("planFixes() unfixed = %+v, want %+v", unfixed, wantUnfixed)
+	}
+}
+
+func TestBuildBasenameIndex(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a/file":         "",
+		"b/file":         "",
+		"unique":         "",
+		".hidden/unique": "",
+	})
+	must(os.Symlink("unique", filepath.Join(root, "link")))
+
+	index := BuildBasenameIndex([]string{root}, nil, false)
+
+	if len(index["file"]) != 2 {
+		t.Errorf("expected two entries for file, got %v", index["file"])
+	}
+	if path, ok := index.Unique("unique"); !ok || path != filepath.Join(root, "unique") {
+		t.Errorf("expected unique to be found once, got %v", index["unique"])
+	}
+	if _, ok := index["link"]; ok {
+		t.Error("expected symlinks to be excluded from the index")
+	}
+}
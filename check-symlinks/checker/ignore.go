@@ -0,0 +1,269 @@
+package checker
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ignorePattern is a single compiled line of a gitignore-style file
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// match reports whether the pattern matches rel, a slash-separated path
+// relative to the directory containing the ignore file
+func (p ignorePattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return p.re.MatchString(rel)
+}
+
+// compileIgnorePattern converts a line of an ignore file into a pattern
+// following gitignore semantics. It returns false for blank lines and comments.
+func compileIgnorePattern(line string) (ignorePattern, bool) {
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	var p ignorePattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	// A separator at the beginning or middle anchors the pattern to the
+	// directory of the ignore file. Otherwise it matches at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	expr.WriteString(globToRegexp(line))
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		log.Debugf("Skipping invalid ignore pattern %q: %v", line, err)
+		return ignorePattern{}, false
+	}
+	p.re = re
+	return p, true
+}
+
+// globToRegexp translates a gitignore glob into a regular expression
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			// Leading "**/" or "/**/" matches zero or more directories
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case glob[i:] == "**" && (i == 0 || glob[i-1] == '/'):
+			// Trailing "/**" matches everything inside
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String()
+}
+
+// trimTrailingSpaces removes trailing spaces unless they are escaped
+func trimTrailingSpaces(line string) string {
+	line = strings.TrimRight(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// loadPatternsFromFile reads and compiles the patterns of an ignore file
+func loadPatternsFromFile(filename string) []ignorePattern {
+	var patterns []ignorePattern
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return patterns
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Error("Error closing file: ", err)
+		}
+	}()
+
+	log.Debug("Found ignore file: ", filename)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if p, ok := compileIgnorePattern(scanner.Text()); ok {
+			patterns = append(patterns, p)
+		}
+	}
+
+	return patterns
+}
+
+// Matcher decides whether a path found while walking is skipped
+type Matcher interface {
+	Match(path string, isDir bool) bool
+}
+
+// IgnoreMatcher decides whether paths under root are ignored. Ignore files
+// are loaded lazily from each directory and apply to everything beneath it,
+// with patterns in deeper directories taking precedence. It is safe for
+// concurrent use.
+type IgnoreMatcher struct {
+	root         string
+	gitDir       string
+	useGitignore bool
+
+	mu       sync.Mutex
+	patterns map[string][]ignorePattern
+	ignored  map[string]bool
+}
+
+// NewIgnoreMatcher returns a matcher for the .symlinkignore files under root,
+// and the git ignore files too when useGitignore is set. gitDir is where
+// info/exclude is read from, and may be empty outside of a repository.
+func NewIgnoreMatcher(root, gitDir string, useGitignore bool) *IgnoreMatcher {
+	return &IgnoreMatcher{
+		root:         root,
+		gitDir:       gitDir,
+		useGitignore: useGitignore,
+		patterns:     make(map[string][]ignorePattern),
+		ignored:      make(map[string]bool),
+	}
+}
+
+// Match reports whether path, or any directory containing it, is ignored
+func (m *IgnoreMatcher) Match(path string, isDir bool) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(m.root, absPath)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A path inside an ignored directory is ignored too
+	for i := 0; i < len(rel); i++ {
+		if rel[i] == '/' && m.isIgnoredLocked(rel[:i], true) {
+			return true
+		}
+	}
+	return m.isIgnoredLocked(rel, isDir)
+}
+
+func (m *IgnoreMatcher) isIgnoredLocked(rel string, isDir bool) bool {
+	if isDir {
+		if ignored, ok := m.ignored[rel]; ok {
+			return ignored
+		}
+	}
+
+	ignored := false
+	dir := ""
+	for {
+		relToDir := rel
+		if dir != "" {
+			relToDir = rel[len(dir)+1:]
+		}
+		for _, p := range m.patternsLocked(dir) {
+			if p.match(relToDir, isDir) {
+				ignored = !p.negate
+			}
+		}
+
+		next := strings.IndexByte(relToDir, '/')
+		if next < 0 {
+			break
+		}
+		if dir == "" {
+			dir = relToDir[:next]
+		} else {
+			dir = dir + "/" + relToDir[:next]
+		}
+	}
+
+	if isDir {
+		m.ignored[rel] = ignored
+	}
+	return ignored
+}
+
+// patternsLocked returns the patterns of the ignore files in dir, relative to root
+func (m *IgnoreMatcher) patternsLocked(dir string) []ignorePattern {
+	if patterns, ok := m.patterns[dir]; ok {
+		return patterns
+	}
+
+	absDir := filepath.Join(m.root, filepath.FromSlash(dir))
+	var patterns []ignorePattern
+	if m.useGitignore {
+		if dir == "" && m.gitDir != "" {
+			patterns = append(patterns, loadPatternsFromFile(filepath.Join(m.gitDir, "info", "exclude"))...)
+		}
+		patterns = append(patterns, loadPatternsFromFile(filepath.Join(absDir, ".gitignore"))...)
+	}
+
+	symlinkPatterns := loadPatternsFromFile(filepath.Join(absDir, ".symlinkignore"))
+	if len(symlinkPatterns) == 0 && dir == "" {
+		symlinkPatterns = loadPatternsFromFile(filepath.Join(absDir, ".config", "symlinkignore"))
+	}
+	patterns = append(patterns, symlinkPatterns...)
+
+	m.patterns[dir] = patterns
+	return patterns
+}
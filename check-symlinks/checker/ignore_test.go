@@ -0,0 +1,142 @@
+package checker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompileIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"foo", "foo", false, true},
+		{"foo", "a/b/foo", false, true},
+		{"foo", "foobar", false, false},
+		{"foo", "foobar", true, false},
+		{"foo/", "foo", true, true},
+		{"foo/", "foo", false, false},
+		{"/foo", "foo", false, true},
+		{"/foo", "a/foo", false, false},
+		{"a/foo", "a/foo", false, true},
+		{"a/foo", "b/a/foo", false, false},
+		{"*.log", "debug.log", false, true},
+		{"*.log", "logs/debug.log", false, true},
+		{"*.log", "debug.log/x", false, false},
+		{"a/*.log", "a/debug.log", false, true},
+		{"a/*.log", "a/b/debug.log", false, false},
+		{"debug?.log", "debug1.log", false, true},
+		{"debug?.log", "debug10.log", false, false},
+		{"debug[0-9].log", "debug1.log", false, true},
+		{"debug[!0-9].log", "debug1.log", false, false},
+		{"debug[!0-9].log", "debuga.log", false, true},
+		{"**/logs", "logs", true, true},
+		{"**/logs", "a/b/logs", true, true},
+		{"logs/**", "logs/a/b", false, true},
+		{"logs/**", "logs", true, false},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "a/x/y/c", false, false},
+		{`\#file`, "#file", false, true},
+		{`\!file`, "!file", false, true},
+		{`trailing\ `, "trailing ", false, true},
+		{"trailing   ", "trailing", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			p, ok := compileIgnorePattern(tt.pattern)
+			if !ok {
+				t.Fatalf("pattern %q did not compile", tt.pattern)
+			}
+			if got := p.match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("pattern %q matching %q (dir=%v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileIgnorePatternSkipsBlankAndComments(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "!", "/"} {
+		if _, ok := compileIgnorePattern(line); ok {
+			t.Errorf("expected %q to be skipped", line)
+		}
+	}
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		must(os.MkdirAll(filepath.Dir(path), 0o755))
+		must(os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".symlinkignore":      "build/\n*.tmp\n!keep.tmp\n/vendor\n",
+		"sub/.symlinkignore":  "local\n!build/\n",
+		"sub/deep/.gitignore": "generated\n",
+		".gitignore":          "node_modules\n",
+		".git/info/exclude":   "excluded\n",
+	})
+
+	tests := []struct {
+		path         string
+		isDir        bool
+		useGitignore bool
+		want         bool
+	}{
+		{"build", true, false, true},
+		{"build/link", false, false, true},
+		{"a/build/link", false, false, true},
+		{"builder/link", false, false, false},
+		{"file.tmp", false, false, true},
+		{"keep.tmp", false, false, false},
+		{"vendor/link", false, false, true},
+		{"a/vendor/link", false, false, false},
+		{"sub/local", false, false, true},
+		{"local", false, false, false},
+		{"sub/build/link", false, false, false},
+		{"sub/deep/generated", false, false, false},
+		{"sub/deep/generated", false, true, true},
+		{"node_modules/link", false, false, false},
+		{"node_modules/link", false, true, true},
+		{"a/node_modules/link", false, true, true},
+		{"excluded", false, true, true},
+		{"../outside", false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			m := NewIgnoreMatcher(root, filepath.Join(root, ".git"), tt.useGitignore)
+			path := filepath.Join(root, filepath.FromSlash(tt.path))
+			if got := m.Match(path, tt.isDir); got != tt.want {
+				t.Errorf("Match(%q, dir=%v, gitignore=%v) = %v, want %v", tt.path, tt.isDir, tt.useGitignore, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreMatcherConfigFile(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".config/symlinkignore": "ignored\n",
+	})
+
+	m := NewIgnoreMatcher(root, "", false)
+	if !m.Match(filepath.Join(root, "ignored"), false) {
+		t.Error("expected .config/symlinkignore patterns to be used")
+	}
+}
@@ -0,0 +1,124 @@
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotRepository is returned for paths outside of a git working tree
+var ErrNotRepository = errors.New("not a git repository")
+
+// Repository is the location of a git working tree
+type Repository struct {
+	// TopLevel is the root of the working tree
+	TopLevel string
+	// GitDir is the repository's common git directory, which holds
+	// info/exclude. For a linked worktree it's the main repository's.
+	GitDir string
+}
+
+// FindRepository returns the repository containing start, which may be a
+// file or a directory. Like git, it follows the .git files used by worktrees
+// and submodules and honors GIT_DIR and GIT_WORK_TREE.
+func FindRepository(start string) (Repository, error) {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return Repository{}, err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	if gitDir := os.Getenv("GIT_DIR"); gitDir != "" {
+		return repositoryFromEnv(dir, gitDir)
+	}
+
+	for {
+		gitDir, err := resolveGitDir(dir)
+		if err != nil {
+			return Repository{}, err
+		}
+		if gitDir != "" {
+			repo := Repository{TopLevel: dir, GitDir: commonDir(gitDir)}
+			if workTree := os.Getenv("GIT_WORK_TREE"); workTree != "" {
+				if repo.TopLevel, err = filepath.Abs(workTree); err != nil {
+					return Repository{}, err
+				}
+			}
+			return repo, nil
+		}
+		// If we reach the root, stop
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return Repository{}, ErrNotRepository
+		}
+		dir = parent
+	}
+}
+
+// repositoryFromEnv locates the repository given by GIT_DIR. Without
+// GIT_WORK_TREE, git treats the working directory as the top of the tree.
+func repositoryFromEnv(dir, gitDir string) (Repository, error) {
+	gitDir, err := filepath.Abs(gitDir)
+	if err != nil {
+		return Repository{}, err
+	}
+	workTree := os.Getenv("GIT_WORK_TREE")
+	if workTree == "" {
+		workTree = "."
+	}
+	workTree, err = filepath.Abs(workTree)
+	if err != nil {
+		return Repository{}, err
+	}
+	if !IsWithin(workTree, dir) {
+		return Repository{}, ErrNotRepository
+	}
+	return Repository{TopLevel: workTree, GitDir: commonDir(gitDir)}, nil
+}
+
+// resolveGitDir returns the git directory of the working tree rooted at dir,
+// or "" if dir isn't the root of one. A .git file points elsewhere with a
+// "gitdir:" line.
+func resolveGitDir(dir string) (string, error) {
+	gitPath := filepath.Join(dir, ".git")
+	info, err := os.Stat(gitPath)
+	if err != nil {
+		return "", nil
+	}
+	if info.IsDir() {
+		return gitPath, nil
+	}
+
+	content, err := os.ReadFile(gitPath)
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(content), "\n")
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(line), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("invalid gitfile format: %s", gitPath)
+	}
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	return filepath.Clean(gitDir), nil
+}
+
+// commonDir returns the directory shared by all worktrees of the repository
+// whose git directory is gitDir
+func commonDir(gitDir string) string {
+	content, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	common := strings.TrimSpace(string(content))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(gitDir, common)
+	}
+	return filepath.Clean(common)
+}
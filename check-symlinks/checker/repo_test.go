@@ -0,0 +1,124 @@
+package checker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// unsetGitEnv clears the variables that point git at another repository for
+// the duration of the test
+func unsetGitEnv(t *testing.T) {
+	for _, name := range []string{"GIT_DIR", "GIT_WORK_TREE"} {
+		t.Setenv(name, "")
+		must(os.Unsetenv(name))
+	}
+}
+
+func TestFindRepository(t *testing.T) {
+	unsetGitEnv(t)
+	root := t.TempDir()
+	git(t, root, "init", "--quiet", "main")
+	writeFiles(t, root, map[string]string{
+		"main/sub/file": "",
+		"plain/file":    "",
+		// A submodule's .git file points into the parent's modules directory
+		"main/.git/modules/lib/HEAD": "ref: refs/heads/main\n",
+		"main/lib/.git":              "gitdir: ../.git/modules/lib\n",
+		"main/lib/file":              "",
+		"broken/.git":                "not a gitfile\n",
+	})
+	git(t, filepath.Join(root, "main"), "commit", "--quiet", "--allow-empty", "-m", "initial")
+	git(t, filepath.Join(root, "main"), "worktree", "add", "--quiet", filepath.Join(root, "worktree"))
+
+	mainDir := filepath.Join(root, "main")
+	tests := []struct {
+		name  string
+		start string
+		want  Repository
+	}{
+		{"top-level", "main", Repository{TopLevel: mainDir, GitDir: filepath.Join(mainDir, ".git")}},
+		{"subdirectory", "main/sub", Repository{TopLevel: mainDir, GitDir: filepath.Join(mainDir, ".git")}},
+		{"file", "main/sub/file", Repository{TopLevel: mainDir, GitDir: filepath.Join(mainDir, ".git")}},
+		{"missing file", "main/sub/missing", Repository{TopLevel: mainDir, GitDir: filepath.Join(mainDir, ".git")}},
+		{"submodule", "main/lib/file", Repository{TopLevel: filepath.Join(mainDir, "lib"), GitDir: filepath.Join(mainDir, ".git", "modules", "lib")}},
+		{"worktree", "worktree", Repository{TopLevel: filepath.Join(root, "worktree"), GitDir: filepath.Join(mainDir, ".git")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindRepository(filepath.Join(root, filepath.FromSlash(tt.start)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("FindRepository(%s) = %+v, want %+v", tt.start, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("not a repository", func(t *testing.T) {
+		if _, err := FindRepository(filepath.Join(root, "plain")); !errors.Is(err, ErrNotRepository) {
+			t.Errorf("expected ErrNotRepository, got %v", err)
+		}
+	})
+
+	t.Run("invalid gitfile", func(t *testing.T) {
+		if _, err := FindRepository(filepath.Join(root, "broken")); err == nil || errors.Is(err, ErrNotRepository) {
+			t.Errorf("expected an invalid gitfile error, got %v", err)
+		}
+	})
+}
+
+func TestFindRepositoryFromEnv(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"repo.git/HEAD":  "ref: refs/heads/main\n",
+		"tree/sub/file":  "",
+		"outside/file":   "",
+		"nested/.git/x":  "",
+		"nested/in/file": "",
+	})
+	gitDir := filepath.Join(root, "repo.git")
+	workTree := filepath.Join(root, "tree")
+
+	t.Run("GIT_DIR and GIT_WORK_TREE", func(t *testing.T) {
+		t.Setenv("GIT_DIR", gitDir)
+		t.Setenv("GIT_WORK_TREE", workTree)
+		got, err := FindRepository(filepath.Join(workTree, "sub"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (Repository{TopLevel: workTree, GitDir: gitDir}); got != want {
+			t.Errorf("FindRepository() = %+v, want %+v", got, want)
+		}
+		if _, err := FindRepository(filepath.Join(root, "outside")); !errors.Is(err, ErrNotRepository) {
+			t.Errorf("expected paths outside GIT_WORK_TREE to not be in a repository, got %v", err)
+		}
+	})
+
+	t.Run("GIT_DIR only", func(t *testing.T) {
+		t.Chdir(workTree)
+		t.Setenv("GIT_DIR", gitDir)
+		t.Setenv("GIT_WORK_TREE", "")
+		got, err := FindRepository("sub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (Repository{TopLevel: workTree, GitDir: gitDir}); got != want {
+			t.Errorf("FindRepository() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("GIT_WORK_TREE only", func(t *testing.T) {
+		t.Setenv("GIT_DIR", "")
+		t.Setenv("GIT_WORK_TREE", workTree)
+		got, err := FindRepository(filepath.Join(root, "nested", "in"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (Repository{TopLevel: workTree, GitDir: filepath.Join(root, "nested", ".git")}); got != want {
+			t.Errorf("FindRepository() = %+v, want %+v", got, want)
+		}
+	})
+}
@@ -0,0 +1,310 @@
+package checker
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Format is how a report is written
+type Format string
+
+const (
+	FormatText  Format = "text"
+	FormatJSON  Format = "json"
+	FormatSARIF Format = "sarif"
+	FormatJUnit Format = "junit"
+)
+
+var formats = []Format{FormatText, FormatJSON, FormatSARIF, FormatJUnit}
+
+// ParseFormat validates the name passed to --format
+func ParseFormat(name string) (Format, error) {
+	for _, f := range formats {
+		if string(f) == strings.ToLower(name) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q, expected text, json, sarif or junit", name)
+}
+
+// Result is the outcome of checking a single symlink
+type Result struct {
+	Path     string
+	Target   string
+	Findings []Finding
+}
+
+// Report is everything found during a run
+type Report struct {
+	// FilesChecked is the number of paths looked at, symlinks or not
+	FilesChecked int64
+	// Links are the symlinks checked, with their findings
+	Links []Result
+	// Categories are the checks that were run
+	Categories []Category
+	// TopLevel is the repository root that locations are reported relative to
+	TopLevel string
+	// Version is the version of the tool reported in SARIF output
+	Version string
+}
+
+// Sort orders the links by path so that output doesn't depend on the order
+// the workers finished in
+func (r *Report) Sort() {
+	sort.Slice(r.Links, func(i, j int) bool { return r.Links[i].Path < r.Links[j].Path })
+}
+
+// Findings returns the findings of every link, in link order
+func (r Report) Findings() []Finding {
+	var findings []Finding
+	for _, l := range r.Links {
+		findings = append(findings, l.Findings...)
+	}
+	return findings
+}
+
+// uri returns path relative to the repository root using forward slashes, as
+// expected by code scanning tools
+func (r Report) uri(path string) string {
+	if r.TopLevel != "" {
+		if absPath, err := filepath.Abs(path); err == nil && IsWithin(r.TopLevel, absPath) {
+			if rel, err := filepath.Rel(r.TopLevel, absPath); err == nil {
+				return filepath.ToSlash(rel)
+			}
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// Write emits the report in the given format
+func (r Report) Write(w io.Writer, format Format, quiet bool) error {
+	switch format {
+	case FormatJSON:
+		return r.writeJSON(w)
+	case FormatSARIF:
+		return r.writeSARIF(w)
+	case FormatJUnit:
+		return r.writeJUnit(w)
+	default:
+		return r.writeText(w, quiet)
+	}
+}
+
+// writeText prints one line per finding followed by a summary
+func (r Report) writeText(w io.Writer, quiet bool) error {
+	if quiet {
+		return nil
+	}
+	for _, f := range r.Findings() {
+		if _, err := fmt.Fprintln(w, f); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "Total files checked: %d\n", r.FilesChecked)
+	return err
+}
+
+type jsonFinding struct {
+	Path     string   `json:"path"`
+	Target   string   `json:"target"`
+	Category Category `json:"check"`
+	Message  string   `json:"message"`
+}
+
+type jsonReport struct {
+	FilesChecked int64         `json:"files_checked"`
+	LinksChecked int           `json:"links_checked"`
+	Findings     []jsonFinding `json:"findings"`
+}
+
+func (r Report) writeJSON(w io.Writer) error {
+	out := jsonReport{
+		FilesChecked: r.FilesChecked,
+		LinksChecked: len(r.Links),
+		Findings:     []jsonFinding{},
+	}
+	for _, f := range r.Findings() {
+		out.Findings = append(out.Findings, jsonFinding{
+			Path:     f.Path,
+			Target:   f.Target,
+			Category: f.Category,
+			Message:  f.String(),
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	sarifSrcRoot = "%SRCROOT%"
+	projectURL   = "https://github.com/jmelahman/check-symlinks"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                    `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactPath `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactPath `json:"artifactLocation"`
+}
+
+type sarifArtifactPath struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+func (r Report) writeSARIF(w io.Writer) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "check-symlinks",
+			Version:        r.Version,
+			InformationURI: projectURL,
+		}},
+		Results: []sarifResult{},
+	}
+
+	ruleIndex := make(map[Category]int)
+	for i, c := range r.Categories {
+		ruleIndex[c] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               string(c),
+			ShortDescription: sarifMessage{Text: c.Description()},
+		})
+	}
+
+	baseID := ""
+	if r.TopLevel != "" {
+		baseID = sarifSrcRoot
+		run.OriginalURIBaseIDs = map[string]sarifArtifactPath{
+			sarifSrcRoot: {URI: "file://" + filepath.ToSlash(r.TopLevel) + "/"},
+		}
+	}
+
+	for _, f := range r.Findings() {
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    string(f.Category),
+			RuleIndex: ruleIndex[f.Category],
+			Level:     "error",
+			Message:   sarifMessage{Text: f.String()},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactPath{URI: r.uri(f.Path), URIBaseID: baseID},
+			}}},
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}})
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Failures  []junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit reports every symlink checked as a test case, failing those
+// with findings
+func (r Report) writeJUnit(w io.Writer) error {
+	suite := junitTestSuite{Name: "check-symlinks", Tests: len(r.Links)}
+	for _, l := range r.Links {
+		tc := junitTestCase{Name: r.uri(l.Path), ClassName: "check-symlinks"}
+		for _, f := range l.Findings {
+			tc.Failures = append(tc.Failures, junitFailure{
+				Type:    string(f.Category),
+				Message: f.String(),
+				Text:    fmt.Sprintf("%s -> %s", f.Path, f.Target),
+			})
+		}
+		if len(tc.Failures) > 0 {
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suites := junitTestSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
@@ -0,0 +1,131 @@
+package checker
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func testReport() Report {
+	r := Report{
+		FilesChecked: 4,
+		Categories:   []Category{Broken, Loop},
+		TopLevel:     "/repo",
+		Links: []Result{
+			{Path: "/repo/b/loop", Target: "loop", Findings: []Finding{{Path: "/repo/b/loop", Target: "loop", Category: Loop}}},
+			{Path: "/repo/a/valid", Target: "file"},
+			{Path: "/repo/a/broken", Target: "missing", Findings: []Finding{{Path: "/repo/a/broken", Target: "missing", Category: Broken}}},
+		},
+	}
+	r.Sort()
+	return r
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, name := range []string{"text", "json", "sarif", "junit", "SARIF"} {
+		if _, err := ParseFormat(name); err != nil {
+			t.Errorf("parseOutputFormat(%q) returned error: %v", name, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().Write(&buf, FormatText, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "Broken symlink: /repo/a/broken\nSymlink loop: /repo/b/loop\nTotal files checked: 4\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := testReport().Write(&buf, FormatText, true); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no output in quiet mode, got %q", buf.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().Write(&buf, FormatJSON, false); err != nil {
+		t.Fatal(err)
+	}
+	var got jsonReport
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if got.FilesChecked != 4 || got.LinksChecked != 3 || len(got.Findings) != 2 {
+		t.Fatalf("unexpected Report: %+v", got)
+	}
+	if got.Findings[0].Path != "/repo/a/broken" || got.Findings[0].Category != Broken {
+		t.Errorf("unexpected first Finding: %+v", got.Findings[0])
+	}
+}
+
+func TestWriteJSONWithoutFindings(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (Report{}).Write(&buf, FormatJSON, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"findings": []`) {
+		t.Errorf("expected an empty findings list, got %s", buf.String())
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().Write(&buf, FormatSARIF, false); err != nil {
+		t.Fatal(err)
+	}
+	var got sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if got.Version != "2.1.0" || len(got.Runs) != 1 {
+		t.Fatalf("unexpected log: %+v", got)
+	}
+	run := got.Runs[0]
+	if len(run.Tool.Driver.Rules) != 2 {
+		t.Errorf("expected a rule per enabled check, got %+v", run.Tool.Driver.Rules)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", run.Results)
+	}
+	loop := run.Results[1]
+	if loop.RuleID != "loop" || loop.RuleIndex != 1 {
+		t.Errorf("unexpected rule for %+v", loop)
+	}
+	location := loop.Locations[0].PhysicalLocation.ArtifactLocation
+	if location.URI != "b/loop" || location.URIBaseID != sarifSrcRoot {
+		t.Errorf("expected a repository-relative location, got %+v", location)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().Write(&buf, FormatJUnit, false); err != nil {
+		t.Fatal(err)
+	}
+	var got junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if got.Tests != 3 || got.Failures != 2 || len(got.Suites) != 1 {
+		t.Fatalf("unexpected totals: %+v", got)
+	}
+	cases := got.Suites[0].Cases
+	if cases[0].Name != "a/broken" || len(cases[0].Failures) != 1 || cases[0].Failures[0].Type != "broken" {
+		t.Errorf("unexpected test case: %+v", cases[0])
+	}
+	if cases[1].Name != "a/valid" || len(cases[1].Failures) != 0 {
+		t.Errorf("expected a passing test case, got %+v", cases[1])
+	}
+}
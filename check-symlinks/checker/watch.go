@@ -0,0 +1,81 @@
+package checker
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// Change is a difference in the findings of a link between two checks
+type Change struct {
+	Finding Finding
+	// Resolved is set when the problem has gone away, because the link or its
+	// target were fixed or the link was removed
+	Resolved bool
+}
+
+func (c Change) String() string {
+	if c.Resolved {
+		return "Resolved: " + c.Finding.String()
+	}
+	return c.Finding.String()
+}
+
+// linkState is the last findings of each symlink being watched. A link
+// without problems has an entry with no findings.
+type linkState map[string][]Finding
+
+// recheck checks every link again and returns how their findings changed.
+// Links that no longer exist are dropped.
+func (s linkState) recheck(topLevel string, categories []Category) []Change {
+	paths := make([]string, 0, len(s))
+	for path := range s {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var changes []Change
+	for _, path := range paths {
+		old := s[path]
+		var current []Finding
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			current = checkLink(path, topLevel, categories)
+			s[path] = current
+		} else {
+			delete(s, path)
+		}
+		changes = append(changes, diffFindings(old, current)...)
+	}
+	return changes
+}
+
+// diffFindings compares the findings of a link before and after a check
+func diffFindings(old, current []Finding) []Change {
+	hasCategory := func(findings []Finding, c Category) bool {
+		return slices.ContainsFunc(findings, func(f Finding) bool { return f.Category == c })
+	}
+	var changes []Change
+	for _, f := range current {
+		if !hasCategory(old, f.Category) {
+			changes = append(changes, Change{Finding: f})
+		}
+	}
+	for _, f := range old {
+		if !hasCategory(current, f.Category) {
+			changes = append(changes, Change{Finding: f, Resolved: true})
+		}
+	}
+	return changes
+}
+
+// withinRoots reports whether path is one of roots or inside of one
+func withinRoots(roots []string, path string) bool {
+	path = filepath.Clean(path)
+	for _, root := range roots {
+		if IsWithin(filepath.Clean(root), path) {
+			return true
+		}
+	}
+	return false
+}
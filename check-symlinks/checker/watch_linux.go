@@ -0,0 +1,254 @@
+//go:build linux
+
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/charlievieth/fastwalk"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// watchMask selects the inotify events that can change the state of a link
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_ATTRIB | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+// inotifyEvent is a decoded inotify event
+type inotifyEvent struct {
+	wd   int
+	mask uint32
+	name string
+}
+
+// watcher follows the directories of a tree with inotify
+type watcher struct {
+	c          *Checker
+	roots      []string
+	categories []Category
+	fd         int
+	file       *os.File
+
+	mu    sync.Mutex
+	dirs  map[int]string
+	links linkState
+}
+
+// Watch checks paths and keeps watching them with inotify, sending the
+// problems found by the first check and then every change to them as links
+// or their targets are created, removed or renamed. Bursts of events are
+// debounced so that a tree is re-checked once they settle. Directories are
+// watched under the same hidden and ignore rules as a walk. The channel is
+// closed when ctx is cancelled.
+//
+// Links are re-checked after any event in the watched tree, so a link to a
+// target outside of it is only noticed to break once something in the tree
+// changes too.
+func (c *Checker) Watch(ctx context.Context, paths []string, debounce time.Duration) (<-chan Change, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	categories := c.Categories
+	if categories == nil {
+		categories = DefaultCategories
+	}
+	w := &watcher{
+		c:          c,
+		roots:      paths,
+		categories: categories,
+		fd:         fd,
+		// Wrapping the non-blocking descriptor lets reads be interrupted by Close
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		dirs:  make(map[int]string),
+		links: make(linkState),
+	}
+
+	// Watches are in place before returning so that no change is missed
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			w.walk(path)
+			continue
+		}
+		w.links[path] = nil
+		w.addWatch(filepath.Dir(path))
+	}
+
+	events := make(chan inotifyEvent, 100)
+	go w.read(ctx, events)
+
+	changes := make(chan Change, 100)
+	go func() {
+		defer close(changes)
+		defer w.file.Close()
+
+		send := func(batch []Change) bool {
+			for _, change := range batch {
+				select {
+				case changes <- change:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
+		if !send(w.links.recheck(c.TopLevel, w.categories)) {
+			return
+		}
+
+		var pending []inotifyEvent
+		var settled <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				pending = append(pending, event)
+				settled = time.After(debounce)
+			case <-settled:
+				log.Debugf("Re-checking after %d events", len(pending))
+				w.handle(pending)
+				pending, settled = nil, nil
+				if !send(w.links.recheck(c.TopLevel, w.categories)) {
+					return
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// read decodes events from the inotify descriptor until it's closed
+func (w *watcher) read(ctx context.Context, events chan<- inotifyEvent) {
+	defer close(events)
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Debugf("Error reading inotify events: %v", err)
+			}
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+			if nameEnd > n {
+				break
+			}
+			name := string(buf[nameStart:nameEnd])
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+			select {
+			case events <- inotifyEvent{wd: int(raw.Wd), mask: raw.Mask, name: name}:
+			case <-ctx.Done():
+				return
+			}
+			offset = nameEnd
+		}
+	}
+}
+
+// handle starts watching created directories and links. Removed links are
+// dropped by the next re-check.
+func (w *watcher) handle(events []inotifyEvent) {
+	for _, event := range events {
+		if event.mask&unix.IN_Q_OVERFLOW != 0 {
+			// Events were dropped, so look for anything new from the top
+			log.Debug("Inotify queue overflowed, walking the tree again")
+			for _, root := range w.roots {
+				if info, err := os.Stat(root); err == nil && info.IsDir() {
+					w.walk(root)
+				}
+			}
+			continue
+		}
+		w.mu.Lock()
+		dir, ok := w.dirs[event.wd]
+		if event.mask&unix.IN_IGNORED != 0 {
+			// The directory was removed and its watch with it
+			delete(w.dirs, event.wd)
+		}
+		w.mu.Unlock()
+		if !ok || event.name == "" || event.mask&(unix.IN_CREATE|unix.IN_MOVED_TO) == 0 {
+			continue
+		}
+
+		path := filepath.Join(dir, event.name)
+		if !withinRoots(w.roots, path) {
+			continue
+		}
+		fi, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			if !w.c.skip(path, false) {
+				w.addLink(path)
+			}
+		case fi.IsDir():
+			if !w.c.skip(path, true) {
+				w.walk(path)
+			}
+		}
+	}
+}
+
+// walk watches root and the directories beneath it and records their links
+func (w *watcher) walk(root string) {
+	w.addWatch(root)
+	err := fastwalk.Walk(nil, root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		if w.c.skip(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case d.IsDir():
+			w.addWatch(path)
+		case d.Type()&os.ModeSymlink != 0:
+			w.addLink(path)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Debugf("Error walking %s: %v", root, err)
+	}
+}
+
+func (w *watcher) addWatch(dir string) {
+	wd, err := unix.InotifyAddWatch(w.fd, dir, watchMask)
+	if err != nil {
+		log.Warnf("Failed to watch %s: %v", dir, err)
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.dirs[wd] = dir
+}
+
+func (w *watcher) addLink(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.links[path]; !ok {
+		w.links[path] = nil
+	}
+}
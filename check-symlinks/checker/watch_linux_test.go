@@ -0,0 +1,117 @@
+package checker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// nextChange waits for the watcher to report a change
+func nextChange(t *testing.T, changes <-chan Change) Change {
+	t.Helper()
+	select {
+	case change, ok := <-changes:
+		if !ok {
+			t.Fatal("watch stopped unexpectedly")
+		}
+		return change
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a change")
+	}
+	return Change{}
+}
+
+func expectChange(t *testing.T, changes <-chan Change, path string, category Category, resolved bool) {
+	t.Helper()
+	change := nextChange(t, changes)
+	if change.Finding.Path != path || change.Finding.Category != category || change.Resolved != resolved {
+		t.Errorf("got change %q, want %s %s (resolved=%v)", change, category, path, resolved)
+	}
+}
+
+func expectNoChange(t *testing.T, changes <-chan Change) {
+	t.Helper()
+	select {
+	case change := <-changes:
+		t.Errorf("unexpected change %q", change)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWatch(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"deps/lib/file":  "",
+		"build/output":   "",
+		"skip_dir/file":  "",
+		"initial/target": "",
+	})
+	must(os.Symlink("missing", filepath.Join(root, "initial", "broken")))
+	must(os.Symlink("deps/lib/file", filepath.Join(root, "to_dep")))
+	must(os.Symlink("../build/output", filepath.Join(root, "initial", "to_build")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New(Options{Ignore: prefixMatcher("skip_")})
+	changes, err := c.Watch(ctx, []string{root}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first check reports existing problems
+	expectChange(t, changes, filepath.Join(root, "initial", "broken"), Broken, false)
+
+	// A dependency directory being deleted breaks the link to it
+	must(os.RemoveAll(filepath.Join(root, "deps")))
+	expectChange(t, changes, filepath.Join(root, "to_dep"), Broken, false)
+
+	// A build output being cleaned
+	must(os.Remove(filepath.Join(root, "build", "output")))
+	expectChange(t, changes, filepath.Join(root, "initial", "to_build"), Broken, false)
+
+	// Restoring the target resolves the problem
+	writeFiles(t, root, map[string]string{"build/output": ""})
+	expectChange(t, changes, filepath.Join(root, "initial", "to_build"), Broken, true)
+
+	// Links created in new directories are watched too
+	must(os.MkdirAll(filepath.Join(root, "new", "nested"), 0o755))
+	must(os.Symlink("missing", filepath.Join(root, "new", "nested", "broken")))
+	expectChange(t, changes, filepath.Join(root, "new", "nested", "broken"), Broken, false)
+
+	// Removing a broken link resolves it
+	must(os.Remove(filepath.Join(root, "initial", "broken")))
+	expectChange(t, changes, filepath.Join(root, "initial", "broken"), Broken, true)
+
+	// Ignored directories are not watched
+	must(os.Symlink("missing", filepath.Join(root, "skip_dir", "broken")))
+	must(os.Symlink("missing", filepath.Join(root, "skip_link")))
+	expectNoChange(t, changes)
+
+	cancel()
+	for range changes {
+	}
+}
+
+func TestWatchDebounce(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"target": ""})
+	must(os.Symlink("target", filepath.Join(root, "link")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := New(Options{}).Watch(ctx, []string{root}, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A link that is broken and repaired within the debounce window is
+	// never reported
+	must(os.Remove(filepath.Join(root, "target")))
+	writeFiles(t, root, map[string]string{"target": ""})
+	expectNoChange(t, changes)
+
+	must(os.Remove(filepath.Join(root, "target")))
+	expectChange(t, changes, filepath.Join(root, "link"), Broken, false)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package checker
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Watch is only supported on Linux, where it uses inotify
+func (c *Checker) Watch(ctx context.Context, paths []string, debounce time.Duration) (<-chan Change, error) {
+	return nil, errors.New("watch mode is only supported on Linux")
+}
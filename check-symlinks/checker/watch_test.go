@@ -0,0 +1,17 @@
+package checker
+
+import "testing"
+
+func TestDiffFindings(t *testing.T) {
+	broken := Finding{Path: "link", Category: Broken}
+	escape := Finding{Path: "link", Category: Escape}
+
+	changes := diffFindings([]Finding{broken}, []Finding{escape})
+	want := []Change{{Finding: escape}, {Finding: broken, Resolved: true}}
+	if len(changes) != 2 || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("diffFindings() = %v, want %v", changes, want)
+	}
+	if changes := diffFindings([]Finding{broken}, []Finding{broken}); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
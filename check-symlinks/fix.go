@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jmelahman/check-symlinks/checker"
+)
+
+// confirm asks the user a yes/no question, defaulting to no
+func confirm(in *bufio.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s (y/N): ", question)
+	response, err := in.ReadString('\n')
+	if err != nil {
+		// Keep the following output off the prompt line when input ends early
+		fmt.Fprintln(out)
+	}
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes"
+}
+
+// applyFixes applies or, with dryRun, prints the planned fixes. Deletions
+// need confirmation unless yes is set. It returns the fixes that were not
+// applied.
+func applyFixes(fixes []checker.Fix, dryRun, yes bool, in io.Reader, out io.Writer) []checker.Fix {
+	reader := bufio.NewReader(in)
+	var skipped []checker.Fix
+	for _, f := range fixes {
+		if dryRun {
+			fmt.Fprintln(out, f.Describe(true))
+			continue
+		}
+		if f.Action == checker.Delete && !yes && !confirm(reader, out, fmt.Sprintf("Delete dangling symlink %s?", f.Path)) {
+			skipped = append(skipped, f)
+			continue
+		}
+		if err := f.Apply(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error fixing %s: %v\n", f.Path, err)
+			skipped = append(skipped, f)
+			continue
+		}
+		fmt.Fprintln(out, f.Describe(false))
+	}
+	if dryRun {
+		return fixes
+	}
+	return skipped
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmelahman/check-symlinks/checker"
+)
+
+func TestApplyFixes(t *testing.T) {
+	root := t.TempDir()
+	must(os.MkdirAll(filepath.Join(root, "docs"), 0o755))
+	must(os.WriteFile(filepath.Join(root, "docs", "guide.md"), nil, 0o644))
+	must(os.Symlink(filepath.Join(root, "docs", "guide.md"), filepath.Join(root, "absolute")))
+	must(os.Symlink("missing", filepath.Join(root, "dangling")))
+	must(os.Symlink("missing", filepath.Join(root, "kept")))
+	fixes := []checker.Fix{
+		{Path: filepath.Join(root, "absolute"), NewTarget: "docs/guide.md", Action: checker.Relativize},
+		{Path: filepath.Join(root, "dangling"), Action: checker.Delete},
+		{Path: filepath.Join(root, "kept"), Action: checker.Delete},
+	}
+
+	var out bytes.Buffer
+	if skipped := applyFixes(fixes, true, false, strings.NewReader(""), &out); len(skipped) != len(fixes) {
+		t.Errorf("expected a dry run to skip every fix, got %v", skipped)
+	}
+	if target, _ := os.Readlink(filepath.Join(root, "absolute")); target != filepath.Join(root, "docs", "guide.md") {
+		t.Errorf("dry run rewrote link to %s", target)
+	}
+	if !strings.Contains(out.String(), "Would delete") {
+		t.Errorf("expected dry run output, got %q", out.String())
+	}
+
+	out.Reset()
+	skipped := applyFixes(fixes, false, false, strings.NewReader("y\nn\n"), &out)
+	if len(skipped) != 1 || skipped[0].Path != filepath.Join(root, "kept") {
+		t.Errorf("expected the declined deletion to be skipped, got %v", skipped)
+	}
+	if target, _ := os.Readlink(filepath.Join(root, "absolute")); target != "docs/guide.md" {
+		t.Errorf("expected link to be rewritten, got %s", target)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "dangling")); !os.IsNotExist(err) {
+		t.Errorf("expected dangling link to be deleted, got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "kept")); err != nil {
+		t.Errorf("expected declined link to be kept, got %v", err)
+	}
+}
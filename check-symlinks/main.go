@@ -1,16 +1,17 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
-	"path/filepath"
-	"runtime"
-	"strings"
-	"sync"
-	"sync/atomic"
+	"os/signal"
+	"slices"
+	"time"
 
-	"github.com/charlievieth/fastwalk"
+	"github.com/jmelahman/check-symlinks/checker"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -23,13 +24,37 @@ var (
 var (
 	includeHidden bool
 	noIgnore      bool
+	useGitignore  bool
+	checks        []string
+	fixLinks      bool
+	dryRun        bool
+	yes           bool
 	quiet         bool
 	debug         bool
+	formatName    string
+	staged        bool
+	since         string
+	jobs          int
+	watch         bool
+	debounce      time.Duration
+)
+
+// Exit codes
+const (
+	// exitOK means no problems were found
+	exitOK = 0
+	// exitFindings means at least one link has a problem
+	exitFindings = 1
+	// exitUsage means the flags or arguments are invalid
+	exitUsage = 2
+	// exitError means the check could not be completed, for example because a
+	// directory could not be walked
+	exitError = 127
 )
 
 func main() {
 	var rootCmd = &cobra.Command{
-		Use:     "check-symlinks [paths...]",
+		Use:     "check-symlinks [paths...] | check-symlinks -- [files...]",
 		Short:   "Check for broken symbolic links",
 		Run:     runCheckSymlinks,
 		Version: fmt.Sprintf("%s\ncommit %s", version, commit),
@@ -37,18 +62,56 @@ func main() {
 
 	rootCmd.Flags().BoolVar(&includeHidden, "hidden", false, "include hidden files and directories in the check")
 	rootCmd.Flags().BoolVar(&noIgnore, "no-ignore", false, "don't use ignore files")
+	rootCmd.Flags().BoolVar(&useGitignore, "gitignore", false, "also skip paths ignored by .gitignore files")
 	rootCmd.Flags().BoolVar(&debug, "debug", false, "run in debug mode")
 	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "run in quiet mode")
+	rootCmd.Flags().StringSliceVar(&checks, "checks", categoryNames(checker.DefaultCategories), "problems to check for: broken, loop, escape, absolute, ignored, permission or all")
+	rootCmd.Flags().BoolVar(&fixLinks, "fix", false, "repair broken links and rewrite absolute links inside the repository to relative ones")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the changes --fix would make without making them")
+	rootCmd.Flags().BoolVar(&staged, "staged", false, "only check links added or changed in the index, and links to files it removes")
+	rootCmd.Flags().StringVar(&since, "since", "", "only check links changed since the branch diverged from `ref`, and links to files removed since")
+	rootCmd.Flags().StringVar(&formatName, "format", string(checker.FormatText), "output format: text, json, sarif or junit")
+	rootCmd.Flags().BoolVarP(&yes, "yes", "y", false, "delete dangling links with --fix without asking for confirmation")
+	rootCmd.Flags().BoolVarP(&watch, "watch", "w", false, "keep running and report problems as links and their targets change")
+	rootCmd.Flags().DurationVar(&debounce, "debounce", 100*time.Millisecond, "how long changes must settle before --watch checks again")
+	rootCmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "number of paths to check at once (default one less than the number of CPUs)")
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(2)
+		os.Exit(exitUsage)
 	}
 }
 
 func runCheckSymlinks(cmd *cobra.Command, args []string) {
+	// Files after "--" are checked as a list of changed files, as passed by
+	// pre-commit, rather than walked
+	listFiles := cmd.ArgsLenAtDash() >= 0
+	if listFiles && cmd.ArgsLenAtDash() > 0 {
+		fmt.Fprintln(os.Stderr, "Error: paths can't be combined with a list of files after --")
+		os.Exit(exitUsage)
+	}
+	changeModes := 0
+	for _, enabled := range []bool{listFiles, staged, since != ""} {
+		if enabled {
+			changeModes++
+		}
+	}
+	if changeModes > 1 {
+		fmt.Fprintln(os.Stderr, "Error: only one of --staged, --since and a list of files after -- can be used")
+		os.Exit(exitUsage)
+	}
+	if (staged || since != "") && len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: paths can't be combined with --staged or --since")
+		os.Exit(exitUsage)
+	}
+
+	if watch && (changeModes > 0 || fixLinks || dryRun) {
+		fmt.Fprintln(os.Stderr, "Error: --watch can't be combined with --fix, --dry-run, --staged, --since or a list of files")
+		os.Exit(exitUsage)
+	}
+
 	// Default to current directory if no args provided
-	if len(args) == 0 {
+	if len(args) == 0 && changeModes == 0 {
 		args = []string{"."}
 	}
 
@@ -58,199 +121,222 @@ func runCheckSymlinks(cmd *cobra.Command, args []string) {
 		log.SetLevel(log.InfoLevel)
 	}
 
-	topLevel, err := getTopLevel(".")
+	categories, err := checker.ParseCategories(checks)
 	if err != nil {
-		log.Errorf("Failed to find toplevel directory: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
 	}
 
-	// Load ignore patterns
-	var ignorePatterns []string
-	if !noIgnore {
-		ignorePatterns = loadIgnorePatterns(topLevel)
+	format, err := checker.ParseFormat(formatName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
 	}
 
-	var wg sync.WaitGroup
-	var filesChecked int64
-	rc := 0
-	paths := make(chan string, 100)
-	done := make(chan struct{})
-
-	// Worker pool
-	for range int64(runtime.NumCPU() - 1) {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for path := range paths {
-				atomic.AddInt64(&filesChecked, 1)
-				fi, err := os.Lstat(path)
-				if err != nil || fi.Mode()&os.ModeSymlink == 0 {
-					continue
-				}
-				_, err = os.Stat(path)
-				if os.IsNotExist(err) {
-					if !quiet {
-						fmt.Println("Broken symlink:", path)
-					}
-					rc = 1
-				}
-			}
-		}()
+	// The repository of the working directory is the one --staged and --since
+	// compare against, and that locations are reported relative to
+	cwdRepo, err := checker.FindRepository(".")
+	if err != nil {
+		log.Debugf("Failed to find toplevel directory: %v", err)
 	}
+	topLevel := cwdRepo.TopLevel
 
-	// Process each path
-	go func() {
-		defer close(paths)
-		for _, rootPath := range args {
-			if info, err := os.Stat(rootPath); os.IsNotExist(err) || !info.IsDir() {
-				paths <- rootPath
-			} else {
-				err := fastwalk.Walk(nil, rootPath, func(path string, d os.DirEntry, err error) error {
-					if err != nil {
-						return nil
-					}
-
-					// Skip hidden files and directories unless --hidden flag is set
-					if !includeHidden && isHidden(path) {
-						if d.IsDir() {
-							return filepath.SkipDir
-						}
-						return nil
-					}
+	// Absolute links inside the repository are always repaired by --fix
+	fixMode := fixLinks || dryRun
+	linkCategories := categories
+	if fixMode && !slices.Contains(linkCategories, checker.Absolute) {
+		linkCategories = append(slices.Clone(categories), checker.Absolute)
+	}
 
-					// Check if path should be ignored
-					if shouldIgnorePath(topLevel, path, ignorePatterns) {
-						log.Debug("Skipping: ", path)
-						if d.IsDir() {
-							return filepath.SkipDir
-						}
-						return nil
-					}
+	opts := checker.Options{
+		Categories:    linkCategories,
+		IncludeHidden: includeHidden,
+		Concurrency:   jobs,
+	}
 
-					paths <- path
-					return nil
-				})
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error walking directory %s: %v\n", rootPath, err)
-					rc = 127
-				}
+	// In pre-commit mode only the links touched by the change are checked
+	var scans []*scan
+	switch {
+	case staged || since != "":
+		if topLevel == "" {
+			fmt.Fprintln(os.Stderr, "Error: --staged and --since require a git repository")
+			os.Exit(exitError)
+		}
+		var changes checker.ChangeSet
+		if staged {
+			changes, err = checker.StagedChanges(topLevel)
+		} else {
+			changes, err = checker.ChangesSince(topLevel, since)
+		}
+		s := newScan(cwdRepo, topLevel, opts)
+		if err == nil {
+			s.paths, err = changes.LinksToCheck(topLevel)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitError)
+		}
+		scans = []*scan{s}
+	case listFiles:
+		scans = newScans(args, opts)
+		for _, s := range scans {
+			s.paths, err = checker.ListedChanges(s.paths).LinksToCheck(s.repo.TopLevel)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitError)
 			}
 		}
-	}()
-
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-
-	<-done
-	if !quiet {
-		fmt.Printf("Total files checked: %d\n", atomic.LoadInt64(&filesChecked))
+	default:
+		scans = newScans(args, opts)
 	}
-	os.Exit(rc)
-}
 
-// isHidden checks if a file or directory is hidden (starts with '.')
-// It checks only the base name, not the full path
-func isHidden(path string) bool {
-	base := filepath.Base(path)
-	return strings.HasPrefix(base, ".") && base != "." && base != ".."
-}
-
-// loadIgnorePatterns loads ignore patterns from .symlinkignore and .config/symlinkignore files
-func loadIgnorePatterns(rootDir string) []string {
-	var patterns []string
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	// Check for .symlinkignore in current directory
-	configPath := filepath.Join(rootDir, ".symlinkignore")
-	if patterns = loadPatternsFromFile(configPath); len(patterns) > 0 {
-		log.Debug("Found ignore file: ", configPath)
-		return patterns
+	if watch {
+		if format != checker.FormatText {
+			fmt.Fprintln(os.Stderr, "Error: --watch only supports text output")
+			os.Exit(exitUsage)
+		}
+		os.Exit(runWatch(ctx, scans))
 	}
 
-	// Check for .config/symlinkignore
-	configPath = filepath.Join(rootDir, ".config", "symlinkignore")
-	if patterns = loadPatternsFromFile(configPath); len(patterns) > 0 {
-		log.Debug("Found ignore file: ", configPath)
-		return patterns
+	r := checker.Report{Categories: categories, TopLevel: topLevel, Version: version}
+	var errs []error
+	for _, s := range scans {
+		var results <-chan checker.Result
+		if changeModes > 0 {
+			log.Debugf("Checking %d changed paths", len(s.paths))
+			results = s.checker.FileResults(ctx, s.paths)
+		} else {
+			results = s.checker.Results(ctx, s.paths)
+		}
+		for result := range results {
+			s.results = append(s.results, result)
+		}
+		r.Links = append(r.Links, s.results...)
+		r.FilesChecked += s.checker.FilesChecked()
+		errs = append(errs, s.checker.Err())
 	}
-
-	return patterns
-}
-
-// loadPatternsFromFile reads patterns from a file
-func loadPatternsFromFile(filename string) []string {
-	var patterns []string
-
-	file, err := os.Open(filename)
-	if err != nil {
-		return patterns
+	r.Sort()
+	checkErr := errors.Join(errs...)
+	if checkErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", checkErr)
 	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			log.Error("Error closing file: ", err)
-		}
-	}()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		// Skip empty lines and comments
-		if line != "" && !strings.HasPrefix(line, "#") {
-			patterns = append(patterns, line)
+	if fixMode && checkErr == nil {
+		// Keep fix messages and prompts out of machine-readable output
+		out := os.Stdout
+		if format != checker.FormatText {
+			out = os.Stderr
+		}
+		remaining := make(map[string][]checker.Finding)
+		for _, s := range scans {
+			var findings []checker.Finding
+			for _, result := range s.results {
+				findings = append(findings, result.Findings...)
+			}
+			maps.Copy(remaining, runFixes(findings, categories, s.repo.TopLevel, s.paths, s.checker.Ignore, out))
+		}
+		for i := range r.Links {
+			r.Links[i].Findings = remaining[r.Links[i].Path]
 		}
 	}
 
-	return patterns
+	if err := r.Write(os.Stdout, format, quiet); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+		os.Exit(exitError)
+	}
+	os.Exit(exitCode(r, checkErr))
 }
 
-// shouldIgnorePath checks if a path matches any ignore pattern
-func shouldIgnorePath(topLevel, path string, patterns []string) bool {
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		absPath = path
+// runWatch prints problems as they appear and are resolved until
+// interrupted. It returns whether any problems remain as an exit code.
+func runWatch(ctx context.Context, scans []*scan) int {
+	var channels []<-chan checker.Change
+	for _, s := range scans {
+		changes, err := s.checker.Watch(ctx, s.paths, debounce)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		channels = append(channels, changes)
 	}
-	rel, err := filepath.Rel(topLevel, absPath)
-	if err != nil {
-		rel = path
+	if !quiet {
+		fmt.Fprintln(os.Stderr, "Watching for changes, press Ctrl+C to stop")
 	}
-	rel = filepath.ToSlash(rel)
-	base := filepath.Base(rel)
 
-	for _, p := range patterns {
-		p = strings.TrimSuffix(filepath.ToSlash(p), "/")
-		// Match prefix
-		if strings.HasPrefix(rel, p) {
-			return true
-		}
-		// Match directory
-		if strings.HasPrefix(rel, p+"/") {
-			return true
+	problems := make(map[checker.Finding]bool)
+	for change := range mergeChanges(ctx, channels) {
+		key := checker.Finding{Path: change.Finding.Path, Category: change.Finding.Category}
+		if change.Resolved {
+			delete(problems, key)
+		} else {
+			problems[key] = true
 		}
-		// Match filename
-		if base == p {
-			return true
+		if !quiet {
+			fmt.Println(change)
 		}
 	}
-	return false
+	if len(problems) > 0 {
+		return exitFindings
+	}
+	return exitOK
 }
 
-func getTopLevel(start string) (string, error) {
-	dir, err := filepath.Abs(start)
-	if err != nil {
-		return "", err
+// exitCode decides the exit status of a run. Errors take precedence over
+// findings so that a partial scan is never reported as a clean one.
+func exitCode(r checker.Report, err error) int {
+	switch {
+	case err != nil:
+		return exitError
+	case len(r.Findings()) > 0:
+		return exitFindings
+	default:
+		return exitOK
+	}
+}
+
+// runFixes repairs the links with findings and returns the problems that
+// remain, by link path
+func runFixes(findings []checker.Finding, categories []checker.Category, topLevel string, roots []string, ignore checker.Matcher, out io.Writer) map[string][]checker.Finding {
+	remaining := make(map[string][]checker.Finding)
+	if len(findings) == 0 {
+		return remaining
 	}
 
-	for {
-		gitPath := filepath.Join(dir, ".git")
-		info, err := os.Stat(gitPath)
-		if err == nil && info.IsDir() {
-			return dir, nil
+	var index checker.BasenameIndex
+	if slices.ContainsFunc(findings, func(f checker.Finding) bool { return f.Category == checker.Broken }) {
+		indexRoots := roots
+		if topLevel != "" {
+			indexRoots = []string{topLevel}
 		}
-		// If we reach the root, stop
-		parent := filepath.Dir(dir)
-		if parent == dir {
-			return "", fmt.Errorf("not a git repository")
+		index = checker.BuildBasenameIndex(indexRoots, ignore, includeHidden)
+	}
+
+	fixes, unfixed := checker.PlanFixes(findings, topLevel, index)
+	skipped := make(map[string]bool)
+	for _, f := range applyFixes(fixes, dryRun, yes, os.Stdin, out) {
+		skipped[f.Path] = true
+	}
+	for _, f := range findings {
+		if skipped[f.Path] && slices.Contains(categories, f.Category) {
+			remaining[f.Path] = append(remaining[f.Path], f)
+		}
+	}
+	for _, f := range unfixed {
+		if slices.Contains(categories, f.Category) {
+			remaining[f.Path] = append(remaining[f.Path], f)
 		}
-		dir = parent
 	}
+	return remaining
+}
+
+// categoryNames returns the names of categories, as accepted by --checks
+func categoryNames(categories []checker.Category) []string {
+	names := make([]string, len(categories))
+	for i, c := range categories {
+		names[i] = string(c)
+	}
+	return names
 }
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"os/exec"
 	"strings"
 	"testing"
+
+	"github.com/jmelahman/check-symlinks/checker"
 )
 
 func setUp() {
@@ -46,6 +49,13 @@ func TestExpectSuccess(t *testing.T) {
 		{"testdata/.hidden_dir"},
 		{"testdata/.hidden_dir/hidden_file"},
 		{"--hidden", "testdata/.hidden_dir/hidden_file"},
+		{"testdata/valid_absolute_link"},
+		{"--checks", "broken", "testdata/loop_link"},
+		{"--checks", "escape", "testdata/valid_link"},
+		{"--format", "json", "testdata/valid_link"},
+		{"--format", "sarif", "testdata/valid_link"},
+		{"--", "testdata/valid_link", "testdata/some_file"},
+		{"--", "testdata/doesnt_exist"},
 	}
 
 	for _, tt := range tests {
@@ -62,6 +72,15 @@ func TestExpectFailure(t *testing.T) {
 		{"--hidden", "testdata/.hidden_broken_link"},
 		{"--hidden", "testdata/.hidden_dir/hidden_broken_link"},
 		{"testdata/broken_link", "testdata/some_file", "testdata/valid_link", "", "doesnt_exist"},
+		{"testdata/loop_link"},
+		{"--checks", "loop", "testdata/loop_link"},
+		{"--checks", "absolute", "testdata/valid_absolute_link"},
+		{"--checks", "escape", "testdata/valid_absolute_link"},
+		{"--checks", "all", "testdata/valid_absolute_link"},
+		{"--format", "json", "testdata/broken_link"},
+		{"--format", "sarif", "testdata/broken_link"},
+		{"--format", "junit", "testdata/broken_link"},
+		{"--", "testdata/valid_link", "testdata/broken_link"},
 	}
 
 	for _, tt := range tests {
@@ -74,6 +93,11 @@ func TestExpectFailure(t *testing.T) {
 func TestExpectError(t *testing.T) {
 	tests := [][]string{
 		{"--foo"},
+		{"--checks", "bogus"},
+		{"--format", "bogus"},
+		{"--staged", "testdata"},
+		{"--staged", "--since", "HEAD"},
+		{"testdata", "--", "testdata/broken_link"},
 	}
 
 	for _, tt := range tests {
@@ -83,6 +107,33 @@ func TestExpectError(t *testing.T) {
 	}
 }
 
+func TestExitCode(t *testing.T) {
+	clean := checker.Report{Links: []checker.Result{{Path: "valid"}}}
+	broken := checker.Report{Links: []checker.Result{{
+		Path:     "broken",
+		Findings: []checker.Finding{{Path: "broken", Category: checker.Broken}},
+	}}}
+	walkErr := errors.New("walking directory: permission denied")
+	tests := []struct {
+		name string
+		r    checker.Report
+		err  error
+		want int
+	}{
+		{"clean", clean, nil, exitOK},
+		{"findings", broken, nil, exitFindings},
+		{"walk error", clean, walkErr, exitError},
+		{"walk error with findings", broken, walkErr, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.r, tt.err); got != tt.want {
+				t.Errorf("exitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
 func must(err error) {
 	if err != nil {
 		panic(err)
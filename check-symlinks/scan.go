@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jmelahman/check-symlinks/checker"
+	log "github.com/sirupsen/logrus"
+)
+
+// scan is a group of paths checked against the same repository and ignore
+// files
+type scan struct {
+	repo    checker.Repository
+	paths   []string
+	checker *checker.Checker
+	results []checker.Result
+}
+
+// newScans groups paths by the repository containing them, so that each is
+// checked with its own top-level and ignore files. Paths outside of git are
+// grouped by directory, whose ignore files apply instead.
+func newScans(paths []string, opts checker.Options) []*scan {
+	var scans []*scan
+	byRoot := make(map[string]*scan)
+	for _, path := range paths {
+		repo, err := checker.FindRepository(path)
+		if err != nil && !errors.Is(err, checker.ErrNotRepository) {
+			log.Warnf("Failed to find the repository of %s: %v", path, err)
+		}
+		root := repo.TopLevel
+		if root == "" {
+			root = treeRoot(path)
+		}
+		s, ok := byRoot[root]
+		if !ok {
+			s = newScan(repo, root, opts)
+			byRoot[root] = s
+			scans = append(scans, s)
+		}
+		s.paths = append(s.paths, path)
+	}
+	return scans
+}
+
+// newScan returns a scan of a tree rooted at root, which is the top-level of
+// repo inside of git
+func newScan(repo checker.Repository, root string, opts checker.Options) *scan {
+	log.WithFields(log.Fields{
+		"root":     root,
+		"topLevel": repo.TopLevel,
+		"gitDir":   repo.GitDir,
+	}).Debug("Scanning")
+	opts.TopLevel = repo.TopLevel
+	if !noIgnore {
+		opts.Ignore = checker.NewIgnoreMatcher(root, repo.GitDir, useGitignore)
+	}
+	return &scan{repo: repo, checker: checker.New(opts)}
+}
+
+// treeRoot returns the directory a path outside of git is scanned from
+func treeRoot(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if info, err := os.Stat(absPath); err == nil && info.IsDir() {
+		return absPath
+	}
+	return filepath.Dir(absPath)
+}
+
+// mergeChanges forwards the changes of every channel to one
+func mergeChanges(ctx context.Context, channels []<-chan checker.Change) <-chan checker.Change {
+	merged := make(chan checker.Change)
+	var wg sync.WaitGroup
+	for _, changes := range channels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for change := range changes {
+				select {
+				case merged <- change:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged
+}
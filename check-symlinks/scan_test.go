@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmelahman/check-symlinks/checker"
+)
+
+func TestNewScans(t *testing.T) {
+	for _, name := range []string{"GIT_DIR", "GIT_WORK_TREE"} {
+		t.Setenv(name, "")
+		must(os.Unsetenv(name))
+	}
+	root := t.TempDir()
+	for _, dir := range []string{"repo", "repo/sub", "first", "second"} {
+		must(os.MkdirAll(filepath.Join(root, dir), 0o755))
+	}
+	if output, err := exec.Command("git", "init", "--quiet", filepath.Join(root, "repo")).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, output)
+	}
+	must(os.WriteFile(filepath.Join(root, "first", ".symlinkignore"), []byte("ignored\n"), 0o644))
+	must(os.WriteFile(filepath.Join(root, "second", "file"), nil, 0o644))
+
+	paths := []string{
+		filepath.Join(root, "repo"),
+		filepath.Join(root, "first"),
+		filepath.Join(root, "repo", "sub"),
+		filepath.Join(root, "second", "file"),
+	}
+	scans := newScans(paths, checker.Options{})
+	if len(scans) != 3 {
+		t.Fatalf("expected a scan per root, got %d", len(scans))
+	}
+
+	repo := scans[0]
+	if repo.repo.TopLevel != filepath.Join(root, "repo") || len(repo.paths) != 2 {
+		t.Errorf("expected both repository paths in one scan, got %+v", repo)
+	}
+	if repo.checker.TopLevel != repo.repo.TopLevel {
+		t.Errorf("expected the scan to check against its own repository, got %q", repo.checker.TopLevel)
+	}
+
+	first := scans[1]
+	if first.repo.TopLevel != "" || first.checker.TopLevel != "" {
+		t.Errorf("expected no repository outside of git, got %+v", first.repo)
+	}
+	if !first.checker.Ignore.Match(filepath.Join(root, "first", "ignored"), false) {
+		t.Error("expected the tree's own .symlinkignore to apply")
+	}
+	if scans[2].checker.Ignore.Match(filepath.Join(root, "second", "ignored"), false) {
+		t.Error("expected each tree to use its own ignore files")
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/subtree"
+)
+
+// AddOptions holds options for the add command
+type AddOptions struct {
+	Branch  string
+	Message string
+	Squash  bool
+	Debug   bool
+}
+
+// NewAddCommand creates a new add command
+func NewAddCommand() *cobra.Command {
+	opts := &AddOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "add <name> <repository> <prefix>",
+		Short: "Add a subtree and save its configuration",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Debug {
+				log.SetLevel(log.DebugLevel)
+			}
+			return runAdd(cmd, opts, config.SubtreeConfig{
+				Name:       args[0],
+				Repository: args[1],
+				Prefix:     args[2],
+				Branch:     opts.Branch,
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Branch, "branch", "b", "", "upstream branch (defaults to the repository's default branch)")
+	cmd.Flags().StringVarP(&opts.Message, "message", "m", "", "message for the merge commit")
+	cmd.Flags().BoolVar(&opts.Squash, "squash", false, "merge the upstream history as a single commit (defaults to orchard.squash)")
+	cmd.Flags().BoolVar(&opts.Debug, "debug", false, "run in debug mode")
+
+	return cmd
+}
+
+func runAdd(cmd *cobra.Command, opts *AddOptions, subtreeConfig config.SubtreeConfig) error {
+	root, err := repoRoot()
+	if err != nil {
+		return err
+	}
+
+	reader := config.NewGitConfigReader(root)
+	subtrees, orchardConfig, err := reader.ReadSubtreeConfigs()
+	if err != nil {
+		return fmt.Errorf("failed to read subtree configs: %w", err)
+	}
+	if existing, ok := config.Find(subtrees, subtreeConfig.Name); ok {
+		return fmt.Errorf("subtree %s is already configured at %s", existing.Name, existing.Prefix)
+	}
+	if existing, ok := config.Find(subtrees, subtreeConfig.Prefix); ok {
+		return fmt.Errorf("prefix %s is already used by subtree %s", subtreeConfig.Prefix, existing.Name)
+	}
+
+	git := subtree.NewGit(root)
+	err = git.Add(subtreeConfig, subtree.Options{
+		Squash:  squashEnabled(cmd, opts.Squash, orchardConfig.Squash),
+		Message: opts.Message,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := config.NewGitConfigWriter(root).WriteSubtreeConfig(subtreeConfig); err != nil {
+		return fmt.Errorf("added %s but failed to save its configuration: %w", subtreeConfig.Prefix, err)
+	}
+	fmt.Printf("Added subtree %s at %s\n", subtreeConfig.Name, subtreeConfig.Prefix)
+	return nil
+}
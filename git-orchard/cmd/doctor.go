@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jmelahman/git-orchard/config"
+)
+
+// DoctorOptions holds options for the doctor command
+type DoctorOptions struct {
+	Debug bool
+}
+
+// NewDoctorCommand creates a new doctor command
+func NewDoctorCommand() *cobra.Command {
+	opts := &DoctorOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the subtree configuration for problems",
+		Long: `Check the subtree configuration for problems.
+
+The ` + config.ManifestFile + ` manifest and the overrides in .git/config are
+checked for invalid and unknown settings, and the subtrees they configure
+for missing settings and prefixes that overlap or don't exist. Fails if any
+errors are found.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Debug {
+				log.SetLevel(log.DebugLevel)
+			}
+			return runDoctor()
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.Debug, "debug", false, "run in debug mode")
+
+	return cmd
+}
+
+func runDoctor() error {
+	root, err := repoRoot()
+	if err != nil {
+		return err
+	}
+
+	problems, err := config.NewGitConfigReader(root).Diagnose()
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		fmt.Println("No problems found.")
+		return nil
+	}
+
+	errors := 0
+	for _, problem := range problems {
+		fmt.Println(problem)
+		if problem.Severity == config.SeverityError {
+			errors++
+		}
+	}
+	if errors > 0 {
+		return fmt.Errorf("found %d error(s)", errors)
+	}
+	return nil
+}
@@ -1,57 +1,167 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/jmelahman/git-orchard/config"
 	"github.com/jmelahman/git-orchard/history"
 )
 
-// InitOptions holds options for the list command
+// InitOptions holds options for the init command
 type InitOptions struct {
-	Debug bool
+	Manifest bool
+	DryRun   bool
+	Yes      bool
+	Debug    bool
 }
 
-// NewInitCommand creates a new list command
+// NewInitCommand creates a new init command
 func NewInitCommand() *cobra.Command {
 	opts := &InitOptions{}
 
 	cmd := &cobra.Command{
 		Use:   "init",
 		Short: "Set up git-orchard in the current worktree",
-		Run: func(cmd *cobra.Command, args []string) {
+		Long: `Set up git-orchard in the current worktree.
+
+Subtrees added with git subtree are found in the history and configured,
+skipping those that already are. The repository of each is taken from a
+remote or a README link to a repository of the same name, or asked for.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if opts.Debug {
 				log.SetLevel(log.DebugLevel)
 			}
-			initConfigFromHistory()
+			return initConfigFromHistory(opts, os.Stdin, os.Stdout)
 		},
 	}
 
+	cmd.Flags().BoolVar(&opts.Manifest, "manifest", false, "write to the committed "+config.ManifestFile+" instead of .git/config")
+	cmd.Flags().BoolVarP(&opts.DryRun, "dry-run", "n", false, "print the configuration without writing it")
+	cmd.Flags().BoolVarP(&opts.Yes, "yes", "y", false, "write without asking for confirmation")
 	cmd.Flags().BoolVar(&opts.Debug, "debug", false, "run in debug mode")
 
 	return cmd
 }
 
-func initConfigFromHistory() {
-	reader := history.NewGitHistoryReader()
-	subtreeMap, err := reader.GetSubtreesFromHistory()
+func initConfigFromHistory(opts *InitOptions, in io.Reader, out io.Writer) error {
+	root, err := repoRoot()
 	if err != nil {
-		log.Errorf("Failed to execute git log: %v", err)
-		return
+		return err
 	}
 
-	if len(subtreeMap) == 0 {
-		fmt.Println("No subtree merges found in git history.")
-		return
+	reader := config.NewGitConfigReader(root)
+	subtrees, _, err := reader.ReadSubtreeConfigs()
+	if err != nil {
+		return fmt.Errorf("failed to read subtree configs: %w", err)
 	}
 
-	fmt.Printf("Found %d subtree(s) from git history:\n\n", len(subtreeMap))
-	for _, info := range subtreeMap {
-		fmt.Printf("Prefix: %s\n", info.Prefix)
-		fmt.Printf("  Last commit: %s\n", info.LastCommit)
-		fmt.Printf("  Last message: %s\n", info.LastMessage)
-		fmt.Println()
+	historyReader := history.NewGitHistoryReader(root)
+	subtreeMap, err := historyReader.GetSubtreesFromHistory()
+	if err != nil {
+		return fmt.Errorf("failed to execute git log: %w", err)
+	}
+
+	var prefixes []string
+	for prefix := range subtreeMap {
+		if prefix = strings.Trim(prefix, "/"); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		fmt.Fprintln(out, "No subtree merges found in git history.")
+		return nil
+	}
+	sort.Strings(prefixes)
+
+	input := bufio.NewReader(in)
+	interactive := !opts.DryRun && isTerminal(in)
+	var planned []config.SubtreeConfig
+	for _, prefix := range prefixes {
+		if existing, ok := config.Find(subtrees, prefix); ok {
+			fmt.Fprintf(out, "Skipping %s: already configured as %s\n", prefix, existing.Name)
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(root, prefix)); err != nil || !info.IsDir() {
+			fmt.Fprintf(out, "Skipping %s: no longer in the worktree\n", prefix)
+			continue
+		}
+
+		subtree := config.SubtreeConfig{Name: path.Base(prefix), Prefix: prefix}
+		if _, taken := config.Find(append(subtrees, planned...), subtree.Name); taken {
+			subtree.Name = strings.ReplaceAll(prefix, "/", "-")
+		}
+
+		repository, source := config.InferRepository(root, prefix)
+		if repository != "" {
+			log.Debugf("Found the repository of %s in %s", prefix, source)
+		} else if interactive {
+			repository = prompt(input, out, fmt.Sprintf("Repository for %s (leave empty to skip): ", prefix))
+		}
+		if repository == "" {
+			fmt.Fprintf(out, "Skipping %s: repository unknown\n", prefix)
+			continue
+		}
+		subtree.Repository = repository
+		planned = append(planned, subtree)
+	}
+
+	if len(planned) == 0 {
+		fmt.Fprintln(out, "Nothing to configure.")
+		return nil
+	}
+
+	writer := config.NewGitConfigWriter(root)
+	if opts.Manifest {
+		writer = config.NewManifestWriter(root)
+	}
+
+	fmt.Fprintln(out)
+	for _, subtree := range planned {
+		fmt.Fprintf(out, "[subtree %q]\n", subtree.Name)
+		fmt.Fprintf(out, "\trepository = %s\n", subtree.Repository)
+		fmt.Fprintf(out, "\tprefix = %s\n", subtree.Prefix)
+	}
+	fmt.Fprintln(out)
+
+	if opts.DryRun {
+		fmt.Fprintf(out, "Would write %d subtree(s) to %s\n", len(planned), writer.Target())
+		return nil
+	}
+	if !opts.Yes {
+		answer := prompt(input, out, fmt.Sprintf("Write %d subtree(s) to %s? (y/N): ", len(planned), writer.Target()))
+		if answer = strings.ToLower(answer); answer != "y" && answer != "yes" {
+			fmt.Fprintln(out, "Nothing written.")
+			return nil
+		}
+	}
+
+	for _, subtree := range planned {
+		if err := writer.WriteSubtreeConfig(subtree); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "Wrote %d subtree(s) to %s\n", len(planned), writer.Target())
+	return nil
+}
+
+// prompt prints a question and reads the line answering it from input. If
+// input ends before the line does, the output continues on a new line.
+func prompt(input *bufio.Reader, out io.Writer, question string) string {
+	fmt.Fprint(out, question)
+	answer, err := input.ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(out)
 	}
+	return strings.TrimSpace(answer)
 }
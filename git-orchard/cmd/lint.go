@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/history"
+	"github.com/jmelahman/git-orchard/subtree"
+)
+
+// LintOptions holds options for the lint command
+type LintOptions struct {
+	JSON    bool
+	NoFetch bool
+	PrePush bool
+	Debug   bool
+}
+
+// NewLintCommand creates a new lint command
+func NewLintCommand() *cobra.Command {
+	opts := &LintOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "lint [revision...]",
+		Short: "Check commits and upstreams for problems with subtrees",
+		Long: `Check commits and upstreams for problems with subtrees.
+
+Commits are checked for changes to several subtrees at once, which end up in
+the split history of each, and for changes to subtrees in the history that
+aren't configured. The revisions default to HEAD's commits that aren't on a
+remote-tracking branch. The upstream of each subtree is fetched and checked
+to still contain the upstream commit last merged, which it doesn't after a
+force-push. An upstream that can't be fetched is a warning.
+
+With --pre-push, the revisions are read from the standard input of a
+pre-push hook and the arguments are the hook's remote and URL:
+
+  git orchard lint --pre-push "$@"
+
+Fails if any errors are found.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Debug {
+				log.SetLevel(log.DebugLevel)
+			}
+			return runLint(opts, args, os.Stdin)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.JSON, "json", false, "print the findings as JSON")
+	cmd.Flags().BoolVar(&opts.NoFetch, "no-fetch", false, "use the upstream branches from the last fetch")
+	cmd.Flags().BoolVar(&opts.PrePush, "pre-push", false, "lint the refs being pushed, as a pre-push hook")
+	cmd.Flags().BoolVar(&opts.Debug, "debug", false, "run in debug mode")
+
+	return cmd
+}
+
+func runLint(opts *LintOptions, args []string, stdin io.Reader) error {
+	root, err := repoRoot()
+	if err != nil {
+		return err
+	}
+
+	reader := config.NewGitConfigReader(root)
+	subtrees, _, err := reader.ReadSubtreeConfigs()
+	if err != nil {
+		return fmt.Errorf("failed to read subtree configs: %w", err)
+	}
+
+	revs := []string{"HEAD", "--not", "--remotes"}
+	tips := []string{"HEAD"}
+	if opts.PrePush {
+		if len(args) > 2 {
+			return fmt.Errorf("--pre-push takes the remote and URL of the hook")
+		}
+		remote := ""
+		if len(args) > 0 {
+			remote = args[0]
+		}
+		if revs, tips, err = prePushRevisions(stdin, remote); err != nil {
+			return err
+		}
+	} else if len(args) > 0 {
+		revs = args
+	}
+	if len(tips) == 0 {
+		log.Debug("Nothing to lint")
+		return nil
+	}
+
+	git := subtree.NewGit(root)
+	historyReader := history.NewGitHistoryReader(root)
+	findings, err := git.Lint(subtrees, historyReader, revs...)
+	if err != nil {
+		return err
+	}
+
+	for _, subtreeConfig := range subtrees {
+		if !opts.NoFetch {
+			log.Debugf("Fetching %s", subtreeConfig.Repository)
+			// An unreachable upstream shouldn't hide the other findings
+			if _, err := git.Fetch(subtreeConfig); err != nil {
+				findings = append(findings, subtree.Finding{
+					Check:    subtree.CheckUnfetched,
+					Severity: config.SeverityWarning,
+					Prefixes: []string{strings.Trim(subtreeConfig.Prefix, "/")},
+					Message:  err.Error(),
+				})
+				continue
+			}
+		}
+		for _, tip := range tips {
+			finding, err := git.Diverged(subtreeConfig, historyReader, tip)
+			if err != nil {
+				return err
+			}
+			if finding != nil {
+				findings = append(findings, *finding)
+				break
+			}
+		}
+	}
+
+	if opts.JSON {
+		if findings == nil {
+			findings = []subtree.Finding{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(findings); err != nil {
+			return err
+		}
+	} else if len(findings) == 0 {
+		fmt.Println("No problems found.")
+	}
+
+	errors := 0
+	for _, finding := range findings {
+		if !opts.JSON {
+			fmt.Println(finding)
+		}
+		if finding.Severity == config.SeverityError {
+			errors++
+		}
+	}
+	if errors > 0 {
+		return fmt.Errorf("found %d error(s)", errors)
+	}
+	return nil
+}
+
+// prePushRevisions reads the refs being pushed from the standard input of a
+// pre-push hook, "<local ref> <local commit> <remote ref> <remote commit>"
+// on each line, and returns the revisions of the commits the remote doesn't
+// have and the commits being pushed
+func prePushRevisions(stdin io.Reader, remote string) (revs, tips []string, err error) {
+	var excludes []string
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+		local, remoteCommit := fields[1], fields[3]
+		// Commits of zeros are refs that don't exist
+		if strings.Trim(local, "0") == "" {
+			continue
+		}
+		tips = append(tips, local)
+		if strings.Trim(remoteCommit, "0") != "" {
+			excludes = append(excludes, remoteCommit)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	revs = append(append([]string{}, tips...), "--not")
+	if remote != "" {
+		revs = append(revs, "--remotes="+remote)
+	}
+	// The remote commits may not have been fetched
+	for _, commit := range excludes {
+		if exec.Command("git", "rev-parse", "--verify", "--quiet", commit+"^{commit}").Run() == nil {
+			revs = append(revs, commit)
+		}
+	}
+	return revs, tips, nil
+}
@@ -3,8 +3,8 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/spf13/cobra"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
 
 	"github.com/jmelahman/git-orchard/config"
 	"github.com/jmelahman/git-orchard/history"
@@ -66,12 +66,18 @@ func listSubtreesFromConfig() {
 		if subtree.Branch != "" {
 			fmt.Printf("  Branch: %s\n", subtree.Branch)
 		}
+		if subtree.Squash {
+			fmt.Println("  Squash: true")
+		}
+		if !subtree.Push {
+			fmt.Println("  Push: disabled")
+		}
 		fmt.Println()
 	}
 }
 
 func listSubtreesFromHistory() {
-	reader := history.NewGitHistoryReader()
+	reader := history.NewGitHistoryReader("")
 	subtreeMap, err := reader.GetSubtreesFromHistory()
 	if err != nil {
 		log.Errorf("Failed to execute git log: %v", err)
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/subtree"
+)
+
+// step is part of an operation on a subtree
+type step struct {
+	// state is shown while the step runs
+	state string
+	run   func(git *subtree.Git, subtreeConfig config.SubtreeConfig) error
+}
+
+// operation runs on several subtrees. The parallel step runs for up to jobs
+// subtrees at once. The serial step, which may change the worktree, runs
+// for one subtree at a time in order, once its parallel step is done.
+type operation struct {
+	parallel step
+	serial   *step
+	// done is the state of a subtree that succeeded
+	done string
+}
+
+// outcome is the result of an operation on a subtree
+type outcome struct {
+	subtree config.SubtreeConfig
+	// output is what git printed
+	output bytes.Buffer
+	err    error
+}
+
+// runOperation runs op on every subtree and returns their outcomes. A
+// failure doesn't stop the other subtrees, although once a serial step
+// leaves the worktree unclean, such as with a merge conflict, the later
+// ones are skipped.
+func runOperation(root string, subtrees []config.SubtreeConfig, jobs int, op operation, out io.Writer) []*outcome {
+	names := make([]string, len(subtrees))
+	for i, subtreeConfig := range subtrees {
+		names[i] = subtreeConfig.Name
+	}
+	p := newProgress(out, names)
+
+	outcomes := make([]*outcome, len(subtrees))
+	done := make([]chan struct{}, len(subtrees))
+	slots := make(chan struct{}, max(jobs, 1))
+	for i, subtreeConfig := range subtrees {
+		outcomes[i] = &outcome{subtree: subtreeConfig}
+		done[i] = make(chan struct{})
+		go func(o *outcome, done chan struct{}) {
+			defer close(done)
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			p.Set(o.subtree.Name, op.parallel.state)
+			o.err = op.parallel.run(gitFor(root, o), o.subtree)
+		}(outcomes[i], done[i])
+	}
+
+	var blocked string
+	for i, o := range outcomes {
+		<-done[i]
+		if o.err == nil && op.serial != nil {
+			if blocked != "" {
+				o.err = fmt.Errorf("skipped after %s failed", blocked)
+			} else {
+				p.Set(o.subtree.Name, op.serial.state)
+				if o.err = op.serial.run(gitFor(root, o), o.subtree); o.err != nil && !worktreeClean(root) {
+					blocked = o.subtree.Name
+				}
+			}
+		}
+		if o.err != nil {
+			p.Set(o.subtree.Name, "failed")
+		} else {
+			p.Set(o.subtree.Name, op.done)
+		}
+	}
+	return outcomes
+}
+
+// worktreeClean reports whether the worktree at root has no changes to
+// tracked files
+func worktreeClean(root string) bool {
+	cmd := exec.Command("git", "status", "--porcelain", "--untracked-files=no")
+	cmd.Dir = root
+	output, err := cmd.Output()
+	return err == nil && len(bytes.TrimSpace(output)) == 0
+}
+
+// gitFor returns a Git that collects the output for an outcome
+func gitFor(root string, o *outcome) *subtree.Git {
+	git := subtree.NewGit(root)
+	git.SetOutput(&o.output, &o.output)
+	return git
+}
+
+// summarize prints the failures among outcomes with what git printed, and
+// returns an error if there were any
+func summarize(action string, outcomes []*outcome, out io.Writer) error {
+	failed := 0
+	for _, o := range outcomes {
+		if o.err == nil {
+			continue
+		}
+		failed++
+		fmt.Fprintf(out, "\nFailed to %s %s: %v\n", action, o.subtree.Name, o.err)
+		if output := strings.TrimSpace(o.output.String()); output != "" {
+			fmt.Fprintf(out, "  %s\n", strings.ReplaceAll(output, "\n", "\n  "))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to %s %d of %d subtree(s)", action, failed, len(outcomes))
+	}
+	return nil
+}
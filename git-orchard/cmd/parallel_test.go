@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/subtree"
+)
+
+func TestRunOperation(t *testing.T) {
+	for _, name := range []string{"GIT_DIR", "GIT_WORK_TREE"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	root := t.TempDir()
+	if output, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, output)
+	}
+
+	var subtrees []config.SubtreeConfig
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		subtrees = append(subtrees, config.SubtreeConfig{Name: name, Prefix: name})
+	}
+
+	var running, peak atomic.Int32
+	var mu sync.Mutex
+	var serialOrder []string
+	var serialRunning atomic.Int32
+	op := operation{
+		parallel: step{
+			state: "fetching",
+			run: func(git *subtree.Git, s config.SubtreeConfig) error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				if s.Name == "b" {
+					return errors.New("unreachable")
+				}
+				return nil
+			},
+		},
+		serial: &step{
+			state: "merging",
+			run: func(git *subtree.Git, s config.SubtreeConfig) error {
+				if serialRunning.Add(1) != 1 {
+					t.Error("Serial steps overlapped")
+				}
+				defer serialRunning.Add(-1)
+				mu.Lock()
+				serialOrder = append(serialOrder, s.Name)
+				mu.Unlock()
+				if s.Name == "d" {
+					return errors.New("conflict")
+				}
+				return nil
+			},
+		},
+		done: "pulled",
+	}
+
+	outcomes := runOperation(root, subtrees, 2, op, io.Discard)
+
+	if peak.Load() != 2 {
+		t.Errorf("Expected 2 parallel steps at once, got %d", peak.Load())
+	}
+	if order := strings.Join(serialOrder, ","); order != "a,c,d,e" {
+		t.Errorf("Expected serial steps in order for the subtrees that fetched, got %s", order)
+	}
+	var failed []string
+	for _, o := range outcomes {
+		if o.err != nil {
+			failed = append(failed, o.subtree.Name)
+		}
+	}
+	// The worktree is still clean after d fails, so e isn't skipped
+	if strings.Join(failed, ",") != "b,d" {
+		t.Errorf("Expected b and d to fail, got %v", failed)
+	}
+
+	var summary strings.Builder
+	err := summarize("pull", outcomes, &summary)
+	if err == nil || err.Error() != "failed to pull 2 of 5 subtree(s)" {
+		t.Errorf("Unexpected summary error: %v", err)
+	}
+	if !strings.Contains(summary.String(), "Failed to pull b: unreachable") {
+		t.Errorf("Expected b's failure in the summary, got:\n%s", summary.String())
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// progress shows the state of each subtree of an operation. On a terminal
+// the states are redrawn in place, otherwise each change is printed.
+type progress struct {
+	mu       sync.Mutex
+	out      io.Writer
+	terminal bool
+	names    []string
+	states   map[string]string
+	width    int
+	drawn    bool
+}
+
+func newProgress(out io.Writer, names []string) *progress {
+	p := &progress{
+		out:      out,
+		terminal: isTerminal(out),
+		names:    names,
+		states:   make(map[string]string),
+	}
+	for _, name := range names {
+		p.width = max(p.width, len(name))
+		p.states[name] = "waiting"
+	}
+	return p
+}
+
+// Set changes the state of a subtree
+func (p *progress) Set(name, state string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.states[name] = state
+	if !p.terminal {
+		fmt.Fprintf(p.out, "%-*s  %s\n", p.width, name, state)
+		return
+	}
+	p.draw()
+}
+
+// draw redraws every state over the last drawing
+func (p *progress) draw() {
+	if p.drawn {
+		fmt.Fprintf(p.out, "\x1b[%dA", len(p.names))
+	}
+	for _, name := range p.names {
+		fmt.Fprintf(p.out, "\x1b[2K%-*s  %s\n", p.width, name, p.states[name])
+	}
+	p.drawn = true
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f any) bool {
+	file, ok := f.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
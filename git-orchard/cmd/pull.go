@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/subtree"
+)
+
+// PullOptions holds options for the pull command
+type PullOptions struct {
+	All     bool
+	Jobs    int
+	Message string
+	Squash  bool
+	Debug   bool
+}
+
+// NewPullCommand creates a new pull command
+func NewPullCommand() *cobra.Command {
+	opts := &PullOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "pull [name|prefix...] [--all]",
+		Short: "Merge upstream changes into subtrees",
+		Long: `Merge upstream changes into subtrees.
+
+Upstream branches are fetched in parallel with --jobs, then merged one at a
+time. A failure doesn't stop the other subtrees, unless a merge conflict
+leaves the worktree unclean.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Debug {
+				log.SetLevel(log.DebugLevel)
+			}
+			return runPull(cmd, opts, args)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.All, "all", "a", false, "pull every configured subtree")
+	cmd.Flags().IntVarP(&opts.Jobs, "jobs", "j", 1, "number of upstreams to fetch at once")
+	cmd.Flags().StringVarP(&opts.Message, "message", "m", "", "message for the merge commit (defaults to \"Update <prefix>\")")
+	cmd.Flags().BoolVar(&opts.Squash, "squash", false, "merge the upstream history as a single commit (defaults to the squash setting)")
+	cmd.Flags().BoolVar(&opts.Debug, "debug", false, "run in debug mode")
+
+	return cmd
+}
+
+func runPull(cmd *cobra.Command, opts *PullOptions, args []string) error {
+	root, err := repoRoot()
+	if err != nil {
+		return err
+	}
+
+	reader := config.NewGitConfigReader(root)
+	subtrees, _, err := reader.ReadSubtreeConfigs()
+	if err != nil {
+		return fmt.Errorf("failed to read subtree configs: %w", err)
+	}
+	selected, err := selectSubtrees(subtrees, args, opts.All)
+	if err != nil {
+		return err
+	}
+
+	op := operation{
+		parallel: step{
+			state: "fetching",
+			run: func(git *subtree.Git, subtreeConfig config.SubtreeConfig) error {
+				_, err := git.Fetch(subtreeConfig)
+				return err
+			},
+		},
+		serial: &step{
+			state: "merging",
+			run: func(git *subtree.Git, subtreeConfig config.SubtreeConfig) error {
+				return git.Merge(subtreeConfig, subtree.UpstreamRef(subtreeConfig), subtree.Options{
+					Squash:  squashEnabled(cmd, opts.Squash, subtreeConfig.Squash),
+					Message: opts.Message,
+				})
+			},
+		},
+		done: "pulled",
+	}
+	outcomes := runOperation(root, selected, opts.Jobs, op, os.Stdout)
+	return summarize("pull", outcomes, os.Stdout)
+}
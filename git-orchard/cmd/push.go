@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/subtree"
+)
+
+// PushOptions holds options for the push command
+type PushOptions struct {
+	All   bool
+	Jobs  int
+	Debug bool
+}
+
+// NewPushCommand creates a new push command
+func NewPushCommand() *cobra.Command {
+	opts := &PushOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "push [name|prefix...] [--all]",
+		Short: "Push the history of subtrees to their upstreams",
+		Long: `Push the history of subtrees to their upstreams.
+
+Subtrees are split and pushed in parallel with --jobs. A failure doesn't
+stop the other subtrees.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Debug {
+				log.SetLevel(log.DebugLevel)
+			}
+			return runPush(opts, args)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.All, "all", "a", false, "push every configured subtree")
+	cmd.Flags().IntVarP(&opts.Jobs, "jobs", "j", 1, "number of subtrees to push at once")
+	cmd.Flags().BoolVar(&opts.Debug, "debug", false, "run in debug mode")
+
+	return cmd
+}
+
+func runPush(opts *PushOptions, args []string) error {
+	root, err := repoRoot()
+	if err != nil {
+		return err
+	}
+
+	reader := config.NewGitConfigReader(root)
+	subtrees, _, err := reader.ReadSubtreeConfigs()
+	if err != nil {
+		return fmt.Errorf("failed to read subtree configs: %w", err)
+	}
+	selected, err := selectSubtrees(subtrees, args, opts.All)
+	if err != nil {
+		return err
+	}
+
+	var pushable []config.SubtreeConfig
+	disabled := 0
+	for _, subtreeConfig := range selected {
+		if subtreeConfig.Push {
+			pushable = append(pushable, subtreeConfig)
+			continue
+		}
+		if !opts.All {
+			log.Errorf("Pushing %s is disabled by its push setting", subtreeConfig.Name)
+			disabled++
+		} else {
+			fmt.Printf("Skipping %s: pushing is disabled\n", subtreeConfig.Name)
+		}
+	}
+
+	op := operation{
+		parallel: step{
+			state: "pushing",
+			run: func(git *subtree.Git, subtreeConfig config.SubtreeConfig) error {
+				return git.Push(subtreeConfig)
+			},
+		},
+		done: "pushed",
+	}
+	outcomes := runOperation(root, pushable, opts.Jobs, op, os.Stdout)
+	if err := summarize("push", outcomes, os.Stdout); err != nil {
+		return err
+	}
+	if disabled > 0 {
+		return fmt.Errorf("pushing %d subtree(s) is disabled", disabled)
+	}
+	return nil
+}
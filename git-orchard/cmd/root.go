@@ -30,6 +30,9 @@ func NewRootCommand() *cobra.Command {
 			runRoot(opts, args)
 		},
 		Version: fmt.Sprintf("%s\ncommit %s", Version, Commit),
+		// Errors are printed by main
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
 
 	cmd.Flags().BoolVar(&opts.Debug, "debug", false, "run in debug mode")
@@ -37,6 +40,13 @@ func NewRootCommand() *cobra.Command {
 	// Add subcommands
 	cmd.AddCommand(NewInitCommand())
 	cmd.AddCommand(NewListCommand())
+	cmd.AddCommand(NewAddCommand())
+	cmd.AddCommand(NewPullCommand())
+	cmd.AddCommand(NewPushCommand())
+	cmd.AddCommand(NewSplitCommand())
+	cmd.AddCommand(NewStatusCommand())
+	cmd.AddCommand(NewDoctorCommand())
+	cmd.AddCommand(NewLintCommand())
 
 	return cmd
 }
@@ -60,6 +70,9 @@ func runRoot(opts *RootOptions, args []string) {
 		if subtree.Branch != "" {
 			log.Debugf("  Branch: %s", subtree.Branch)
 		}
+		for key, source := range subtree.Sources {
+			log.Debugf("  %s from %s", key, source)
+		}
 	}
 
 	if orchardConfig.Squash {
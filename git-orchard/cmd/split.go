@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/subtree"
+)
+
+// SplitOptions holds options for the split command
+type SplitOptions struct {
+	Branch string
+	Rejoin bool
+	Squash bool
+	Debug  bool
+}
+
+// NewSplitCommand creates a new split command
+func NewSplitCommand() *cobra.Command {
+	opts := &SplitOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "split <name|prefix>",
+		Short: "Extract the history of a subtree and print its commit",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Debug {
+				log.SetLevel(log.DebugLevel)
+			}
+			return runSplit(cmd, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Branch, "branch", "b", "", "create or update a branch with the split history")
+	cmd.Flags().BoolVar(&opts.Rejoin, "rejoin", false, "merge the split history back into the current branch")
+	cmd.Flags().BoolVar(&opts.Squash, "squash", false, "squash the history merged by --rejoin (defaults to the squash setting)")
+	cmd.Flags().BoolVar(&opts.Debug, "debug", false, "run in debug mode")
+
+	return cmd
+}
+
+func runSplit(cmd *cobra.Command, opts *SplitOptions, name string) error {
+	root, err := repoRoot()
+	if err != nil {
+		return err
+	}
+
+	reader := config.NewGitConfigReader(root)
+	subtrees, _, err := reader.ReadSubtreeConfigs()
+	if err != nil {
+		return fmt.Errorf("failed to read subtree configs: %w", err)
+	}
+	selected, err := selectSubtrees(subtrees, []string{name}, false)
+	if err != nil {
+		return err
+	}
+
+	git := subtree.NewGit(root)
+	commit, err := git.Split(selected[0], subtree.SplitOptions{
+		Branch: opts.Branch,
+		Rejoin: opts.Rejoin,
+		Squash: squashEnabled(cmd, opts.Squash, selected[0].Squash),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(commit)
+	return nil
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/history"
+	"github.com/jmelahman/git-orchard/subtree"
+)
+
+// StatusOptions holds options for the status command
+type StatusOptions struct {
+	JSON    bool
+	NoFetch bool
+	Debug   bool
+}
+
+// statusResult is the status of a subtree, or why it couldn't be found
+type statusResult struct {
+	subtree.Status
+	Error string `json:"error,omitempty"`
+}
+
+// NewStatusCommand creates a new status command
+func NewStatusCommand() *cobra.Command {
+	opts := &StatusOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "status [branch]",
+		Short: "Show how many commits each subtree is behind or ahead of its upstream",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Debug {
+				log.SetLevel(log.DebugLevel)
+			}
+			ref := "HEAD"
+			if len(args) > 0 {
+				ref = args[0]
+			}
+			return runStatus(opts, ref)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.JSON, "json", false, "print the status as JSON")
+	cmd.Flags().BoolVar(&opts.NoFetch, "no-fetch", false, "use the upstream branches from the last fetch")
+	cmd.Flags().BoolVar(&opts.Debug, "debug", false, "run in debug mode")
+
+	return cmd
+}
+
+func runStatus(opts *StatusOptions, ref string) error {
+	root, err := repoRoot()
+	if err != nil {
+		return err
+	}
+
+	reader := config.NewGitConfigReader(root)
+	subtrees, _, err := reader.ReadSubtreeConfigs()
+	if err != nil {
+		return fmt.Errorf("failed to read subtree configs: %w", err)
+	}
+
+	git := subtree.NewGit(root)
+	historyReader := history.NewGitHistoryReader(root)
+	results := make([]statusResult, 0, len(subtrees))
+	failed := 0
+	for _, subtreeConfig := range subtrees {
+		var status subtree.Status
+		var err error
+		if !opts.NoFetch {
+			log.Debugf("Fetching %s", subtreeConfig.Repository)
+			_, err = git.Fetch(subtreeConfig)
+		}
+		if err == nil {
+			status, err = git.Status(subtreeConfig, historyReader, ref)
+		}
+		result := statusResult{Status: status}
+		if err != nil {
+			result.Name = subtreeConfig.Name
+			result.Prefix = subtreeConfig.Prefix
+			result.Repository = subtreeConfig.Repository
+			result.Branch = subtreeConfig.Branch
+			result.Error = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if opts.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			return err
+		}
+	} else {
+		printStatus(results)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to get the status of %d of %d subtree(s)", failed, len(results))
+	}
+	return nil
+}
+
+func printStatus(results []statusResult) {
+	if len(results) == 0 {
+		fmt.Println("No subtrees configured.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPREFIX\tBRANCH\tBEHIND\tAHEAD")
+	for _, result := range results {
+		branch := result.Branch
+		if branch == "" {
+			branch = "(default)"
+		}
+		if result.Error != "" {
+			fmt.Fprintf(w, "%s\t%s\t%s\t-\t-\t%s\n", result.Name, result.Prefix, branch, result.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", result.Name, result.Prefix, branch, result.Behind, result.Ahead)
+	}
+	w.Flush()
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jmelahman/git-orchard/config"
+)
+
+// repoRoot returns the top level of the current working tree, where git
+// subtree has to be run from
+func repoRoot() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", fmt.Errorf("not in a git repository")
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// selectSubtrees returns the subtrees named by args, by name or prefix, or
+// every subtree when all is set
+func selectSubtrees(subtrees []config.SubtreeConfig, args []string, all bool) ([]config.SubtreeConfig, error) {
+	if all {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("--all cannot be combined with subtree names")
+		}
+		if len(subtrees) == 0 {
+			return nil, fmt.Errorf("no subtrees configured")
+		}
+		return subtrees, nil
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("specify a subtree or --all")
+	}
+
+	var selected []config.SubtreeConfig
+	for _, arg := range args {
+		subtree, ok := config.Find(subtrees, arg)
+		if !ok {
+			return nil, fmt.Errorf("no subtree configured with name or prefix %q", arg)
+		}
+		selected = append(selected, subtree)
+	}
+	return selected, nil
+}
+
+// squashEnabled returns the --squash flag if it was given, falling back to
+// the configured default
+func squashEnabled(cmd *cobra.Command, squash bool, configured bool) bool {
+	if cmd.Flags().Changed("squash") {
+		return squash
+	}
+	return configured
+}
@@ -1,25 +1,57 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
 )
 
+// ManifestFile is the committed configuration at the root of the
+// repository, which uses the git config format
+const ManifestFile = ".gitorchard"
+
+// Source is where a setting was read from
+type Source string
+
+const (
+	// SourceDefault is a setting that wasn't configured
+	SourceDefault Source = "default"
+	// SourceManifest is a setting from the manifest
+	SourceManifest Source = ManifestFile
+	// SourceGitConfig is a setting from the repository's git config, which
+	// overrides the manifest
+	SourceGitConfig Source = ".git/config"
+)
+
+// subtreeKeys are the settings of a [subtree "name"] section
+var subtreeKeys = []string{"repository", "prefix", "branch", "squash", "push"}
+
 // SubtreeConfig represents a subtree configuration
 type SubtreeConfig struct {
 	Name       string
 	Repository string
 	Prefix     string
 	Branch     string
+	// Squash merges upstream history as a single commit. Defaults to
+	// orchard.squash.
+	Squash bool
+	// Push allows pushing to the repository. Defaults to true.
+	Push bool
+	// Sources maps each setting to where it was read from
+	Sources map[string]Source
 }
 
 // OrchardConfig represents git-orchard configuration
 type OrchardConfig struct {
 	Squash bool
+	// Sources maps each setting to where it was read from
+	Sources map[string]Source
 }
 
 // Reader interface for reading configurations (useful for testing)
@@ -27,7 +59,7 @@ type Reader interface {
 	ReadSubtreeConfigs() ([]SubtreeConfig, OrchardConfig, error)
 }
 
-// GitConfigReader reads configuration from git config
+// GitConfigReader reads configuration from the manifest and git config
 type GitConfigReader struct {
 	repoPath string
 }
@@ -69,61 +101,227 @@ func findGitRoot() (string, error) {
 	return "", fmt.Errorf("not in a git repository")
 }
 
-// ReadSubtreeConfigs reads subtree configurations from git config
+// layer is a configuration file, which overrides the layers before it
+type layer struct {
+	source Source
+	raw    *format.Config
+}
+
+// ReadSubtreeConfigs reads subtree configurations from the manifest and git
+// config. Settings in git config override those in the manifest. Subtrees
+// without a repository or prefix are left out.
 func (r *GitConfigReader) ReadSubtreeConfigs() ([]SubtreeConfig, OrchardConfig, error) {
+	layers, err := r.readLayers()
+	if err != nil {
+		return nil, OrchardConfig{}, err
+	}
+
+	all, orchardConfig := merge(layers)
+	var subtrees []SubtreeConfig
+	for _, subtree := range all {
+		if subtree.Repository != "" && subtree.Prefix != "" {
+			subtrees = append(subtrees, subtree)
+		}
+	}
+	return subtrees, orchardConfig, nil
+}
+
+// readLayers reads the manifest and git config, in order of precedence
+func (r *GitConfigReader) readLayers() ([]layer, error) {
+	manifest, err := readManifest(filepath.Join(r.repoPath, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
 	// Open the repository
 	repo, err := git.PlainOpen(r.repoPath)
 	if err != nil {
-		return nil, OrchardConfig{}, fmt.Errorf("failed to open repository: %w", err)
+		return nil, fmt.Errorf("failed to open repository: %w", err)
 	}
 
 	// Get the repository config
 	cfg, err := repo.Config()
 	if err != nil {
-		return nil, OrchardConfig{}, fmt.Errorf("failed to read config: %w", err)
+		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
 
-	var subtrees []SubtreeConfig
-	orchardConfig := OrchardConfig{}
-
-	// Parse the raw config to find subtree sections
-	for _, section := range cfg.Raw.Sections {
-		if strings.HasPrefix(section.Name, "subtree") {
-			// Extract subsection name from section name like "subtree \"name\""
-			parts := strings.SplitN(section.Name, " ", 2)
-			var subsectionName string
-			if len(parts) > 1 {
-				// Remove quotes from subsection name
-				subsectionName = strings.Trim(parts[1], "\"")
-			}
+	return []layer{
+		{source: SourceManifest, raw: manifest},
+		{source: SourceGitConfig, raw: cfg.Raw},
+	}, nil
+}
 
-			subtree := SubtreeConfig{
-				Name: subsectionName,
-			}
+// merge combines the settings of layers, including incomplete subtrees
+func merge(layers []layer) ([]SubtreeConfig, OrchardConfig) {
+	orchardConfig := OrchardConfig{Sources: map[string]Source{"squash": SourceDefault}}
+	for _, l := range layers {
+		if section := l.raw.Section("orchard"); section.HasOption("squash") {
+			orchardConfig.Squash = parseBool(section.Option("squash"))
+			orchardConfig.Sources["squash"] = l.source
+		}
+	}
 
-			for _, option := range section.Options {
-				switch option.Key {
-				case "repository":
-					subtree.Repository = option.Value
-				case "prefix":
-					subtree.Prefix = option.Value
-				case "branch":
-					subtree.Branch = option.Value
+	// Subtrees are subsections, like [subtree "name"]
+	var names []string
+	values := make(map[string]map[string]string)
+	sources := make(map[string]map[string]Source)
+	for _, l := range layers {
+		for _, subsection := range l.raw.Section("subtree").Subsections {
+			if _, ok := values[subsection.Name]; !ok {
+				names = append(names, subsection.Name)
+				values[subsection.Name] = make(map[string]string)
+				sources[subsection.Name] = make(map[string]Source)
+			}
+			for _, key := range subtreeKeys {
+				if subsection.HasOption(key) {
+					values[subsection.Name][key] = subsection.Option(key)
+					sources[subsection.Name][key] = l.source
 				}
 			}
+		}
+	}
 
-			if subtree.Repository != "" && subtree.Prefix != "" {
-				subtrees = append(subtrees, subtree)
-			}
-		} else if section.Name == "orchard" {
-			for _, option := range section.Options {
-				switch option.Key {
-				case "squash":
-					orchardConfig.Squash = option.Value == "true"
-				}
+	subtrees := make([]SubtreeConfig, 0, len(names))
+	for _, name := range names {
+		subtree := SubtreeConfig{
+			Name:       name,
+			Repository: values[name]["repository"],
+			Prefix:     values[name]["prefix"],
+			Branch:     values[name]["branch"],
+			Squash:     orchardConfig.Squash,
+			Push:       true,
+			Sources:    sources[name],
+		}
+		if value, ok := values[name]["squash"]; ok {
+			subtree.Squash = parseBool(value)
+		} else {
+			subtree.Sources["squash"] = orchardConfig.Sources["squash"]
+		}
+		if value, ok := values[name]["push"]; ok {
+			subtree.Push = parseBool(value)
+		}
+		for _, key := range subtreeKeys {
+			if _, ok := subtree.Sources[key]; !ok {
+				subtree.Sources[key] = SourceDefault
 			}
 		}
+		subtrees = append(subtrees, subtree)
 	}
+	return subtrees, orchardConfig
+}
 
-	return subtrees, orchardConfig, nil
+// readManifest reads the manifest at path, which may not exist
+func readManifest(path string) (*format.Config, error) {
+	manifest := format.New()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ManifestFile, err)
+	}
+	defer f.Close()
+	if err := format.NewDecoder(f).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ManifestFile, err)
+	}
+	return manifest, nil
+}
+
+// parseBool interprets a git config boolean
+func parseBool(value string) bool {
+	b, _ := parseBoolStrict(value)
+	return b
+}
+
+// parseBoolStrict interprets a git config boolean, failing for values git
+// wouldn't accept. A key without a value is true.
+func parseBoolStrict(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "on", "1", "":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %q", value)
+	}
+}
+
+// Find returns the subtree with the given name or prefix
+func Find(subtrees []SubtreeConfig, nameOrPrefix string) (SubtreeConfig, bool) {
+	prefix := strings.Trim(nameOrPrefix, "/")
+	for _, subtree := range subtrees {
+		if subtree.Name == nameOrPrefix || strings.Trim(subtree.Prefix, "/") == prefix {
+			return subtree, true
+		}
+	}
+	return SubtreeConfig{}, false
+}
+
+// GitConfigWriter writes configuration with git config
+type GitConfigWriter struct {
+	repoPath string
+	file     string
+}
+
+// NewGitConfigWriter creates a new GitConfigWriter for the repository at repoPath
+func NewGitConfigWriter(repoPath string) *GitConfigWriter {
+	if repoPath == "" {
+		repoPath = "."
+	}
+	return &GitConfigWriter{repoPath: repoPath}
+}
+
+// NewManifestWriter creates a new GitConfigWriter that writes the manifest
+// of the repository at repoPath instead of its git config
+func NewManifestWriter(repoPath string) *GitConfigWriter {
+	w := NewGitConfigWriter(repoPath)
+	w.file = ManifestFile
+	return w
+}
+
+// Target returns where the configuration is written
+func (w *GitConfigWriter) Target() string {
+	if w.file != "" {
+		return w.file
+	}
+	return ".git/config"
+}
+
+// WriteSubtreeConfig adds or replaces the [subtree "name"] section for subtree
+func (w *GitConfigWriter) WriteSubtreeConfig(subtree SubtreeConfig) error {
+	if subtree.Name == "" {
+		return fmt.Errorf("subtree name is required")
+	}
+	if strings.ContainsAny(subtree.Name, "\n\"") {
+		return fmt.Errorf("invalid subtree name %q", subtree.Name)
+	}
+
+	options := []struct{ key, value string }{
+		{"repository", subtree.Repository},
+		{"prefix", subtree.Prefix},
+		{"branch", subtree.Branch},
+	}
+	for _, option := range options {
+		key := fmt.Sprintf("subtree.%s.%s", subtree.Name, option.key)
+		args := []string{"-C", w.repoPath, "config"}
+		if w.file != "" {
+			args = append(args, "--file", w.file)
+		}
+		if option.value == "" {
+			args = append(args, "--unset", key)
+		} else {
+			args = append(args, key, option.value)
+		}
+		cmd := exec.Command("git", args...)
+		output, err := cmd.CombinedOutput()
+		// Unsetting a key that isn't set exits with 5
+		var exitErr *exec.ExitError
+		if option.value == "" && errors.As(err, &exitErr) && exitErr.ExitCode() == 5 {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set %s: %w: %s", key, err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
 }
@@ -1,6 +1,11 @@
 package config
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -51,3 +56,186 @@ func TestMockConfigReader(t *testing.T) {
 		t.Error("Expected squash to be true")
 	}
 }
+
+func initRepo(t *testing.T) string {
+	t.Helper()
+	for _, name := range []string{"GIT_DIR", "GIT_WORK_TREE"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	dir := t.TempDir()
+	if output, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, output)
+	}
+	return dir
+}
+
+func gitConfig(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"config"}, args...)...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git config %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+}
+
+// sameSubtree compares subtrees, ignoring the sources of their settings
+func sameSubtree(a, b SubtreeConfig) bool {
+	a.Sources, b.Sources = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+func writeManifest(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, ManifestFile), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGitConfigReader(t *testing.T) {
+	dir := initRepo(t)
+	gitConfig(t, dir, "subtree.agent.repository", "git@github.com:jmelahman/agent.git")
+	gitConfig(t, dir, "subtree.agent.prefix", "agent")
+	gitConfig(t, dir, "subtree.agent.branch", "master")
+	// Incomplete subtrees are skipped
+	gitConfig(t, dir, "subtree.partial.prefix", "partial")
+	gitConfig(t, dir, "orchard.squash", "yes")
+
+	subtrees, orchardConfig, err := NewGitConfigReader(dir).ReadSubtreeConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := SubtreeConfig{
+		Name:       "agent",
+		Repository: "git@github.com:jmelahman/agent.git",
+		Prefix:     "agent",
+		Branch:     "master",
+		Squash:     true,
+		Push:       true,
+	}
+	if len(subtrees) != 1 || !sameSubtree(subtrees[0], expected) {
+		t.Errorf("Expected %+v, got %+v", expected, subtrees)
+	}
+	if !orchardConfig.Squash {
+		t.Error("Expected squash to be true")
+	}
+}
+
+func TestManifestWithOverrides(t *testing.T) {
+	dir := initRepo(t)
+	writeManifest(t, dir, `[orchard]
+	squash = true
+[subtree "agent"]
+	repository = git@github.com:jmelahman/agent.git
+	prefix = agent
+	branch = master
+[subtree "vendored"]
+	repository = https://example.com/vendored.git
+	prefix = third_party/vendored
+	squash = false
+	push = false
+`)
+	gitConfig(t, dir, "subtree.agent.branch", "wip")
+	gitConfig(t, dir, "subtree.local.repository", "../local.git")
+	gitConfig(t, dir, "subtree.local.prefix", "local")
+
+	subtrees, orchardConfig, err := NewGitConfigReader(dir).ReadSubtreeConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !orchardConfig.Squash || orchardConfig.Sources["squash"] != SourceManifest {
+		t.Errorf("Expected squash from %s, got %+v", SourceManifest, orchardConfig)
+	}
+
+	expected := []SubtreeConfig{
+		{Name: "agent", Repository: "git@github.com:jmelahman/agent.git", Prefix: "agent", Branch: "wip", Squash: true, Push: true},
+		{Name: "vendored", Repository: "https://example.com/vendored.git", Prefix: "third_party/vendored", Squash: false, Push: false},
+		{Name: "local", Repository: "../local.git", Prefix: "local", Squash: true, Push: true},
+	}
+	if len(subtrees) != len(expected) {
+		t.Fatalf("Expected %d subtrees, got %+v", len(expected), subtrees)
+	}
+	for i := range expected {
+		if !sameSubtree(subtrees[i], expected[i]) {
+			t.Errorf("Expected %+v, got %+v", expected[i], subtrees[i])
+		}
+	}
+
+	sources := map[string]Source{
+		"repository": SourceManifest,
+		"prefix":     SourceManifest,
+		"branch":     SourceGitConfig,
+		"squash":     SourceManifest,
+		"push":       SourceDefault,
+	}
+	for key, source := range sources {
+		if subtrees[0].Sources[key] != source {
+			t.Errorf("Expected %s of agent from %s, got %s", key, source, subtrees[0].Sources[key])
+		}
+	}
+	if subtrees[2].Sources["repository"] != SourceGitConfig {
+		t.Errorf("Expected the local subtree from %s, got %s", SourceGitConfig, subtrees[2].Sources["repository"])
+	}
+}
+
+func TestInvalidManifest(t *testing.T) {
+	dir := initRepo(t)
+	writeManifest(t, dir, "[subtree \"agent\"\n")
+
+	if _, _, err := NewGitConfigReader(dir).ReadSubtreeConfigs(); err == nil {
+		t.Error("Expected an error for an invalid manifest")
+	}
+}
+
+func TestGitConfigWriter(t *testing.T) {
+	dir := initRepo(t)
+	writer := NewGitConfigWriter(dir)
+
+	subtree := SubtreeConfig{Name: "lib", Repository: "https://example.com/lib.git", Prefix: "vendor/lib", Branch: "main"}
+	if err := writer.WriteSubtreeConfig(subtree); err != nil {
+		t.Fatal(err)
+	}
+	// Rewriting without a branch removes it
+	subtree.Branch = ""
+	if err := writer.WriteSubtreeConfig(subtree); err != nil {
+		t.Fatal(err)
+	}
+
+	subtrees, _, err := NewGitConfigReader(dir).ReadSubtreeConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	subtree.Push = true
+	if len(subtrees) != 1 || !sameSubtree(subtrees[0], subtree) {
+		t.Errorf("Expected %+v, got %+v", subtree, subtrees)
+	}
+
+	if err := writer.WriteSubtreeConfig(SubtreeConfig{Prefix: "lib"}); err == nil {
+		t.Error("Expected an error for a subtree without a name")
+	}
+}
+
+func TestFind(t *testing.T) {
+	subtrees := []SubtreeConfig{
+		{Name: "agent", Prefix: "tools/agent"},
+		{Name: "lib", Prefix: "vendor/lib"},
+	}
+
+	tests := []struct {
+		query    string
+		expected string
+		found    bool
+	}{
+		{"agent", "agent", true},
+		{"vendor/lib", "lib", true},
+		{"vendor/lib/", "lib", true},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		subtree, found := Find(subtrees, tt.query)
+		if found != tt.found || subtree.Name != tt.expected {
+			t.Errorf("Find(%q) = %q, %v; expected %q, %v", tt.query, subtree.Name, found, tt.expected, tt.found)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Severity is how serious a Problem is
+type Severity string
+
+const (
+	// SeverityError is a configuration that can't work
+	SeverityError Severity = "error"
+	// SeverityWarning is a configuration that's likely a mistake
+	SeverityWarning Severity = "warning"
+	// SeverityNote is worth knowing but not wrong
+	SeverityNote Severity = "note"
+)
+
+// Problem is something found by Diagnose
+type Problem struct {
+	Severity Severity
+	// Subtree is the name of the subtree, if the problem is with one
+	Subtree string
+	// Key is the setting, if the problem is with one
+	Key string
+	// Source is where the setting was read from
+	Source  Source
+	Message string
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: ", p.Severity)
+	if p.Source != "" && p.Source != SourceDefault {
+		fmt.Fprintf(&b, "%s: ", p.Source)
+	}
+	if p.Subtree != "" {
+		fmt.Fprintf(&b, "subtree %s: ", p.Subtree)
+	}
+	if p.Key != "" {
+		fmt.Fprintf(&b, "%s: ", p.Key)
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// scpLike matches the user@host:path addresses git accepts for ssh
+var scpLike = regexp.MustCompile(`^[\w.-]+@[\w.-]+:`)
+
+// Diagnose validates the manifest and git config of the repository, both
+// each file on its own and the subtrees they configure together
+func (r *GitConfigReader) Diagnose() ([]Problem, error) {
+	layers, err := r.readLayers()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+	for _, l := range layers {
+		problems = append(problems, checkLayer(l)...)
+	}
+
+	subtrees, _ := merge(layers)
+	problems = append(problems, checkOverrides(layers)...)
+	problems = append(problems, r.checkSubtrees(subtrees, len(layers[0].raw.Sections) > 0)...)
+	return problems, nil
+}
+
+// checkLayer checks the settings of a single file
+func checkLayer(l layer) []Problem {
+	var problems []Problem
+	if section := l.raw.Section("orchard"); section.HasOption("squash") {
+		if _, err := parseBoolStrict(section.Option("squash")); err != nil {
+			problems = append(problems, Problem{Severity: SeverityError, Key: "orchard.squash", Source: l.source, Message: err.Error()})
+		}
+	}
+
+	for _, subsection := range l.raw.Section("subtree").Subsections {
+		for _, option := range subsection.Options {
+			key := strings.ToLower(option.Key)
+			switch {
+			case !slices.Contains(subtreeKeys, key):
+				problems = append(problems, Problem{
+					Severity: SeverityWarning, Subtree: subsection.Name, Key: option.Key, Source: l.source,
+					Message: fmt.Sprintf("unknown setting, expected one of %s", strings.Join(subtreeKeys, ", ")),
+				})
+			case key == "squash" || key == "push":
+				if _, err := parseBoolStrict(option.Value); err != nil {
+					problems = append(problems, Problem{Severity: SeverityError, Subtree: subsection.Name, Key: key, Source: l.source, Message: err.Error()})
+				}
+			}
+		}
+
+		repository := subsection.Option("repository")
+		if l.source == SourceManifest && repository != "" && !strings.Contains(repository, "://") && !scpLike.MatchString(repository) {
+			problems = append(problems, Problem{
+				Severity: SeverityWarning, Subtree: subsection.Name, Key: "repository", Source: l.source,
+				Message: fmt.Sprintf("%s is a local path, which others who clone the repository won't have", repository),
+			})
+		}
+	}
+	return problems
+}
+
+// checkOverrides notes the settings in git config that replace different
+// values in the manifest
+func checkOverrides(layers []layer) []Problem {
+	var problems []Problem
+	manifest, local := layers[0].raw.Section("subtree"), layers[len(layers)-1].raw.Section("subtree")
+	for _, subsection := range local.Subsections {
+		if !manifest.HasSubsection(subsection.Name) {
+			continue
+		}
+		shared := manifest.Subsection(subsection.Name)
+		for _, key := range subtreeKeys {
+			if subsection.HasOption(key) && shared.HasOption(key) && subsection.Option(key) != shared.Option(key) {
+				problems = append(problems, Problem{
+					Severity: SeverityNote, Subtree: subsection.Name, Key: key, Source: layers[len(layers)-1].source,
+					Message: fmt.Sprintf("%q overrides %q from %s", subsection.Option(key), shared.Option(key), layers[0].source),
+				})
+			}
+		}
+	}
+	return problems
+}
+
+// checkSubtrees checks the merged subtrees against each other and the
+// worktree
+func (r *GitConfigReader) checkSubtrees(subtrees []SubtreeConfig, hasManifest bool) []Problem {
+	var problems []Problem
+	type claimed struct{ prefix, name string }
+	var prefixes []claimed
+	for _, subtree := range subtrees {
+		add := func(severity Severity, key, format string, args ...any) {
+			problems = append(problems, Problem{
+				Severity: severity, Subtree: subtree.Name, Key: key, Source: subtree.Sources[key],
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		if subtree.Repository == "" {
+			add(SeverityError, "repository", "missing, so the subtree is ignored")
+		}
+		if subtree.Prefix == "" {
+			add(SeverityError, "prefix", "missing, so the subtree is ignored")
+			continue
+		}
+		if hasManifest && subtree.Sources["prefix"] == SourceGitConfig {
+			add(SeverityNote, "", "only configured in %s, add it to %s to share it", SourceGitConfig, ManifestFile)
+		}
+
+		prefix := strings.Trim(subtree.Prefix, "/")
+		clean := path.Clean(prefix)
+		if path.IsAbs(subtree.Prefix) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || slices.Contains(strings.Split(clean, "/"), ".git") {
+			add(SeverityError, "prefix", "%s must be a directory inside the repository", subtree.Prefix)
+			continue
+		}
+		for _, other := range prefixes {
+			switch {
+			case other.prefix == clean:
+				add(SeverityError, "prefix", "%s is also the prefix of subtree %s", subtree.Prefix, other.name)
+			case strings.HasPrefix(clean, other.prefix+"/") || strings.HasPrefix(other.prefix, clean+"/"):
+				add(SeverityError, "prefix", "%s overlaps %s of subtree %s", subtree.Prefix, other.prefix, other.name)
+			}
+		}
+		prefixes = append(prefixes, claimed{clean, subtree.Name})
+
+		if info, err := os.Stat(filepath.Join(r.repoPath, filepath.FromSlash(clean))); err != nil || !info.IsDir() {
+			add(SeverityWarning, "prefix", "%s doesn't exist, add it with git orchard add", subtree.Prefix)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	dir := initRepo(t)
+	if err := os.MkdirAll(filepath.Join(dir, "agent"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeManifest(t, dir, `[orchard]
+	squash = maybe
+[subtree "agent"]
+	repository = git@github.com:jmelahman/agent.git
+	prefix = agent
+	branch = master
+	brnach = main
+[subtree "nested"]
+	repository = https://example.com/nested.git
+	prefix = agent/nested
+	push = sometimes
+[subtree "escape"]
+	repository = ../escape.git
+	prefix = ../escape
+[subtree "missing"]
+	repository = https://example.com/missing.git
+	prefix = missing
+[subtree "incomplete"]
+	prefix = incomplete
+`)
+	gitConfig(t, dir, "subtree.agent.branch", "wip")
+	gitConfig(t, dir, "subtree.local.repository", "../local.git")
+	gitConfig(t, dir, "subtree.local.prefix", "agent")
+
+	problems, err := NewGitConfigReader(dir).Diagnose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+
+	expected := []string{
+		`error: .gitorchard: orchard.squash: invalid boolean "maybe"`,
+		`warning: .gitorchard: subtree agent: brnach: unknown setting, expected one of repository, prefix, branch, squash, push`,
+		`error: .gitorchard: subtree nested: push: invalid boolean "sometimes"`,
+		`warning: .gitorchard: subtree escape: repository: ../escape.git is a local path, which others who clone the repository won't have`,
+		`note: .git/config: subtree agent: branch: "wip" overrides "master" from .gitorchard`,
+		`error: .gitorchard: subtree nested: prefix: agent/nested overlaps agent of subtree agent`,
+		`warning: .gitorchard: subtree nested: prefix: agent/nested doesn't exist, add it with git orchard add`,
+		`error: .gitorchard: subtree escape: prefix: ../escape must be a directory inside the repository`,
+		`warning: .gitorchard: subtree missing: prefix: missing doesn't exist, add it with git orchard add`,
+		`error: subtree incomplete: repository: missing, so the subtree is ignored`,
+		`warning: .gitorchard: subtree incomplete: prefix: incomplete doesn't exist, add it with git orchard add`,
+		`note: subtree local: only configured in .git/config, add it to .gitorchard to share it`,
+		`error: .git/config: subtree local: prefix: agent is also the prefix of subtree agent`,
+		`error: .git/config: subtree local: prefix: agent overlaps agent/nested of subtree nested`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected problems:\n%s\n\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestDiagnoseClean(t *testing.T) {
+	dir := initRepo(t)
+	if err := os.MkdirAll(filepath.Join(dir, "agent"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeManifest(t, dir, `[subtree "agent"]
+	repository = git@github.com:jmelahman/agent.git
+	prefix = agent
+`)
+
+	problems, err := NewGitConfigReader(dir).Diagnose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// linkPattern matches repository links in a README, either as URLs or as
+// scp-like git addresses
+var linkPattern = regexp.MustCompile(`(?:https?|ssh|git)://[^\s)\]>"'` + "`" + `]+|git@[\w.-]+:[\w./~-]+`)
+
+// InferRepository guesses the upstream repository of the subtree at prefix.
+// It looks for a git remote named like the subtree's directory or pointing
+// at a repository of that name, then for a link to such a repository in the
+// subtree's README and in the README at the root. It returns the repository
+// and where it was found, or empty strings if it found none.
+func InferRepository(repoPath, prefix string) (repository, source string) {
+	name := path.Base(strings.Trim(prefix, "/"))
+
+	if remote, repository := remoteFor(repoPath, name); repository != "" {
+		return repository, "remote " + remote
+	}
+
+	for _, dir := range []string{strings.Trim(prefix, "/"), "."} {
+		matches, _ := filepath.Glob(filepath.Join(repoPath, dir, "README*"))
+		for _, readme := range matches {
+			content, err := os.ReadFile(readme)
+			if err != nil {
+				continue
+			}
+			if repository := linkTo(string(content), name); repository != "" {
+				rel, _ := filepath.Rel(repoPath, readme)
+				return repository, filepath.ToSlash(rel)
+			}
+		}
+	}
+	return "", ""
+}
+
+// remoteFor returns the first remote named name or whose URL is a
+// repository named name
+func remoteFor(repoPath, name string) (remote, repository string) {
+	output, err := exec.Command("git", "-C", repoPath, "remote", "-v").Output()
+	if err != nil {
+		return "", ""
+	}
+	// origin	git@github.com:jmelahman/agent.git (fetch)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[2] != "(fetch)" {
+			continue
+		}
+		if fields[0] == name || repositoryName(fields[1]) == name {
+			return fields[0], fields[1]
+		}
+	}
+	return "", ""
+}
+
+// linkTo returns the first link in content to a repository named name,
+// trimmed to the repository itself
+func linkTo(content, name string) string {
+	for _, link := range linkPattern.FindAllString(content, -1) {
+		if repository := trimToRepository(link); repository != "" && repositoryName(repository) == name {
+			return repository
+		}
+	}
+	return ""
+}
+
+// trimToRepository trims a link below a repository, like a link to a file
+// or a badge, to the owner and repository on the host
+func trimToRepository(link string) string {
+	link = strings.TrimRight(link, ".,;:")
+	if rest, ok := strings.CutPrefix(link, "git@"); ok {
+		host, repoPath, _ := strings.Cut(rest, ":")
+		segments := strings.Split(strings.Trim(repoPath, "/"), "/")
+		if len(segments) < 2 {
+			return ""
+		}
+		return "git@" + host + ":" + segments[0] + "/" + segments[1]
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 2 || segments[0] == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + "/" + segments[0] + "/" + segments[1]
+}
+
+// repositoryName returns the name of the repository at a URL, without .git
+func repositoryName(repository string) string {
+	repository = strings.TrimSuffix(strings.TrimRight(repository, "/"), ".git")
+	if i := strings.LastIndexAny(repository, "/:"); i >= 0 {
+		repository = repository[i+1:]
+	}
+	return repository
+}
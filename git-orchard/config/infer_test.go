@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepositoryName(t *testing.T) {
+	tests := map[string]string{
+		"git@github.com:jmelahman/agent.git":   "agent",
+		"https://github.com/jmelahman/agent":   "agent",
+		"https://github.com/jmelahman/agent/":  "agent",
+		"ssh://git@example.com/team/agent.git": "agent",
+		"../agent.git":                         "agent",
+	}
+	for repository, expected := range tests {
+		if name := repositoryName(repository); name != expected {
+			t.Errorf("repositoryName(%q) = %q, expected %q", repository, name, expected)
+		}
+	}
+}
+
+func TestLinkTo(t *testing.T) {
+	content := `# connections
+
+[![Go Reference](https://pkg.go.dev/badge/github.com/jmelahman/connections.svg)](https://pkg.go.dev/github.com/jmelahman/connections)
+[![Test status](https://github.com/jmelahman/connections/actions/workflows/test.yml/badge.svg)](https://github.com/jmelahman/connections/actions)
+`
+	if link := linkTo(content, "connections"); link != "https://github.com/jmelahman/connections" {
+		t.Errorf("Expected the repository from the badge, got %q", link)
+	}
+	if link := linkTo("Clone git@gitlab.com:team/agent.git.", "agent"); link != "git@gitlab.com:team/agent.git" {
+		t.Errorf("Expected the scp-like address, got %q", link)
+	}
+	if link := linkTo(content, "agent"); link != "" {
+		t.Errorf("Expected no link to agent, got %q", link)
+	}
+}
+
+func TestInferRepository(t *testing.T) {
+	dir := initRepo(t)
+
+	// The root README links to each project
+	readme := "- `connections/` → [github.com/jmelahman/connections](https://github.com/jmelahman/connections)\n"
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte(readme), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	repository, source := InferRepository(dir, "connections")
+	if repository != "https://github.com/jmelahman/connections" || source != "README.md" {
+		t.Errorf("Expected the link in README.md, got %q from %q", repository, source)
+	}
+
+	// A remote takes precedence
+	gitConfig(t, dir, "remote.upstream.url", "git@github.com:jmelahman/connections.git")
+	repository, source = InferRepository(dir, "connections/")
+	if repository != "git@github.com:jmelahman/connections.git" || source != "remote upstream" {
+		t.Errorf("Expected the remote, got %q from %q", repository, source)
+	}
+
+	if repository, _ := InferRepository(dir, "vendor/unknown"); repository != "" {
+		t.Errorf("Expected no repository, got %q", repository)
+	}
+}
@@ -1,8 +1,12 @@
 package history
 
 import (
+	"fmt"
 	"os/exec"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
 // SubtreeHistoryInfo represents subtree information from git history
@@ -12,83 +16,410 @@ type SubtreeHistoryInfo struct {
 	LastMessage string
 }
 
+// EventKind is what git subtree did to a subtree
+type EventKind string
+
+const (
+	// EventAdd is a git subtree add
+	EventAdd EventKind = "add"
+	// EventMerge is a git subtree pull or merge. Squashed ones have trailers,
+	// and the others are found by merging descendants of an upstream commit
+	// the subtree matched.
+	EventMerge EventKind = "merge"
+	// EventSplit is a git subtree split with --rejoin
+	EventSplit EventKind = "split"
+)
+
+// Event is a merge or split of a subtree, found from git-subtree-* trailers
+type Event struct {
+	Kind   EventKind
+	Prefix string
+	// Commit is the mainline commit of the event. For squashed events it's
+	// the merge of the squash commit.
+	Commit string
+	// Date is when Commit was committed
+	Date time.Time
+	// Split is the upstream commit the subtree matched, from the
+	// git-subtree-split trailer, or the merged commit of a merge that wasn't
+	// squashed
+	Split string
+	// Mainline is the mainline commit that was merged with Split, from the
+	// git-subtree-mainline trailer of adds and rejoins
+	Mainline string
+	// Squash is set when the upstream history was squashed
+	Squash bool
+	// SquashCommit is the commit squashing the upstream history
+	SquashCommit string
+	// Subject is the subject of the commit with the trailers
+	Subject string
+}
+
+// SyncPoint is where a subtree was last synced with its upstream
+type SyncPoint struct {
+	// Commit is the last mainline commit where the subtree matched its
+	// upstream, which is an add or a split with --rejoin
+	Commit string
+	// Upstream is the last upstream commit merged by an add, a pull or a
+	// rejoin
+	Upstream string
+}
+
 // Reader interface for reading git history (useful for testing)
 type Reader interface {
 	GetSubtreesFromHistory() (map[string]SubtreeHistoryInfo, error)
+	GetSubtreeEvents(refs ...string) (map[string][]Event, error)
+	GetLastSync(ref, prefix string) (SyncPoint, error)
 }
 
 // GitHistoryReader reads subtree information from git history
-type GitHistoryReader struct{}
+type GitHistoryReader struct {
+	repoPath string
+}
+
+// NewGitHistoryReader creates a new GitHistoryReader for the repository at
+// repoPath. If repoPath is empty, the current directory is used.
+func NewGitHistoryReader(repoPath string) *GitHistoryReader {
+	if repoPath == "" {
+		repoPath = "."
+	}
+	return &GitHistoryReader{repoPath: repoPath}
+}
 
-// NewGitHistoryReader creates a new GitHistoryReader
-func NewGitHistoryReader() *GitHistoryReader {
-	return &GitHistoryReader{}
+func (r *GitHistoryReader) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.repoPath
+	return cmd.Output()
 }
 
-// GetSubtreesFromHistory extracts subtree information from git log
+// GetSubtreesFromHistory returns the last event of every subtree in the
+// history of all refs
 func (r *GitHistoryReader) GetSubtreesFromHistory() (map[string]SubtreeHistoryInfo, error) {
-	// Execute git log to find subtree merge commits
-	cmd := exec.Command("git", "log", "--grep=git-subtree-dir:", "--pretty=format:%B", "--all")
-	output, err := cmd.Output()
+	events, err := r.GetSubtreeEvents()
 	if err != nil {
 		return nil, err
 	}
 
 	subtreeMap := make(map[string]SubtreeHistoryInfo)
+	for prefix, prefixEvents := range events {
+		last := prefixEvents[len(prefixEvents)-1]
+		subtreeMap[prefix] = SubtreeHistoryInfo{
+			Prefix:      prefix,
+			LastCommit:  last.Commit,
+			LastMessage: last.Subject,
+		}
+	}
+	return subtreeMap, nil
+}
+
+// GetSubtreeEvents returns the events of every subtree in the history of
+// refs, or of all refs if none are given, by prefix and oldest first
+func (r *GitHistoryReader) GetSubtreeEvents(refs ...string) (map[string][]Event, error) {
+	return r.readEvents("", refs)
+}
+
+// GetLastSync finds the last time the subtree at prefix was synced with its
+// upstream in the history of ref. It returns an empty SyncPoint if the
+// subtree was never added with git subtree.
+func (r *GitHistoryReader) GetLastSync(ref, prefix string) (SyncPoint, error) {
+	prefix = strings.Trim(prefix, "/")
+	events, err := r.readEvents(prefix, []string{ref})
+	if err != nil {
+		return SyncPoint{}, err
+	}
+	return lastSync(events[prefix]), nil
+}
 
-	if len(output) == 0 {
-		return subtreeMap, nil
+// lastSync finds the sync point in the events of a subtree
+func lastSync(events []Event) SyncPoint {
+	var sync SyncPoint
+	for i := len(events) - 1; i >= 0; i-- {
+		if sync.Upstream == "" {
+			sync.Upstream = events[i].Split
+		}
+		if events[i].Kind == EventAdd || events[i].Kind == EventSplit {
+			sync.Commit = events[i].Commit
+			break
+		}
 	}
+	return sync
+}
 
-	// Parse the output to extract subtree information
-	lines := strings.Split(string(output), "\n")
+const (
+	recordSeparator = "\x1e"
+	fieldSeparator  = "\x1f"
+)
 
-	prefix := ""
-	commit := ""
-	message := ""
+// trailerFormat prints the fields of a commit parsed by parseTrailers
+var trailerFormat = strings.Join([]string{
+	"%H", "%P", "%cI", "%s",
+	"%(trailers:key=git-subtree-dir,valueonly,separator=%x20)",
+	"%(trailers:key=git-subtree-mainline,valueonly,separator=%x20)",
+	"%(trailers:key=git-subtree-split,valueonly,separator=%x20)",
+}, "%x1f") + "%x1e"
 
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
+// mergeFormat prints the fields of a merge parsed by parseMerges
+const mergeFormat = "%H%x1f%P%x1f%cI%x1f%s%x1e"
+
+// readEvents reads the events of the subtree at prefix, or of every subtree
+// if prefix is empty, in the history of refs
+func (r *GitHistoryReader) readEvents(prefix string, refs []string) (map[string][]Event, error) {
+	if len(refs) == 0 {
+		refs = []string{"--all"}
+	}
+	pattern := "^git-subtree-dir: "
+	if prefix != "" {
+		pattern += regexp.QuoteMeta(prefix) + "/*$"
+	}
+
+	args := append([]string{"log", "--reverse", "--extended-regexp", "--grep=" + pattern, "--format=" + trailerFormat}, refs...)
+	output, err := r.git(append(args, "--")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subtree history: %w", err)
+	}
+	trailers := parseTrailers(string(output))
+	if len(trailers) == 0 {
+		return map[string][]Event{}, nil
+	}
+
+	// Squashed adds and pulls merge the squash commit without trailers, and
+	// pulls that aren't squashed have none at all
+	args = append([]string{"log", "--merges", "--format=" + mergeFormat}, refs...)
+	output, err = r.git(append(args, "--")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read merges: %w", err)
+	}
+	merges := parseMerges(string(output))
+	events := buildEvents(trailers, merges)
+	for prefix, prefixEvents := range events {
+		merged, err := r.findMerges(prefixEvents, merges, refs)
+		if err != nil {
+			return nil, err
+		}
+		events[prefix] = merged
+	}
+	return events, nil
+}
+
+// findMerges adds the pulls and merges of a subtree that weren't squashed,
+// which have no trailers, to its events. They're the mainline merges of
+// upstream commits, which descend from the upstream commits the subtree
+// matched but not from the mainline commits of its events.
+func (r *GitHistoryReader) findMerges(events []Event, merges []mergeCommit, refs []string) ([]Event, error) {
+	var splits, mainlines []string
+	known := make(map[string]bool)
+	for _, event := range events {
+		known[event.Commit] = true
+		mainlines = append(mainlines, event.Commit)
+		// Squashed upstream histories aren't in the mainline history
+		if !event.Squash {
+			splits = append(splits, event.Split)
+		}
+	}
+	if len(splits) == 0 {
+		return events, nil
+	}
+	upstream, err := r.descendants(refs, splits)
+	if err != nil {
+		return nil, err
+	}
+	for _, split := range splits {
+		upstream[split] = true
+	}
+	mainline, err := r.descendants(refs, mainlines)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, merge := range merges {
+		if known[merge.hash] || !mainline[merge.hash] {
+			continue
+		}
+		merged := merge.parents[1]
+		if !upstream[merged] || mainline[merged] || known[merged] {
+			continue
+		}
+		found = true
+		events = append(events, Event{
+			Kind:    EventMerge,
+			Prefix:  events[0].Prefix,
+			Commit:  merge.hash,
+			Date:    merge.date,
+			Split:   merged,
+			Subject: merge.subject,
+		})
+	}
+	if !found {
+		return events, nil
+	}
+
+	// Commits made in the same second can't be ordered by date, so events
+	// are ordered like the history, where the newest commits come first
+	output, err := r.git(append(append([]string{"rev-list", "--topo-order"}, refs...), "--")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	positions := make(map[string]int)
+	for i, commit := range strings.Fields(string(output)) {
+		positions[commit] = i
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return positions[events[i].Commit] > positions[events[j].Commit]
+	})
+	return events, nil
+}
+
+// descendants returns the commits in the history of refs that descend from
+// any of commits
+func (r *GitHistoryReader) descendants(refs, commits []string) (map[string]bool, error) {
+	args := append([]string{"rev-list", "--ancestry-path"}, refs...)
+	for _, commit := range commits {
+		args = append(args, "^"+commit)
+	}
+	output, err := r.git(append(args, "--")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descendants: %w", err)
+	}
+	set := make(map[string]bool)
+	for _, commit := range strings.Fields(string(output)) {
+		set[commit] = true
+	}
+	return set, nil
+}
+
+// trailerCommit is a commit with git-subtree-* trailers
+type trailerCommit struct {
+	hash     string
+	parents  []string
+	date     time.Time
+	subject  string
+	dir      string
+	mainline string
+	split    string
+}
+
+// mergeCommit is a merge
+type mergeCommit struct {
+	hash    string
+	parents []string
+	date    time.Time
+	subject string
+}
+
+// parseTrailers parses the output of git log with trailerFormat. Commits
+// that only mention the trailers in their body are left out.
+func parseTrailers(output string) []trailerCommit {
+	var commits []trailerCommit
+	for _, record := range strings.Split(output, recordSeparator) {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), fieldSeparator)
+		if len(fields) != 7 {
+			continue
+		}
+		commit := trailerCommit{
+			hash:     fields[0],
+			parents:  strings.Fields(fields[1]),
+			subject:  fields[3],
+			dir:      strings.Trim(strings.TrimSpace(fields[4]), "/"),
+			mainline: strings.TrimSpace(fields[5]),
+			split:    strings.TrimSpace(fields[6]),
+		}
+		commit.date, _ = time.Parse(time.RFC3339, fields[2])
+		if commit.dir == "" || commit.split == "" || strings.Contains(commit.dir, " ") {
+			continue
+		}
+		commits = append(commits, commit)
+	}
+	return commits
+}
+
+// parseMerges parses the output of git log --merges with mergeFormat
+func parseMerges(output string) []mergeCommit {
+	var merges []mergeCommit
+	for _, record := range strings.Split(output, recordSeparator) {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), fieldSeparator)
+		if len(fields) != 4 {
+			continue
+		}
+		merge := mergeCommit{hash: fields[0], parents: strings.Fields(fields[1]), subject: fields[3]}
+		merge.date, _ = time.Parse(time.RFC3339, fields[2])
+		if len(merge.parents) < 2 {
 			continue
 		}
+		merges = append(merges, merge)
+	}
+	return merges
+}
+
+// buildEvents turns commits with trailers, oldest first, into events.
+// Squash commits become the event of the commit that merged them.
+func buildEvents(trailers []trailerCommit, merges []mergeCommit) map[string][]Event {
+	// Merges are found by the parents they merged
+	mergedBy := make(map[string]mergeCommit)
+	for _, merge := range merges {
+		for _, parent := range merge.parents[1:] {
+			mergedBy[parent] = merge
+		}
+	}
+	squashes := make(map[string]trailerCommit)
+	for _, commit := range trailers {
+		if commit.mainline == "" {
+			squashes[commit.hash] = commit
+		}
+	}
+	// Rejoins have their own trailers, and so does the squash they merge
+	rejoined := make(map[string]bool)
+	for _, commit := range trailers {
+		if commit.mainline != "" && len(commit.parents) > 1 {
+			if _, ok := squashes[commit.parents[1]]; ok {
+				rejoined[commit.parents[1]] = true
+			}
+		}
+	}
 
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) < 2 {
+	events := make(map[string][]Event)
+	for _, commit := range trailers {
+		if rejoined[commit.hash] {
 			continue
 		}
+		event := Event{
+			Prefix:   commit.dir,
+			Commit:   commit.hash,
+			Date:     commit.date,
+			Split:    commit.split,
+			Mainline: commit.mainline,
+			Subject:  commit.subject,
+		}
 
-		field := parts[0]
-		content := parts[1]
-
-		if field == "git-subtree-dir:" {
-			prefix = content
-		} else if field == "git-subtree-mainline:" {
-			commit = content
-		} else if field == "git-subtree-split:" {
-			// Reset search
-			prefix = ""
-			commit = ""
-			message = ""
-		} else if message == "" {
-			message = line
-		}
-
-		// Check if this is a merge commit (has git-subtree-mainline)
-		if info, exists := subtreeMap[prefix]; exists {
-			// Update with more recent commit info if this is a mainline merge
-			if commit != "" {
-				info.LastCommit = commit
-				info.LastMessage = message
-				subtreeMap[prefix] = info
+		if commit.mainline == "" {
+			// A squash commit
+			event.Squash = true
+			event.SquashCommit = commit.hash
+			if merge, ok := mergedBy[commit.hash]; ok {
+				event.Commit = merge.hash
+				event.Date = merge.date
+			}
+			event.Kind = EventMerge
+			if strings.Contains(commit.subject, "' content from commit ") {
+				event.Kind = EventAdd
 			}
 		} else {
-			subtreeMap[prefix] = SubtreeHistoryInfo{
-				Prefix:      prefix,
-				LastCommit:  commit,
-				LastMessage: message,
+			if len(commit.parents) > 1 {
+				if squash, ok := squashes[commit.parents[1]]; ok {
+					event.Squash = true
+					event.SquashCommit = squash.hash
+				}
+			}
+			switch {
+			case strings.HasPrefix(commit.subject, "Split '"):
+				event.Kind = EventSplit
+			case strings.HasPrefix(commit.subject, "Add '"), len(events[commit.dir]) == 0:
+				event.Kind = EventAdd
+			default:
+				// A rejoin with its own message
+				event.Kind = EventSplit
 			}
 		}
+		events[commit.dir] = append(events[commit.dir], event)
 	}
-
-	return subtreeMap, nil
+	return events
 }
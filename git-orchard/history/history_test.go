@@ -1,6 +1,10 @@
 package history
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -14,6 +18,16 @@ func (m *MockHistoryReader) GetSubtreesFromHistory() (map[string]SubtreeHistoryI
 	return m.subtrees, m.err
 }
 
+func (m *MockHistoryReader) GetSubtreeEvents(refs ...string) (map[string][]Event, error) {
+	return nil, m.err
+}
+
+func (m *MockHistoryReader) GetLastSync(ref, prefix string) (SyncPoint, error) {
+	return SyncPoint{}, m.err
+}
+
+var _ Reader = (*MockHistoryReader)(nil)
+
 func TestMockHistoryReader(t *testing.T) {
 	mockSubtrees := map[string]SubtreeHistoryInfo{
 		"vendor/example": {
@@ -47,3 +61,217 @@ func TestMockHistoryReader(t *testing.T) {
 		t.Errorf("Expected last commit 'abc123', got '%s'", info.LastCommit)
 	}
 }
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func commitFile(t *testing.T, dir, name, message string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(message), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, dir, "add", name)
+	git(t, dir, "commit", "-q", "-m", message)
+	return git(t, dir, "rev-parse", "HEAD")
+}
+
+// setup returns a mainline repository and an upstream repository to add as
+// subtrees
+func setup(t *testing.T) (mainline, upstream string) {
+	t.Helper()
+	for _, name := range []string{"GIT_DIR", "GIT_WORK_TREE"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	for _, name := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		t.Setenv(name+"_NAME", "test")
+		t.Setenv(name+"_EMAIL", "test@example.com")
+	}
+	root := t.TempDir()
+	upstream = filepath.Join(root, "upstream")
+	mainline = filepath.Join(root, "mainline")
+	git(t, root, "init", "-q", "-b", "main", upstream)
+	commitFile(t, upstream, "README.md", "Upstream")
+	git(t, root, "init", "-q", "-b", "main", mainline)
+	commitFile(t, mainline, "README.md", "Mainline")
+	return mainline, upstream
+}
+
+type expectedEvent struct {
+	kind   EventKind
+	split  string
+	squash bool
+}
+
+func checkEvents(t *testing.T, events []Event, expected []expectedEvent) {
+	t.Helper()
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %+v", len(expected), events)
+	}
+	for i, e := range expected {
+		got := events[i]
+		if got.Kind != e.kind || got.Split != e.split || got.Squash != e.squash {
+			t.Errorf("Event %d: expected %s of %s (squash %v), got %s of %s (squash %v)",
+				i, e.kind, e.split, e.squash, got.Kind, got.Split, got.Squash)
+		}
+		if got.Date.IsZero() {
+			t.Errorf("Event %d: expected a date", i)
+		}
+	}
+}
+
+func TestGetSubtreeEvents(t *testing.T) {
+	mainline, upstream := setup(t)
+	reader := NewGitHistoryReader(mainline)
+	first := git(t, upstream, "rev-parse", "HEAD")
+
+	// A squashed subtree, pulled and rejoined
+	git(t, mainline, "subtree", "add", "-q", "--squash", "--prefix", "squashed", upstream, "main")
+	second := commitFile(t, upstream, "NEW.md", "New upstream commit")
+	git(t, mainline, "subtree", "pull", "-q", "--squash", "--prefix", "squashed", upstream, "main")
+	commitFile(t, mainline, "squashed/LOCAL.md", "Local commit")
+	output := strings.Fields(git(t, mainline, "subtree", "split", "-q", "--rejoin", "--squash", "--prefix", "squashed"))
+	split := output[len(output)-1]
+
+	// A subtree with its whole history
+	git(t, mainline, "subtree", "add", "-q", "--prefix", "vendor/full", upstream, "main")
+	fullAdd := git(t, mainline, "rev-parse", "HEAD")
+
+	// A commit that only talks about the trailers
+	commitFile(t, mainline, "NOTES.md", "Document subtrees\n\nMention git-subtree-dir: squashed and\ngit-subtree-split: "+first+"\n\nSigned-off-by: test <test@example.com>")
+
+	events, err := reader.GetSubtreeEvents("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected events for 2 prefixes, got %v", events)
+	}
+	checkEvents(t, events["squashed"], []expectedEvent{
+		{EventAdd, first, true},
+		{EventMerge, second, true},
+		{EventSplit, split, true},
+	})
+	checkEvents(t, events["vendor/full"], []expectedEvent{
+		{EventAdd, second, false},
+	})
+	if events["vendor/full"][0].Commit != fullAdd {
+		t.Errorf("Expected the add at %s, got %s", fullAdd, events["vendor/full"][0].Commit)
+	}
+	// Squashed events are recorded at the merge of their squash commit
+	for _, event := range events["squashed"] {
+		if parents := strings.Fields(git(t, mainline, "log", "-1", "--format=%P", event.Commit)); len(parents) != 2 || parents[1] != event.SquashCommit {
+			t.Errorf("Expected %s to merge %s, got parents %v", event.Commit, event.SquashCommit, parents)
+		}
+	}
+
+	subtrees, err := reader.GetSubtreesFromHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := subtrees["vendor/full"]; info.LastCommit != fullAdd || !strings.HasPrefix(info.LastMessage, "Add 'vendor/full/'") {
+		t.Errorf("Unexpected history info %+v", info)
+	}
+}
+
+func TestGetSubtreeEventsWithoutSquash(t *testing.T) {
+	mainline, upstream := setup(t)
+	reader := NewGitHistoryReader(mainline)
+	first := git(t, upstream, "rev-parse", "HEAD")
+
+	git(t, mainline, "subtree", "add", "-q", "--prefix", "lib", upstream, "main")
+	// Upstream merges are part of the pulled history, not pulls
+	git(t, upstream, "checkout", "-q", "-b", "feature")
+	commitFile(t, upstream, "FEATURE.md", "Upstream feature")
+	git(t, upstream, "checkout", "-q", "main")
+	git(t, upstream, "merge", "-q", "--no-ff", "-m", "Merge upstream feature", "feature")
+	second := git(t, upstream, "rev-parse", "HEAD")
+	git(t, mainline, "subtree", "pull", "-q", "--prefix", "lib", upstream, "main", "-m", "Pull lib")
+	pull := git(t, mainline, "rev-parse", "HEAD")
+
+	// Mainline merges contain the upstream history too, but aren't pulls
+	git(t, mainline, "checkout", "-q", "-b", "feature")
+	commitFile(t, mainline, "lib/LOCAL.md", "Local change")
+	git(t, mainline, "checkout", "-q", "main")
+	git(t, mainline, "merge", "-q", "--no-ff", "-m", "Merge feature", "feature")
+
+	third := commitFile(t, upstream, "THIRD.md", "Third upstream commit")
+	git(t, mainline, "subtree", "pull", "-q", "--prefix", "lib", upstream, "main")
+
+	events, err := reader.GetSubtreeEvents("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, events["lib"], []expectedEvent{
+		{EventAdd, first, false},
+		{EventMerge, second, false},
+		{EventMerge, third, false},
+	})
+	if merge := events["lib"][1]; merge.Commit != pull || merge.Subject != "Pull lib" {
+		t.Errorf("Expected the pull at %s, got %+v", pull, merge)
+	}
+	if sync, err := reader.GetLastSync("HEAD", "lib"); err != nil || sync.Upstream != third {
+		t.Errorf("Expected a sync with %s, got %+v (%v)", third, sync, err)
+	}
+}
+
+func TestGetLastSync(t *testing.T) {
+	mainline, upstream := setup(t)
+	reader := NewGitHistoryReader(mainline)
+	first := git(t, upstream, "rev-parse", "HEAD")
+
+	if sync, err := reader.GetLastSync("HEAD", "lib"); err != nil || sync != (SyncPoint{}) {
+		t.Fatalf("Expected no sync point before the add, got %+v (%v)", sync, err)
+	}
+
+	git(t, mainline, "subtree", "add", "-q", "--squash", "--prefix", "lib", upstream, "main")
+	add := git(t, mainline, "rev-parse", "HEAD")
+	second := commitFile(t, upstream, "NEW.md", "New upstream commit")
+	git(t, mainline, "subtree", "pull", "-q", "--squash", "--prefix", "lib", upstream, "main")
+
+	sync, err := reader.GetLastSync("HEAD", "lib/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pulls don't push, so local changes are counted from the add
+	if sync.Commit != add || sync.Upstream != second {
+		t.Errorf("Expected a sync at %s with %s, got %+v", add, second, sync)
+	}
+	if sync, _ := reader.GetLastSync("HEAD^", "lib"); sync.Commit != add || sync.Upstream != first {
+		t.Errorf("Expected a sync at %s with %s before the pull, got %+v", add, first, sync)
+	}
+}
+
+func TestBuildEvents(t *testing.T) {
+	record := func(fields ...string) string {
+		return strings.Join(fields, fieldSeparator) + recordSeparator + "\n"
+	}
+	output := record("a1", "m0 u1", "2024-01-01T00:00:00Z", "Add 'lib/' from commit 'u1'", "lib", "m0", "u1") +
+		// A rejoin with a message given with -m
+		record("a2", "m1 s2", "2024-01-02T00:00:00Z", "Sync lib", "lib/", "m1", "s2") +
+		// Bodies that mention the trailers have none of their own
+		record("a3", "m2", "2024-01-03T00:00:00Z", "Talk about git-subtree-dir: lib", "", "", "") +
+		// A truncated record
+		record("a4", "m3")
+
+	events := buildEvents(parseTrailers(output), nil)
+	checkEvents(t, events["lib"], []expectedEvent{
+		{EventAdd, "u1", false},
+		{EventSplit, "s2", false},
+	})
+	if sync := lastSync(events["lib"]); sync.Commit != "a2" || sync.Upstream != "s2" {
+		t.Errorf("Expected a sync at the rejoin, got %+v", sync)
+	}
+}
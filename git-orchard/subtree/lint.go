@@ -0,0 +1,204 @@
+package subtree
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/history"
+)
+
+// Check is the kind of a Finding
+type Check string
+
+const (
+	// CheckCrossSubtree is a commit changing files of several subtrees,
+	// which git subtree splits into each of their histories
+	CheckCrossSubtree Check = "cross-subtree"
+	// CheckUnconfigured is a commit changing files of a subtree in the
+	// history that isn't configured, so it's never pushed
+	CheckUnconfigured Check = "unconfigured-prefix"
+	// CheckDiverged is an upstream branch that no longer contains the
+	// upstream commit last merged, as after a force-push
+	CheckDiverged Check = "diverged-upstream"
+	// CheckUnfetched is an upstream that couldn't be fetched, so it isn't
+	// checked for diverging
+	CheckUnfetched Check = "unfetched-upstream"
+)
+
+// Finding is a problem found by Lint or Diverged
+type Finding struct {
+	Check    Check           `json:"check"`
+	Severity config.Severity `json:"severity"`
+	// Commit is the commit with the problem, if it's with one
+	Commit string `json:"commit,omitempty"`
+	// Subject is the subject of Commit
+	Subject string `json:"subject,omitempty"`
+	// Prefixes are the prefixes of the subtrees with the problem
+	Prefixes []string `json:"prefixes"`
+	Message  string   `json:"message"`
+}
+
+func (f Finding) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s: ", f.Severity, f.Check)
+	if f.Commit != "" {
+		fmt.Fprintf(&b, "%.12s %s: ", f.Commit, f.Subject)
+	}
+	b.WriteString(f.Message)
+	return b.String()
+}
+
+// Lint checks the commits listed by revs, as given to git rev-list, for
+// changes to several subtrees at once and to subtrees that aren't
+// configured. Merges and the upstream histories of subtrees are skipped.
+func (g *Git) Lint(subtrees []config.SubtreeConfig, reader history.Reader, revs ...string) ([]Finding, error) {
+	names := make(map[string]string)
+	for _, subtree := range subtrees {
+		names[strings.Trim(subtree.Prefix, "/")] = subtree.Name
+	}
+	events, err := reader.GetSubtreeEvents()
+	if err != nil {
+		return nil, err
+	}
+	var unconfigured []string
+	for prefix := range events {
+		if _, ok := names[prefix]; !ok {
+			unconfigured = append(unconfigured, prefix)
+		}
+	}
+
+	// Commits of the upstream histories change files at their root, so
+	// they're skipped rather than matched against mainline prefixes. They
+	// come before revs, which may use --not.
+	args := []string{"-c", "core.quotePath=false", "log", "--no-merges", "--name-only", "--format=" + recordStart + "%H%x1f%s"}
+	for _, prefixEvents := range events {
+		for _, event := range prefixEvents {
+			for _, commit := range []string{event.Split, event.SquashCommit} {
+				if commit != "" && g.hasCommit(commit) {
+					args = append(args, "^"+commit)
+				}
+			}
+		}
+	}
+	for _, subtree := range subtrees {
+		if g.hasCommit(UpstreamRef(subtree)) {
+			args = append(args, "^"+UpstreamRef(subtree))
+		}
+	}
+	args = append(args, revs...)
+	output, err := g.git(append(args, "--")...)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, record := range strings.Split(output, recordStart) {
+		header, paths, _ := strings.Cut(record, "\n")
+		commit, subject, ok := strings.Cut(header, "\x1f")
+		if !ok {
+			continue
+		}
+		touched := make(map[string]bool)
+		for _, path := range strings.Split(paths, "\n") {
+			if prefix := prefixOf(path, names, unconfigured); prefix != "" {
+				touched[prefix] = true
+			}
+		}
+		findings = append(findings, lintCommit(commit, subject, touched, names)...)
+	}
+	return findings, nil
+}
+
+// recordStart starts each commit in the output of Lint's git log
+const recordStart = "\x1e"
+
+// lintCommit returns the findings for a commit changing files under the
+// touched prefixes
+func lintCommit(commit, subject string, touched map[string]bool, names map[string]string) []Finding {
+	prefixes := make([]string, 0, len(touched))
+	for prefix := range touched {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var findings []Finding
+	if len(prefixes) > 1 {
+		findings = append(findings, Finding{
+			Check:    CheckCrossSubtree,
+			Severity: config.SeverityError,
+			Commit:   commit,
+			Subject:  subject,
+			Prefixes: prefixes,
+			Message:  fmt.Sprintf("changes the subtrees %s, split it into a commit for each", strings.Join(prefixes, ", ")),
+		})
+	}
+	for _, prefix := range prefixes {
+		if _, ok := names[prefix]; !ok {
+			findings = append(findings, Finding{
+				Check:    CheckUnconfigured,
+				Severity: config.SeverityWarning,
+				Commit:   commit,
+				Subject:  subject,
+				Prefixes: []string{prefix},
+				Message:  fmt.Sprintf("changes %s, a subtree in the history that isn't configured", prefix),
+			})
+		}
+	}
+	return findings
+}
+
+// prefixOf returns the configured or unconfigured prefix path is under,
+// preferring the longest
+func prefixOf(path string, names map[string]string, unconfigured []string) string {
+	var match string
+	under := func(prefix string) {
+		if (path == prefix || strings.HasPrefix(path, prefix+"/")) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	for prefix := range names {
+		under(prefix)
+	}
+	for _, prefix := range unconfigured {
+		under(prefix)
+	}
+	return match
+}
+
+// Diverged checks that the fetched upstream branch of the subtree still
+// contains the upstream commit last merged into ref. It returns nil if it
+// does or the subtree was never synced.
+func (g *Git) Diverged(subtree config.SubtreeConfig, reader history.Reader, ref string) (*Finding, error) {
+	sync, err := reader.GetLastSync(ref, subtree.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	if sync.Upstream == "" {
+		return nil, nil
+	}
+	upstream, err := g.revParse(UpstreamRef(subtree))
+	if err != nil {
+		return nil, fmt.Errorf("%s hasn't been fetched", subtree.Name)
+	}
+	// The fetch brings every commit of the upstream branch, so a missing
+	// commit isn't on it either
+	if g.hasCommit(sync.Upstream) {
+		if _, err := g.git("merge-base", "--is-ancestor", sync.Upstream, upstream); err == nil {
+			return nil, nil
+		}
+	}
+
+	branch := subtree.Branch
+	if branch == "" {
+		branch = "the default branch"
+	}
+	return &Finding{
+		Check:    CheckDiverged,
+		Severity: config.SeverityError,
+		Prefixes: []string{strings.Trim(subtree.Prefix, "/")},
+		Message: fmt.Sprintf("%s of %s no longer contains %.12s, last merged into %s, and may have been force-pushed",
+			branch, subtree.Repository, sync.Upstream, strings.Trim(subtree.Prefix, "/")),
+	}, nil
+}
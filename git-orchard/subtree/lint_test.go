@@ -0,0 +1,103 @@
+package subtree
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/history"
+)
+
+// checks returns the check and prefixes of each finding
+func checks(findings []Finding) [][]string {
+	var result [][]string
+	for _, finding := range findings {
+		result = append(result, append([]string{string(finding.Check)}, finding.Prefixes...))
+	}
+	return result
+}
+
+func TestLint(t *testing.T) {
+	mainline, _, subtree := setup(t)
+	g := newQuietGit(mainline)
+	if err := g.Add(subtree, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	other := config.SubtreeConfig{Name: "other", Repository: subtree.Repository, Prefix: "other"}
+	if err := g.Add(other, Options{Squash: true}); err != nil {
+		t.Fatal(err)
+	}
+	unconfigured := config.SubtreeConfig{Name: "old", Repository: subtree.Repository, Prefix: "vendor/old"}
+	if err := g.Add(unconfigured, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	base := git(t, mainline, "rev-parse", "HEAD")
+
+	commitFile(t, mainline, "lib/ONE.md", "one\n")
+	commitFile(t, mainline, "README.md", "changed\n")
+	// A commit changing two subtrees
+	for _, name := range []string{"lib/TWO.md", "other/TWO.md"} {
+		if err := os.WriteFile(filepath.Join(mainline, name), []byte("two\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git(t, mainline, "add", ".")
+	git(t, mainline, "commit", "-q", "-m", "Change lib and other")
+	commitFile(t, mainline, "vendor/old/OLD.md", "old\n")
+
+	findings, err := g.Lint([]config.SubtreeConfig{subtree, other}, history.NewGitHistoryReader(mainline), base+"..HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{string(CheckUnconfigured), "vendor/old"},
+		{string(CheckCrossSubtree), "lib", "other"},
+	}
+	if !reflect.DeepEqual(checks(findings), expected) {
+		t.Errorf("Expected findings %v, got %v", expected, findings)
+	}
+
+	// The upstream histories merged by the adds aren't linted
+	findings, err = g.Lint([]config.SubtreeConfig{subtree, other}, history.NewGitHistoryReader(mainline), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("Expected no findings before %s, got %v", base, findings)
+	}
+}
+
+func TestDiverged(t *testing.T) {
+	mainline, upstream, subtree := setup(t)
+	g := newQuietGit(mainline)
+	reader := history.NewGitHistoryReader(mainline)
+	if err := g.Add(subtree, Options{Squash: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	commitFile(t, upstream, "NEW.md", "new\n")
+	git(t, upstream, "push", "-q", "bare", "trunk")
+	if _, err := g.Fetch(subtree); err != nil {
+		t.Fatal(err)
+	}
+	if finding, err := g.Diverged(subtree, reader, "HEAD"); err != nil || finding != nil {
+		t.Fatalf("Expected an upstream ahead to not diverge, got %v (%v)", finding, err)
+	}
+
+	// Replace the upstream history, including the commit that was added
+	git(t, upstream, "checkout", "-q", "--orphan", "rewritten")
+	git(t, upstream, "commit", "-q", "-m", "Rewritten")
+	git(t, upstream, "push", "-q", "--force", "bare", "rewritten:trunk")
+	if _, err := g.Fetch(subtree); err != nil {
+		t.Fatal(err)
+	}
+	finding, err := g.Diverged(subtree, reader, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finding == nil || finding.Check != CheckDiverged {
+		t.Errorf("Expected a force-pushed upstream to diverge, got %v", finding)
+	}
+}
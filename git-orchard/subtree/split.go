@@ -0,0 +1,552 @@
+package subtree
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/history"
+)
+
+// cacheHeader starts every split cache file, so that a change in format
+// discards old caches
+const cacheHeader = "# git-orchard split cache v1"
+
+// noTree marks a mainline commit without the prefix in the split cache
+const noTree = "-"
+
+// SplitRef is the ref holding the last split of a subtree, which keeps the
+// split commits in its cache from being garbage collected
+func SplitRef(subtree config.SubtreeConfig) string {
+	return "refs/orchard/split/" + subtree.Name
+}
+
+// splitter splits the history of a prefix like git subtree split does,
+// creating the same commits, but keeps the mapping from mainline commits to
+// split commits in a cache under .git/orchard so that later splits only
+// process new commits
+type splitter struct {
+	g       *Git
+	subtree config.SubtreeConfig
+	prefix  string
+	path    string
+
+	// splits maps mainline commits to their split, or to noTree
+	splits map[string]string
+	// head is the mainline commit the cache was last updated for
+	head string
+	// created counts the commits processed by this split
+	created int
+
+	info     *catFile
+	contents *catFile
+}
+
+// SplitCached splits the history of the subtree's prefix at rev like git
+// subtree split, using and updating the cache under .git/orchard. The cache
+// is rebuilt when rev doesn't descend from the last split, which happens
+// after history is rewritten.
+func (g *Git) SplitCached(subtree config.SubtreeConfig, rev string) (string, error) {
+	commonDir, err := g.git("rev-parse", "--path-format=absolute", "--git-common-dir")
+	if err != nil {
+		return "", err
+	}
+	head, err := g.revParse(rev)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a commit", rev)
+	}
+
+	s := &splitter{
+		g:       g,
+		subtree: subtree,
+		prefix:  strings.Trim(subtree.Prefix, "/"),
+		path:    filepath.Join(commonDir, "orchard", "split", url.PathEscape(strings.Trim(subtree.Prefix, "/"))),
+	}
+	if s.info, err = newCatFile(g.dir, "--batch-check"); err != nil {
+		return "", err
+	}
+	defer s.info.Close()
+	if s.contents, err = newCatFile(g.dir, "--batch"); err != nil {
+		return "", err
+	}
+	defer s.contents.Close()
+
+	s.load(head)
+	split, err := s.split(head)
+	if err != nil {
+		return "", err
+	}
+	log.Debugf("Split %s at %s into %s, processing %d commits", s.prefix, head, split, s.created)
+
+	if err := s.save(head); err != nil {
+		log.Warnf("Failed to save the split cache of %s: %v", s.prefix, err)
+	} else if _, err := g.git("update-ref", "-m", "git orchard split", SplitRef(subtree), split); err != nil {
+		log.Warnf("Failed to update %s: %v", SplitRef(subtree), err)
+	}
+	return split, nil
+}
+
+// load reads the cache, discarding it if it's not for an ancestor of head
+// or its splits are gone
+func (s *splitter) load(head string) {
+	s.splits = make(map[string]string)
+	f, err := os.Open(s.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || scanner.Text() != cacheHeader {
+		log.Debugf("Discarding the split cache of %s with an unknown format", s.prefix)
+		return
+	}
+	splits := make(map[string]string)
+	var cachedHead string
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if fields[0] == "head" {
+			cachedHead = fields[1]
+			continue
+		}
+		splits[fields[0]] = fields[1]
+	}
+	if scanner.Err() != nil || cachedHead == "" {
+		return
+	}
+
+	if cachedHead != head {
+		if _, err := s.g.git("merge-base", "--is-ancestor", cachedHead, head); err != nil {
+			log.Debugf("Discarding the split cache of %s since %s doesn't descend from %s", s.prefix, head, cachedHead)
+			return
+		}
+	}
+	if split := splits[cachedHead]; split != "" && split != noTree && !s.exists(split) {
+		log.Debugf("Discarding the split cache of %s since %s is gone", s.prefix, split)
+		return
+	}
+	s.splits = splits
+	s.head = cachedHead
+}
+
+// save writes the cache for head
+func (s *splitter) save(head string) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), ".split-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, cacheHeader)
+	fmt.Fprintf(w, "head %s\n", head)
+	for commit, split := range s.splits {
+		fmt.Fprintf(w, "%s %s\n", commit, split)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// split returns the split of head, processing the commits that aren't cached
+func (s *splitter) split(head string) (string, error) {
+	events, err := history.NewGitHistoryReader(s.g.dir).GetSubtreeEvents(head)
+	if err != nil {
+		return "", err
+	}
+
+	// Like git subtree, splits recorded by adds, rejoins and squashes are
+	// used as they are, and the history before them isn't walked
+	args := []string{"rev-list", "--topo-order", "--reverse", "--parents", head}
+	for _, event := range events[s.prefix] {
+		if event.SquashCommit != "" && event.Mainline == "" {
+			s.splits[event.SquashCommit] = event.Split
+		}
+		if event.Mainline != "" {
+			if event.SquashCommit != "" {
+				s.splits[event.SquashCommit] = event.Split
+			}
+			s.splits[event.Mainline] = event.Split
+			s.splits[event.Split] = event.Split
+			for _, commit := range []string{event.Mainline, event.Split} {
+				if s.exists(commit + "^") {
+					args = append(args, "^"+commit+"^")
+				}
+			}
+		}
+	}
+	if s.head != "" {
+		args = append(args, "^"+s.head)
+	}
+
+	output, err := s.g.git(args...)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if _, err := s.process(fields[0], fields[1:]); err != nil {
+			return "", err
+		}
+	}
+
+	split, ok := s.splits[head]
+	if !ok {
+		if split, err = s.process(head, nil); err != nil {
+			return "", err
+		}
+	}
+	if split == noTree || split == "" || split == head {
+		return "", fmt.Errorf("%s doesn't exist in %s", s.prefix, head)
+	}
+	return split, nil
+}
+
+// process splits a commit whose parents have been split, or splits them
+// first if they haven't. parents are looked up if nil.
+func (s *splitter) process(commit string, parents []string) (string, error) {
+	if split, ok := s.splits[commit]; ok {
+		return split, nil
+	}
+
+	// Commits are split after their parents, with a stack rather than
+	// recursion since histories can be long
+	stack := []string{commit}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		if _, ok := s.splits[current]; ok {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		currentParents := parents
+		if current != commit || parents == nil {
+			var err error
+			if currentParents, err = s.parents(current); err != nil {
+				return "", err
+			}
+		}
+		pending := false
+		for _, parent := range currentParents {
+			if _, ok := s.splits[parent]; !ok {
+				stack = append(stack, parent)
+				pending = true
+			}
+		}
+		if pending {
+			continue
+		}
+		if err := s.processCommit(current, currentParents); err != nil {
+			return "", err
+		}
+		stack = stack[:len(stack)-1]
+	}
+	return s.splits[commit], nil
+}
+
+// processCommit splits a commit whose parents have all been split
+func (s *splitter) processCommit(commit string, parents []string) error {
+	s.created++
+	var newParents []string
+	for _, parent := range parents {
+		if split := s.splits[parent]; split != noTree {
+			newParents = append(newParents, split)
+		}
+	}
+
+	tree, err := s.subtreeOf(commit)
+	if err != nil {
+		return err
+	}
+	if tree == "" {
+		// Like git subtree, a mainline commit after the subtree's history
+		// stands for itself
+		if len(newParents) > 0 {
+			s.splits[commit] = commit
+		} else {
+			s.splits[commit] = noTree
+		}
+		return nil
+	}
+
+	split, err := s.copyOrSkip(commit, tree, newParents)
+	if err != nil {
+		return err
+	}
+	s.splits[commit] = split
+	return nil
+}
+
+// copyOrSkip reuses a parent with the same tree as the split of commit, or
+// creates a split commit, following git subtree's copy_or_skip
+func (s *splitter) copyOrSkip(commit, tree string, newParents []string) (string, error) {
+	var identical, nonIdentical string
+	var unique []string
+	copyCommit := false
+	for _, parent := range newParents {
+		parentTree, err := s.treeOf(parent)
+		if err != nil {
+			return "", err
+		}
+		if parentTree == "" {
+			continue
+		}
+		if parentTree == tree {
+			if identical == "" {
+				identical = parent
+			} else {
+				mergeBase, err := s.g.git("merge-base", identical, parent)
+				if err != nil {
+					mergeBase = ""
+				}
+				if mergeBase == identical {
+					identical = parent
+				} else if mergeBase != parent {
+					copyCommit = true
+				}
+			}
+		} else {
+			nonIdentical = parent
+		}
+
+		duplicate := false
+		for _, p := range unique {
+			if p == parent {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			unique = append(unique, parent)
+		}
+	}
+
+	if identical != "" && nonIdentical != "" {
+		extras, err := s.g.count("rev-list", "--count", identical+".."+nonIdentical)
+		if err != nil {
+			return "", err
+		}
+		if extras != 0 {
+			copyCommit = true
+		}
+	}
+	if identical != "" && !copyCommit {
+		return identical, nil
+	}
+	return s.copyCommit(commit, tree, unique)
+}
+
+// copyCommit creates a commit with tree and parents and the message,
+// author and committer of commit
+func (s *splitter) copyCommit(commit, tree string, parents []string) (string, error) {
+	content, err := s.contents.read(commit)
+	if err != nil {
+		return "", err
+	}
+	headers, message, _ := strings.Cut(string(content), "\n\n")
+
+	env := os.Environ()
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		var role string
+		switch key {
+		case "author":
+			role = "AUTHOR"
+		case "committer":
+			role = "COMMITTER"
+		default:
+			continue
+		}
+		name, email, date, err := parseIdent(value)
+		if err != nil {
+			return "", fmt.Errorf("commit %s: %w", commit, err)
+		}
+		env = append(env,
+			"GIT_"+role+"_NAME="+name,
+			"GIT_"+role+"_EMAIL="+email,
+			"GIT_"+role+"_DATE="+date,
+		)
+	}
+
+	args := []string{"commit-tree", tree}
+	for _, parent := range parents {
+		args = append(args, "-p", parent)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = s.g.dir
+	cmd.Env = env
+	cmd.Stdin = strings.NewReader(message)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to copy commit %s: %w", commit, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// parseIdent splits an author or committer header into its name, email and
+// date in git's internal format
+func parseIdent(ident string) (name, email, date string, err error) {
+	open := strings.LastIndex(ident, " <")
+	closing := strings.LastIndex(ident, "> ")
+	if open < 0 || closing < open {
+		return "", "", "", fmt.Errorf("invalid ident %q", ident)
+	}
+	return strings.TrimSpace(ident[:open]), ident[open+2 : closing], "@" + ident[closing+2:], nil
+}
+
+// parents returns the parents of commit
+func (s *splitter) parents(commit string) ([]string, error) {
+	content, err := s.contents.read(commit)
+	if err != nil {
+		return nil, err
+	}
+	var parents []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			break
+		}
+		if parent, ok := strings.CutPrefix(line, "parent "); ok {
+			parents = append(parents, parent)
+		}
+	}
+	return parents, nil
+}
+
+// subtreeOf returns the tree at the prefix of commit, or "" if there's
+// none. Submodules at the prefix are ignored, as they are by git subtree.
+func (s *splitter) subtreeOf(commit string) (string, error) {
+	hash, kind, err := s.info.info(commit + ":" + s.prefix)
+	if err != nil || kind != "tree" {
+		return "", err
+	}
+	return hash, nil
+}
+
+// treeOf returns the root tree of a split commit, fetching it from the
+// subtree's repository if it's missing, as squashes refer to upstream
+// commits that may not have been fetched
+func (s *splitter) treeOf(commit string) (string, error) {
+	hash, kind, err := s.info.info(commit + "^{tree}")
+	if err != nil {
+		return "", err
+	}
+	if kind == "tree" {
+		return hash, nil
+	}
+	if s.subtree.Repository == "" {
+		return "", fmt.Errorf("split commit %s is missing", commit)
+	}
+	log.Debugf("Fetching the missing split commit %s from %s", commit, s.subtree.Repository)
+	cmd := exec.Command("git", "fetch", "--quiet", "--no-tags", "--no-write-fetch-head", s.subtree.Repository, commit)
+	cmd.Dir = s.g.dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("split commit %s is missing and couldn't be fetched: %w: %s", commit, err, strings.TrimSpace(string(output)))
+	}
+	if hash, kind, err = s.info.info(commit + "^{tree}"); err != nil || kind != "tree" {
+		return "", fmt.Errorf("split commit %s is missing", commit)
+	}
+	return hash, nil
+}
+
+func (s *splitter) exists(rev string) bool {
+	_, kind, err := s.info.info(rev)
+	return err == nil && kind != ""
+}
+
+// catFile is a long-running git cat-file process
+type catFile struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func newCatFile(dir, mode string) (*catFile, error) {
+	cmd := exec.Command("git", "cat-file", mode)
+	cmd.Dir = dir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+	return &catFile{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// header requests an object and reads the header of the reply. kind is ""
+// for a missing object.
+func (c *catFile) header(rev string) (hash, kind string, size int, err error) {
+	if _, err := fmt.Fprintln(c.stdin, rev); err != nil {
+		return "", "", 0, err
+	}
+	line, err := c.stdout.ReadString('\n')
+	if err != nil {
+		return "", "", 0, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		// <rev> missing, or ambiguous
+		return "", "", 0, nil
+	}
+	size, err = strconv.Atoi(fields[2])
+	return fields[0], fields[1], size, err
+}
+
+// info returns the hash and type of an object
+func (c *catFile) info(rev string) (hash, kind string, err error) {
+	hash, kind, _, err = c.header(rev)
+	return hash, kind, err
+}
+
+// read returns the contents of an object
+func (c *catFile) read(rev string) ([]byte, error) {
+	_, kind, size, err := c.header(rev)
+	if err != nil {
+		return nil, err
+	}
+	if kind == "" {
+		return nil, fmt.Errorf("object %s is missing", rev)
+	}
+	content := make([]byte, size+1)
+	if _, err := io.ReadFull(c.stdout, content); err != nil {
+		return nil, err
+	}
+	return content[:size], nil
+}
+
+func (c *catFile) Close() error {
+	c.stdin.Close()
+	err := c.cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,214 @@
+package subtree
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmelahman/git-orchard/config"
+)
+
+// subtreeSplit returns the split of git subtree itself
+func subtreeSplit(t testing.TB, dir, prefix string) string {
+	t.Helper()
+	return lastField(git(t, dir, "subtree", "split", "--prefix", prefix, "HEAD"))
+}
+
+func lastField(output string) string {
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+func checkSplit(t *testing.T, g *Git, mainline string, subtree config.SubtreeConfig) {
+	t.Helper()
+	split, err := g.SplitCached(subtree, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := subtreeSplit(t, mainline, subtree.Prefix); split != expected {
+		t.Errorf("Expected the split of git subtree %s, got %s", expected, split)
+	}
+}
+
+func TestSplitCached(t *testing.T) {
+	for _, squash := range []bool{false, true} {
+		name := "merge"
+		if squash {
+			name = "squash"
+		}
+		t.Run(name, func(t *testing.T) {
+			mainline, upstream, subtree := setup(t)
+			g := newQuietGit(mainline)
+			if err := g.Add(subtree, Options{Squash: squash}); err != nil {
+				t.Fatal(err)
+			}
+			commitFile(t, mainline, "lib/LOCAL.md", "local\n")
+			commitFile(t, mainline, "OTHER.md", "other\n")
+			checkSplit(t, g, mainline, subtree)
+
+			// A branch touching the prefix merged into the mainline
+			git(t, mainline, "checkout", "-q", "-b", "topic", "HEAD^")
+			commitFile(t, mainline, "lib/TOPIC.md", "topic\n")
+			git(t, mainline, "checkout", "-q", "main")
+			commitFile(t, mainline, "lib/MAIN.md", "main\n")
+			git(t, mainline, "merge", "-q", "--no-edit", "topic")
+			checkSplit(t, g, mainline, subtree)
+
+			// Upstream changes
+			commitFile(t, upstream, "NEW.md", "new\n")
+			git(t, upstream, "push", "-q", "bare", "trunk")
+			if err := g.Pull(subtree, Options{Squash: squash}); err != nil {
+				t.Fatal(err)
+			}
+			commitFile(t, mainline, "lib/AFTER.md", "after\n")
+			checkSplit(t, g, mainline, subtree)
+
+			// A rejoined split
+			if _, err := g.Split(subtree, SplitOptions{Rejoin: true, Squash: squash}); err != nil {
+				t.Fatal(err)
+			}
+			commitFile(t, mainline, "lib/REJOINED.md", "rejoined\n")
+			checkSplit(t, g, mainline, subtree)
+		})
+	}
+}
+
+func TestSplitCacheInvalidation(t *testing.T) {
+	mainline, _, subtree := setup(t)
+	g := newQuietGit(mainline)
+	if err := g.Add(subtree, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, mainline, "lib/ONE.md", "one\n")
+	if _, err := g.SplitCached(subtree, "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if split := git(t, mainline, "rev-parse", SplitRef(subtree)); split != subtreeSplit(t, mainline, "lib") {
+		t.Errorf("Expected %s at the split, got %s", SplitRef(subtree), split)
+	}
+
+	// Point the cached head at another split, which later splits build on
+	// while the mainline descends from it
+	path := filepath.Join(mainline, ".git", "orchard", "split", "lib")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := git(t, mainline, "rev-parse", "HEAD")
+	stale := git(t, mainline, "rev-parse", "HEAD^^2")
+	cache := strings.ReplaceAll(string(content), head+" "+subtreeSplit(t, mainline, "lib"), head+" "+stale)
+	if err := os.WriteFile(path, []byte(cache), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, mainline, "lib/TWO.md", "two\n")
+	split, err := g.SplitCached(subtree, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent := git(t, mainline, "rev-parse", split+"^"); parent != stale {
+		t.Errorf("Expected the cached split %s to be reused, got %s", stale, parent)
+	}
+
+	// Rewriting the history discards the cache
+	git(t, mainline, "reset", "-q", "--hard", "HEAD~2")
+	commitFile(t, mainline, "lib/THREE.md", "three\n")
+	checkSplit(t, g, mainline, subtree)
+
+	// So does a different format
+	if err := os.WriteFile(path, []byte("# another format\nhead "+head+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checkSplit(t, g, mainline, subtree)
+}
+
+func TestSplitCachedMissingPrefix(t *testing.T) {
+	mainline, _, subtree := setup(t)
+	if _, err := newQuietGit(mainline).SplitCached(subtree, "HEAD"); err == nil {
+		t.Error("Expected an error splitting a missing prefix")
+	}
+}
+
+// generateRepo creates a repository with the given number of commits,
+// every other one changing a file under lib
+func generateRepo(b *testing.B, commits int) (string, config.SubtreeConfig) {
+	b.Helper()
+	for _, name := range []string{"GIT_DIR", "GIT_WORK_TREE"} {
+		b.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	for _, name := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		b.Setenv(name+"_NAME", "test")
+		b.Setenv(name+"_EMAIL", "test@example.com")
+	}
+	dir := b.TempDir()
+	git(b, dir, "init", "-q", "-b", "main")
+
+	var stream strings.Builder
+	for i := 1; i <= commits; i++ {
+		path := fmt.Sprintf("src/%d.txt", i%10)
+		if i%2 == 0 {
+			path = fmt.Sprintf("lib/%d.txt", i%10)
+		}
+		message := fmt.Sprintf("Commit %d\n", i)
+		fmt.Fprintf(&stream, "commit refs/heads/main\nmark :%d\n", i)
+		fmt.Fprintf(&stream, "committer test <test@example.com> %d +0000\n", 1700000000+i)
+		fmt.Fprintf(&stream, "data %d\n%s", len(message), message)
+		content := fmt.Sprintf("%d\n", i)
+		fmt.Fprintf(&stream, "M 644 inline %s\ndata %d\n%s\n", path, len(content), content)
+	}
+	cmd := exec.Command("git", "fast-import", "--quiet")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(stream.String())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		b.Fatalf("git fast-import: %v\n%s", err, output)
+	}
+	git(b, dir, "checkout", "-q", "main")
+	return dir, config.SubtreeConfig{Name: "lib", Prefix: "lib"}
+}
+
+// BenchmarkSplit compares git subtree split with a split from an empty
+// cache and one of a single new commit after the cache is filled
+func BenchmarkSplit(b *testing.B) {
+	dir, subtree := generateRepo(b, 500)
+	g := newQuietGit(dir)
+	expected := subtreeSplit(b, dir, subtree.Prefix)
+
+	b.Run("git-subtree", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			subtreeSplit(b, dir, subtree.Prefix)
+		}
+	})
+	b.Run("cold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := os.RemoveAll(filepath.Join(dir, ".git", "orchard")); err != nil {
+				b.Fatal(err)
+			}
+			split, err := g.SplitCached(subtree, "HEAD")
+			if err != nil {
+				b.Fatal(err)
+			}
+			if split != expected {
+				b.Fatalf("Expected the split of git subtree %s, got %s", expected, split)
+			}
+		}
+	})
+	b.Run("incremental", func(b *testing.B) {
+		if _, err := g.SplitCached(subtree, "HEAD"); err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			git(b, dir, "commit", "-q", "--allow-empty", "-m", "Empty")
+			b.StartTimer()
+			if _, err := g.SplitCached(subtree, "HEAD"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
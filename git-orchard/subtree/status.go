@@ -0,0 +1,98 @@
+package subtree
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/history"
+)
+
+// Status is how a subtree compares with its upstream branch
+type Status struct {
+	Name       string `json:"name"`
+	Prefix     string `json:"prefix"`
+	Repository string `json:"repository"`
+	Branch     string `json:"branch"`
+	// Upstream is the fetched head of the upstream branch
+	Upstream string `json:"upstream"`
+	// Synced is the upstream commit last merged or split, if any
+	Synced string `json:"synced,omitempty"`
+	// Behind is the number of upstream commits that haven't been pulled
+	Behind int `json:"behind"`
+	// Ahead is the number of commits of the split of the prefix that the
+	// upstream branch doesn't have, which are pushed by git orchard push
+	Ahead int `json:"ahead"`
+}
+
+// Status compares the subtree in ref with its upstream branch, which must
+// have been fetched
+func (g *Git) Status(subtree config.SubtreeConfig, reader history.Reader, ref string) (Status, error) {
+	status := Status{
+		Name:       subtree.Name,
+		Prefix:     subtree.Prefix,
+		Repository: subtree.Repository,
+		Branch:     subtree.Branch,
+	}
+	upstream, err := g.revParse(UpstreamRef(subtree))
+	if err != nil {
+		return status, fmt.Errorf("upstream of %s hasn't been fetched", subtree.Name)
+	}
+	status.Upstream = upstream
+
+	sync, err := reader.GetLastSync(ref, subtree.Prefix)
+	if err != nil {
+		return status, err
+	}
+	status.Synced = sync.Upstream
+
+	// Upstream commits that are neither merged into ref nor part of the
+	// last squashed merge
+	behind := []string{"rev-list", "--count", upstream, "--not", ref}
+	if sync.Upstream != "" && g.hasCommit(sync.Upstream) {
+		behind = append(behind, sync.Upstream)
+	}
+	if status.Behind, err = g.count(behind...); err != nil {
+		return status, err
+	}
+
+	// Split commits that aren't on the upstream branch. Splitting updates
+	// the cached split in SplitRef, like pushing does.
+	split, err := g.SplitCached(subtree, ref)
+	if err != nil {
+		return status, err
+	}
+	if status.Ahead, err = g.count("rev-list", "--count", "--no-merges", split, "--not", upstream); err != nil {
+		return status, err
+	}
+	return status, nil
+}
+
+func (g *Git) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (g *Git) revParse(rev string) (string, error) {
+	return g.git("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+}
+
+func (g *Git) hasCommit(rev string) bool {
+	_, err := g.revParse(rev)
+	return err == nil
+}
+
+func (g *Git) count(args ...string) (int, error) {
+	output, err := g.git(args...)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(output)
+}
@@ -0,0 +1,75 @@
+package subtree
+
+import (
+	"testing"
+
+	"github.com/jmelahman/git-orchard/config"
+	"github.com/jmelahman/git-orchard/history"
+)
+
+func configOf(status Status) config.SubtreeConfig {
+	return config.SubtreeConfig{Name: status.Name, Repository: status.Repository, Prefix: status.Prefix, Branch: status.Branch}
+}
+
+func checkStatus(t *testing.T, g *Git, mainline string, subtree Status, behind, ahead int) {
+	t.Helper()
+	status, err := g.Status(configOf(subtree), history.NewGitHistoryReader(mainline), "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Behind != behind || status.Ahead != ahead {
+		t.Errorf("Expected %d behind and %d ahead, got %d behind and %d ahead", behind, ahead, status.Behind, status.Ahead)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	for _, squash := range []bool{false, true} {
+		name := "merge"
+		if squash {
+			name = "squash"
+		}
+		t.Run(name, func(t *testing.T) {
+			mainline, upstream, subtree := setup(t)
+			g := newQuietGit(mainline)
+			if err := g.Add(subtree, Options{Squash: squash}); err != nil {
+				t.Fatal(err)
+			}
+			status := Status{Name: subtree.Name, Prefix: subtree.Prefix, Repository: subtree.Repository}
+
+			if _, err := g.Fetch(subtree); err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, g, mainline, status, 0, 0)
+
+			// Two upstream commits and one local commit under the prefix
+			commitFile(t, upstream, "ONE.md", "one\n")
+			commitFile(t, upstream, "TWO.md", "two\n")
+			git(t, upstream, "push", "-q", "bare", "trunk")
+			commitFile(t, mainline, "lib/LOCAL.md", "local\n")
+			commitFile(t, mainline, "OTHER.md", "other\n")
+			if _, err := g.Fetch(subtree); err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, g, mainline, status, 2, 1)
+
+			if err := g.Pull(subtree, Options{Squash: squash}); err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, g, mainline, status, 0, 1)
+
+			// A rejoined split is still ahead until it's pushed
+			if _, err := g.Split(subtree, SplitOptions{Rejoin: true, Squash: squash}); err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, g, mainline, status, 0, 1)
+
+			if err := g.Push(subtree); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := g.Fetch(subtree); err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, g, mainline, status, 0, 0)
+		})
+	}
+}
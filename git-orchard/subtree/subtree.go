@@ -0,0 +1,252 @@
+// Package subtree runs git subtree commands for configured subtrees
+package subtree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jmelahman/git-orchard/config"
+)
+
+// Options configures how a subtree is merged
+type Options struct {
+	// Squash merges the upstream history as a single commit
+	Squash bool
+	// Message is the message of the merge commit
+	Message string
+}
+
+// SplitOptions configures a split
+type SplitOptions struct {
+	// Branch is created or updated with the split history
+	Branch string
+	// Rejoin merges the split history back into the mainline
+	Rejoin bool
+	// Squash squashes the history merged by Rejoin
+	Squash bool
+}
+
+// Git runs git subtree in a repository
+type Git struct {
+	dir    string
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// NewGit creates a new Git for the repository at dir, which defaults to the
+// current directory. Output of git is forwarded to stdout and stderr.
+func NewGit(dir string) *Git {
+	if dir == "" {
+		dir = "."
+	}
+	return &Git{dir: dir, stdout: os.Stdout, stderr: os.Stderr}
+}
+
+// SetOutput sets where the output of git is written
+func (g *Git) SetOutput(stdout, stderr io.Writer) {
+	g.stdout = stdout
+	g.stderr = stderr
+}
+
+// Add adds the subtree at its prefix from its repository
+func (g *Git) Add(subtree config.SubtreeConfig, opts Options) error {
+	branch, err := g.Branch(subtree)
+	if err != nil {
+		return err
+	}
+	args := []string{"add", "--prefix", subtree.Prefix}
+	args = append(args, mergeArgs(opts)...)
+	args = append(args, subtree.Repository, branch)
+	return g.run(args...)
+}
+
+// Pull fetches the upstream branch of the subtree and merges it into its
+// prefix. The message defaults to "Update <prefix>".
+func (g *Git) Pull(subtree config.SubtreeConfig, opts Options) error {
+	if _, err := g.Fetch(subtree); err != nil {
+		return err
+	}
+	return g.Merge(subtree, UpstreamRef(subtree), opts)
+}
+
+// Merge merges rev, a commit of the upstream history, into the prefix of
+// the subtree. The message defaults to "Update <prefix>".
+func (g *Git) Merge(subtree config.SubtreeConfig, rev string, opts Options) error {
+	if opts.Message == "" {
+		opts.Message = fmt.Sprintf("Update %s", strings.Trim(subtree.Prefix, "/"))
+	}
+	args := []string{"merge", "--prefix", subtree.Prefix}
+	args = append(args, mergeArgs(opts)...)
+	// The repository lets git subtree fetch a squashed split it's missing
+	args = append(args, rev, subtree.Repository)
+	return g.run(args...)
+}
+
+// UpstreamRef is the ref the upstream branch of a subtree is fetched into
+func UpstreamRef(subtree config.SubtreeConfig) string {
+	return "refs/orchard/upstream/" + subtree.Name
+}
+
+// Fetch fetches the upstream branch of the subtree into its UpstreamRef and
+// returns the fetched commit
+func (g *Git) Fetch(subtree config.SubtreeConfig) (string, error) {
+	branch, err := g.Branch(subtree)
+	if err != nil {
+		return "", err
+	}
+	refspec := fmt.Sprintf("+%s:%s", branch, UpstreamRef(subtree))
+	// Fetches of several subtrees may run at once, so they leave FETCH_HEAD
+	// and garbage collection alone
+	cmd := exec.Command("git", "fetch", "--quiet", "--no-tags", "--no-write-fetch-head", "--no-auto-gc", subtree.Repository, refspec)
+	cmd.Dir = g.dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to fetch %s from %s: %w: %s", branch, subtree.Repository, err, strings.TrimSpace(string(output)))
+	}
+	return g.revParse(UpstreamRef(subtree))
+}
+
+// Push splits the history of the prefix and pushes it to the upstream
+// branch. The split is cached, so later pushes only split new commits.
+func (g *Git) Push(subtree config.SubtreeConfig) error {
+	branch, err := g.Branch(subtree)
+	if err != nil {
+		return err
+	}
+	split, err := g.SplitCached(subtree, "HEAD")
+	if err != nil {
+		return err
+	}
+	refspec := fmt.Sprintf("%s:refs/heads/%s", split, branch)
+	log.Debugf("Running: git push %s %s", subtree.Repository, refspec)
+	cmd := exec.Command("git", "push", subtree.Repository, refspec)
+	cmd.Dir = g.dir
+	cmd.Stdout = g.stdout
+	cmd.Stderr = g.stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to push %s to %s: %w", subtree.Prefix, subtree.Repository, err)
+	}
+	return nil
+}
+
+// Split extracts the history of the prefix and returns the resulting commit.
+// Splits without Rejoin are cached like those of Push.
+func (g *Git) Split(subtree config.SubtreeConfig, opts SplitOptions) (string, error) {
+	if !opts.Rejoin {
+		split, err := g.SplitCached(subtree, "HEAD")
+		if err != nil {
+			return "", err
+		}
+		if opts.Branch != "" {
+			if err := g.updateBranch(opts.Branch, split); err != nil {
+				return "", err
+			}
+		}
+		return split, nil
+	}
+
+	args := []string{"split", "--prefix", subtree.Prefix, "--rejoin"}
+	if opts.Branch != "" {
+		args = append(args, "--branch", opts.Branch)
+	}
+	if opts.Squash {
+		args = append(args, "--squash")
+	}
+
+	var stdout bytes.Buffer
+	cmd := g.command(args...)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git subtree split --prefix %s failed: %w", subtree.Prefix, err)
+	}
+	// The commit is the last line, after any progress from --rejoin
+	lines := strings.Fields(stdout.String())
+	if len(lines) == 0 {
+		return "", fmt.Errorf("git subtree split --prefix %s returned no commit", subtree.Prefix)
+	}
+	return lines[len(lines)-1], nil
+}
+
+// updateBranch points branch at split, which must descend from the
+// branch if it exists, as git subtree split --branch does
+func (g *Git) updateBranch(branch, split string) error {
+	ref := "refs/heads/" + branch
+	if g.hasCommit(ref) {
+		if _, err := g.git("merge-base", "--is-ancestor", ref, split); err != nil {
+			return fmt.Errorf("branch %s is not an ancestor of commit %s", branch, split)
+		}
+	}
+	_, err := g.git("update-ref", "-m", "git orchard split", ref, split)
+	return err
+}
+
+// Branch returns the upstream branch of the subtree, looking up the
+// default branch of its repository if none is configured
+func (g *Git) Branch(subtree config.SubtreeConfig) (string, error) {
+	if subtree.Branch != "" {
+		return subtree.Branch, nil
+	}
+	branch, err := DefaultBranch(g.dir, subtree.Repository)
+	if err != nil {
+		return "", fmt.Errorf("failed to find the default branch of %s: %w", subtree.Repository, err)
+	}
+	log.Debugf("Using default branch %s of %s", branch, subtree.Repository)
+	return branch, nil
+}
+
+// DefaultBranch returns the branch HEAD points to in the remote repository
+func DefaultBranch(dir, repository string) (string, error) {
+	cmd := exec.Command("git", "ls-remote", "--symref", repository, "HEAD")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if err != nil {
+		return "", err
+	}
+	// ref: refs/heads/main	HEAD
+	for _, line := range strings.Split(string(output), "\n") {
+		ref, ok := strings.CutPrefix(line, "ref:")
+		if !ok {
+			continue
+		}
+		ref, _, _ = strings.Cut(strings.TrimSpace(ref), "\t")
+		return strings.TrimPrefix(ref, "refs/heads/"), nil
+	}
+	return "", fmt.Errorf("remote HEAD is not a branch")
+}
+
+func mergeArgs(opts Options) []string {
+	var args []string
+	if opts.Squash {
+		args = append(args, "--squash")
+	}
+	if opts.Message != "" {
+		args = append(args, "--message", opts.Message)
+	}
+	return args
+}
+
+func (g *Git) command(args ...string) *exec.Cmd {
+	log.Debugf("Running: git subtree %s", strings.Join(args, " "))
+	cmd := exec.Command("git", append([]string{"subtree"}, args...)...)
+	cmd.Dir = g.dir
+	cmd.Stdout = g.stdout
+	cmd.Stderr = g.stderr
+	return cmd
+}
+
+func (g *Git) run(args ...string) error {
+	if err := g.command(args...).Run(); err != nil {
+		return fmt.Errorf("git subtree %s --prefix %s failed: %w", args[0], args[2], err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package subtree
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmelahman/git-orchard/config"
+)
+
+func git(t testing.TB, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func commitFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, dir, "add", name)
+	git(t, dir, "commit", "-q", "-m", "Change "+name)
+}
+
+// setup returns a mainline repository and a working copy of the bare
+// upstream repository it has a subtree of
+func setup(t *testing.T) (mainline, upstream string, subtree config.SubtreeConfig) {
+	t.Helper()
+	for _, name := range []string{"GIT_DIR", "GIT_WORK_TREE"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	// git subtree commits too, so the identity is set for every command
+	for _, name := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		t.Setenv(name+"_NAME", "test")
+		t.Setenv(name+"_EMAIL", "test@example.com")
+	}
+	root := t.TempDir()
+	upstream = filepath.Join(root, "upstream")
+	bare := filepath.Join(root, "upstream.git")
+	mainline = filepath.Join(root, "mainline")
+
+	git(t, root, "init", "-q", "-b", "trunk", upstream)
+	commitFile(t, upstream, "README.md", "upstream\n")
+	git(t, root, "clone", "-q", "--bare", upstream, bare)
+	git(t, upstream, "remote", "add", "bare", bare)
+
+	git(t, root, "init", "-q", "-b", "main", mainline)
+	commitFile(t, mainline, "README.md", "mainline\n")
+
+	subtree = config.SubtreeConfig{Name: "lib", Repository: bare, Prefix: "lib"}
+	return mainline, upstream, subtree
+}
+
+func newQuietGit(dir string) *Git {
+	g := NewGit(dir)
+	g.SetOutput(io.Discard, io.Discard)
+	return g
+}
+
+func TestDefaultBranch(t *testing.T) {
+	mainline, _, subtree := setup(t)
+
+	branch, err := DefaultBranch(mainline, subtree.Repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch != "trunk" {
+		t.Errorf("Expected default branch 'trunk', got '%s'", branch)
+	}
+}
+
+func TestAddPullPush(t *testing.T) {
+	mainline, upstream, subtree := setup(t)
+	g := newQuietGit(mainline)
+
+	if err := g.Add(subtree, Options{Squash: true}); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(mainline, "lib", "README.md")); err != nil || string(content) != "upstream\n" {
+		t.Fatalf("Expected lib/README.md to be added, got %q (%v)", content, err)
+	}
+
+	// Pull a new upstream commit
+	commitFile(t, upstream, "NEW.md", "new\n")
+	git(t, upstream, "push", "-q", "bare", "trunk")
+	if err := g.Pull(subtree, Options{Squash: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(mainline, "lib", "NEW.md")); err != nil {
+		t.Errorf("Expected lib/NEW.md to be pulled: %v", err)
+	}
+	if message := git(t, mainline, "log", "-1", "--format=%s"); message != "Update lib" {
+		t.Errorf("Expected default pull message 'Update lib', got '%s'", message)
+	}
+
+	// Push a local commit
+	commitFile(t, mainline, "lib/LOCAL.md", "local\n")
+	if err := g.Push(subtree); err != nil {
+		t.Fatal(err)
+	}
+	if files := git(t, subtree.Repository, "ls-tree", "--name-only", "trunk", "LOCAL.md"); files != "LOCAL.md" {
+		t.Errorf("Expected LOCAL.md to be pushed upstream, got '%s'", files)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	mainline, _, subtree := setup(t)
+	g := newQuietGit(mainline)
+	subtree.Branch = "trunk"
+
+	if err := g.Add(subtree, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, mainline, "lib/LOCAL.md", "local\n")
+
+	commit, err := g.Split(subtree, SplitOptions{Branch: "lib-split"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head := git(t, mainline, "rev-parse", "lib-split"); head != commit {
+		t.Errorf("Expected lib-split at %s, got %s", commit, head)
+	}
+	files := git(t, mainline, "ls-tree", "--name-only", commit)
+	if files != "LOCAL.md\nREADME.md" {
+		t.Errorf("Expected the split to contain the subtree's files, got %q", files)
+	}
+}
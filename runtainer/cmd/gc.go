@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jmelahman/runtainer/internal/image"
+	"github.com/spf13/cobra"
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove the layers no stored image references",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		removed, err := image.CollectGarbage()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Removed layers:", removed)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/jmelahman/runtainer/internal/runtime"
+
+	"github.com/spf13/cobra"
+)
+
+// initCmd is run by run in the container's namespaces
+var initCmd = &cobra.Command{
+	Use:    "init <container-dir>",
+	Short:  "Set up a container and exec its command",
+	Hidden: true,
+	// Its errors are from the container's setup, not its usage
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return exitStatus(runtime.Init(args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+}
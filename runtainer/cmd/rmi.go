@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jmelahman/runtainer/internal/image"
+	"github.com/spf13/cobra"
+)
+
+var rmiCmd = &cobra.Command{
+	Use:   "rmi <image-ref>",
+	Short: "Remove a stored image and the layers no other image uses",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageID, err := image.RemoveImage(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println("Removed image", imageID)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rmiCmd)
+}
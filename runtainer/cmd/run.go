@@ -1,29 +1,72 @@
 package cmd
 
 import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+
 	"github.com/jmelahman/runtainer/internal/image"
 	"github.com/jmelahman/runtainer/internal/runtime"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	runOpts       runtime.Options
+	runEntrypoint string
+)
+
 var runCmd = &cobra.Command{
-	Use:   "run <image-ref> -- <cmd> [args...]",
+	Use:   "run [flags] <image-ref> [--] [cmd] [args...]",
 	Short: "Run a command inside a container image",
-	Args:  cobra.MinimumNArgs(2),
+	Long: `Run a command inside a container image.
+
+The command defaults to the image's, and runs after its entrypoint, with its
+environment, working directory and user unless they're overridden.`,
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ref := args[0]
 		cmdArgs := args[1:]
+		// Without interspersed flags, the -- separating the command is kept
+		if len(cmdArgs) > 0 && cmdArgs[0] == "--" {
+			cmdArgs = cmdArgs[1:]
+		}
+
+		opts := runOpts
+		if cmd.Flags().Changed("entrypoint") {
+			opts.Entrypoint = &runEntrypoint
+		}
 
 		imageID, err := image.PullImage(ref)
 		if err != nil {
 			return err
 		}
 
-		return runtime.RunCommand(imageID, cmdArgs)
+		return exitStatus(runtime.RunCommand(imageID, cmdArgs, opts))
 	},
 }
 
+// exitStatus exits with the status of a command that exited unsuccessfully,
+// like a shell would, and returns other errors
+func exitStatus(err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		os.Exit(128 + int(status.Signal()))
+	}
+	os.Exit(exitErr.ExitCode())
+	return nil
+}
+
 func init() {
+	// Flags after the image belong to the command
+	runCmd.Flags().SetInterspersed(false)
+	runCmd.Flags().StringArrayVarP(&runOpts.Env, "env", "e", nil, "set an environment variable, NAME=value or NAME for the host's value")
+	runCmd.Flags().StringVarP(&runOpts.WorkingDir, "workdir", "w", "", "working directory inside the container")
+	runCmd.Flags().StringVarP(&runOpts.User, "user", "u", "", "user to run as, user[:group] by name or ID")
+	runCmd.Flags().StringVar(&runEntrypoint, "entrypoint", "", "overwrite the image's entrypoint, clearing its default command")
 	rootCmd.AddCommand(runCmd)
 }
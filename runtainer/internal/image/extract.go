@@ -1,95 +1,50 @@
 package image
 
 import (
-	"archive/tar"
 	"compress/gzip"
-	"crypto/sha256"
-	"encoding/hex"
 	"io"
 	"os"
 	"path/filepath"
 
-	"github.com/jmelahman/runtainer/internal/paths"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 )
 
+// ExtractImage stores an image from a tarball, as written by docker save or
+// crane pull, like PullImage stores a pulled one
 func ExtractImage(tarPath string) (string, error) {
-	file, err := os.Open(tarPath)
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		_ = file.Close()
-	}()
-
-	// Hash image tarball contents to get a stable ID
-	h := sha256.New()
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		return "", err
-	}
-	if _, err := io.Copy(h, file); err != nil {
-		return "", err
-	}
-	imageID := hex.EncodeToString(h.Sum(nil))[:12]
-
-	destDir := filepath.Join(paths.ImageDir(), imageID)
-	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return "", err
-	}
-
-	// Rewind again to extract
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		return "", err
-	}
-
-	var extractReader *tar.Reader
-	if filepath.Ext(tarPath) == ".gz" {
-		gzr, err := gzip.NewReader(file)
+	opener := func() (io.ReadCloser, error) {
+		file, err := os.Open(tarPath)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		defer func() {
-			_ = gzr.Close()
-		}()
-		extractReader = tar.NewReader(gzr)
-	} else {
-		extractReader = tar.NewReader(file)
-	}
-
-	for {
-		hdr, err := extractReader.Next()
-		if err == io.EOF {
-			break
+		if filepath.Ext(tarPath) != ".gz" {
+			return file, nil
 		}
+		gzr, err := gzip.NewReader(file)
 		if err != nil {
-			return "", err
+			_ = file.Close()
+			return nil, err
 		}
+		return &gzipFile{Reader: gzr, file: file}, nil
+	}
 
-		target := filepath.Join(destDir, hdr.Name)
-		switch hdr.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(target, 0755); err != nil {
-				return "", err
-			}
-		case tar.TypeReg:
-			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-				return "", err
-			}
-			out, err := os.Create(target)
-			if err != nil {
-				return "", err
-			}
-			if _, err := io.Copy(out, extractReader); err != nil {
-				_ = out.Close()
-				return "", err
-			}
-			if err := out.Close(); err != nil {
-				return "", err
-			}
-		}
+	image, err := tarball.Image(opener, nil)
+	if err != nil {
+		return "", err
 	}
+	return storeImage(image)
+}
 
-	// TODO: flatten to rootfsDir/imageID using layer tarballs
-	// e.g., apply layer blobs in manifest to create a rootfs
+// gzipFile reads a gzipped file, closing both when it's closed
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
 
-	return imageID, nil
+func (f *gzipFile) Close() error {
+	err := f.Reader.Close()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/jmelahman/runtainer/internal/paths"
 )
 
@@ -62,9 +64,7 @@ func PullImage(ref string) (string, error) {
 
 	if imageID, exists := cache.RefToID[ref]; exists {
 		// Check if the image files still exist
-		imageDir := filepath.Join(paths.ImageDir(), imageID)
-		rootfsDir := filepath.Join(paths.RootfsDir(), imageID)
-		if dirExists(imageDir) && dirExists(rootfsDir) {
+		if isStored(imageID) {
 			fmt.Println("Found cached image")
 			return imageID, nil
 		}
@@ -72,6 +72,11 @@ func PullImage(ref string) (string, error) {
 		delete(cache.RefToID, ref)
 	}
 
+	// A stored image can be run by its ID
+	if isImageID(ref) && isStored(ref) {
+		return ref, nil
+	}
+
 	// Image not in cache or files missing, pull from registry
 	descriptor, err := crane.Get(ref)
 	if err != nil {
@@ -83,66 +88,113 @@ func PullImage(ref string) (string, error) {
 		return "", err
 	}
 
+	imageID, err := storeImage(image)
+	if err != nil {
+		return "", err
+	}
+
+	// Update cache with new mapping
+	cache.RefToID[ref] = imageID
+	if err := saveImageCache(cache); err != nil {
+		return "", fmt.Errorf("failed to save image cache: %w", err)
+	}
+
+	return imageID, nil
+}
+
+// storeImage saves the config and manifest of the image and extracts the
+// layers that aren't in the layer store yet, unless the image is already
+// stored, and returns its ID
+func storeImage(image v1.Image) (string, error) {
 	manifest, err := image.Manifest()
 	if err != nil {
 		return "", err
 	}
 	imageID := manifest.Config.Digest.Hex[:12]
 
+	unlock, err := lockStore()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
 	// Skip if already exists (in case another process pulled it concurrently)
-	imageDir := filepath.Join(paths.ImageDir(), imageID)
-	rootfsDir := filepath.Join(paths.RootfsDir(), imageID)
-	if dirExists(imageDir) && dirExists(rootfsDir) {
+	if isStored(imageID) {
 		fmt.Println("Found cached image")
-	} else {
-		if err := os.MkdirAll(imageDir, 0755); err != nil {
-			return "", err
-		}
-		if err := os.MkdirAll(rootfsDir, 0755); err != nil {
-			return "", err
-		}
+		return imageID, nil
+	}
 
-		// Save config.json
-		cfg, err := image.ConfigFile()
-		if err != nil {
-			return "", err
-		}
-		cfgData, _ := json.MarshalIndent(cfg, "", "  ")
-		if err := os.WriteFile(filepath.Join(imageDir, "config.json"), cfgData, 0644); err != nil {
-			return "", err
+	layers, err := image.Layers()
+	if err != nil {
+		return "", err
+	}
+	diffIDs := make([]v1.Hash, len(layers))
+	for i, layer := range layers {
+		if diffIDs[i], err = layer.DiffID(); err != nil {
+			return "", fmt.Errorf("layer %d: %w", i, err)
 		}
-
-		// Save manifest.json
-		manifestData, _ := json.MarshalIndent(manifest, "", "  ")
-		if err := os.WriteFile(filepath.Join(imageDir, "manifest.json"), manifestData, 0644); err != nil {
-			return "", err
+	}
+	chains, err := chainIDs(diffIDs)
+	if err != nil {
+		return "", err
+	}
+	// Hard links may be to files of the layers below
+	var lower []string
+	for i, layer := range layers {
+		if err := storeLayer(layer, diffIDs[i], chains[i], lower); err != nil {
+			return "", fmt.Errorf("layer %d: %w", i, err)
 		}
+		lower = append([]string{storedLayerPath(diffIDs[i], chains[i])}, lower...)
+	}
 
-		// Extract rootfs
-		layers, err := image.Layers()
-		if err != nil {
-			return "", err
-		}
-		for i, layer := range layers {
-			r, err := layer.Uncompressed()
-			if err != nil {
-				return "", fmt.Errorf("layer %d: %w", i, err)
-			}
-			if err := untarInto(r, rootfsDir); err != nil {
-				return "", fmt.Errorf("extract layer %d: %w", i, err)
-			}
-		}
+	imageDir := filepath.Join(paths.ImageDir(), imageID)
+	if err := os.MkdirAll(imageDir, 0755); err != nil {
+		return "", err
 	}
 
-	// Update cache with new mapping
-	cache.RefToID[ref] = imageID
-	if err := saveImageCache(cache); err != nil {
-		return "", fmt.Errorf("failed to save image cache: %w", err)
+	// Save manifest.json
+	manifestData, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := os.WriteFile(filepath.Join(imageDir, "manifest.json"), manifestData, 0644); err != nil {
+		return "", err
 	}
 
+	// Save config.json last, as its diff IDs reference the layers
+	cfg, err := image.ConfigFile()
+	if err != nil {
+		return "", err
+	}
+	cfgData, _ := json.MarshalIndent(cfg, "", "  ")
+	if err := writeFileAtomic(filepath.Join(imageDir, "config.json"), cfgData); err != nil {
+		return "", err
+	}
 	return imageID, nil
 }
 
+// LoadConfig returns the config of a stored image
+func LoadConfig(imageID string) (*v1.ConfigFile, error) {
+	f, err := os.Open(filepath.Join(paths.ImageDir(), imageID, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return v1.ParseConfigFile(f)
+}
+
+// isImageID reports whether ref looks like the ID of a stored image
+func isImageID(ref string) bool {
+	if len(ref) != 12 {
+		return false
+	}
+	for _, c := range ref {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
 func dirExists(path string) bool {
 	info, err := os.Stat(path)
 	return err == nil && info.IsDir()
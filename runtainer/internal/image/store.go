@@ -0,0 +1,416 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/jmelahman/runtainer/internal/paths"
+	"golang.org/x/sys/unix"
+)
+
+// The layer store keeps every layer extracted once, in a directory of
+// LayerDir named by its diff ID, and an image's rootfs is an overlay of the
+// directories of its layers. A layer with hard links to files of the layers
+// below it gets copies of them, so it's named by its chain ID instead, which
+// identifies the layers below too. A layer is referenced by the stored images
+// whose config lists its diff ID, and used by the running containers, which
+// hold a shared lock on its directory. Garbage collection only removes the
+// layers that are neither referenced nor used.
+//
+// Images stored before the layer store have their rootfs flattened into a
+// directory of RootfsDir named by the image ID instead, which is their only
+// layer and is collected like one.
+
+// extractPrefix names the directories layers are extracted to, which are
+// renamed to the layer's once it's complete
+const extractPrefix = ".extract-"
+
+// lockStore locks the images and layers against concurrent changes until
+// unlock is called
+func lockStore() (unlock func(), err error) {
+	if err := os.MkdirAll(paths.LayerDir(), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(paths.StateDir(), "store.lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("lock the store: %w", err)
+	}
+	return func() {
+		_ = f.Close()
+	}, nil
+}
+
+// layerPath returns the directory of a layer by its diff or chain ID. IDs
+// contain a colon, which separates the lower directories of an overlay, so
+// only the hex is used.
+func layerPath(id v1.Hash) string {
+	return filepath.Join(paths.LayerDir(), id.Hex)
+}
+
+// storedLayerPath returns the directory of a layer with the diff and chain
+// IDs, which is named by the chain ID if the layer was stored by it
+func storedLayerPath(diffID, chainID v1.Hash) string {
+	if dir := layerPath(chainID); !dirExists(layerPath(diffID)) && dirExists(dir) {
+		return dir
+	}
+	return layerPath(diffID)
+}
+
+// chainIDs returns the chain IDs of the layers with the diff IDs, from the
+// bottom layer up, as in the OCI image spec
+func chainIDs(diffIDs []v1.Hash) ([]v1.Hash, error) {
+	ids := make([]v1.Hash, len(diffIDs))
+	for i, diffID := range diffIDs {
+		if i == 0 {
+			ids[i] = diffID
+			continue
+		}
+		id, _, err := v1.SHA256(strings.NewReader(ids[i-1].String() + " " + diffID.String()))
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// storeLayer extracts a layer into the store unless it's there already,
+// above lower, the directories of the layers below it from the top down.
+// The store has to be locked.
+func storeLayer(layer v1.Layer, diffID, chainID v1.Hash, lower []string) error {
+	if dirExists(layerPath(diffID)) || dirExists(layerPath(chainID)) {
+		return nil
+	}
+
+	tmp, err := os.MkdirTemp(paths.LayerDir(), extractPrefix)
+	if err != nil {
+		return err
+	}
+	copiedLower, err := extractLayer(layer, tmp, lower)
+	if err != nil {
+		_ = forceRemoveAll(tmp)
+		return fmt.Errorf("extract %s: %w", diffID, err)
+	}
+	dir := layerPath(diffID)
+	if copiedLower {
+		dir = layerPath(chainID)
+	}
+	return os.Rename(tmp, dir)
+}
+
+// extractLayer extracts a layer into dir above lower, and reports whether it
+// copied files of lower
+func extractLayer(layer v1.Layer, dir string, lower []string) (bool, error) {
+	if err := os.Chmod(dir, 0755); err != nil {
+		return false, err
+	}
+	r, err := layer.Uncompressed()
+	if err != nil {
+		return false, err
+	}
+	copiedLower, err := untarInto(r, dir, lower)
+	if err != nil {
+		_ = r.Close()
+		return false, err
+	}
+	return copiedLower, r.Close()
+}
+
+// writeFileAtomic writes a file, which either has all of data or doesn't
+// exist if writing it is interrupted
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// LayerDirs returns the directories of the layers of a stored image, from
+// the top layer down, as the lower directories of its overlay
+func LayerDirs(imageID string) ([]string, error) {
+	config, err := LoadConfig(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if rootfs := filepath.Join(paths.RootfsDir(), imageID); dirExists(rootfs) {
+		return []string{rootfs}, nil
+	}
+	diffIDs := config.RootFS.DiffIDs
+	chains, err := chainIDs(diffIDs)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var dirs []string
+	for i := len(diffIDs) - 1; i >= 0; i-- {
+		dir := storedLayerPath(diffIDs[i], chains[i])
+		// Applying a layer again makes applying it lower redundant, and
+		// overlayfs rejects a directory given twice
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// UseLayers returns the layer directories of a stored image like LayerDirs,
+// which aren't garbage collected until release is called
+func UseLayers(imageID string) (dirs []string, release func(), err error) {
+	unlock, err := lockStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	dirs, err = LayerDirs(imageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var locks []*os.File
+	release = func() {
+		for _, f := range locks {
+			_ = f.Close()
+		}
+	}
+	for _, dir := range dirs {
+		f, err := os.Open(dir)
+		if err != nil {
+			release()
+			return nil, nil, fmt.Errorf("layer %s: %w", filepath.Base(dir), err)
+		}
+		locks = append(locks, f)
+		if err := unix.Flock(int(f.Fd()), unix.LOCK_SH); err != nil {
+			release()
+			return nil, nil, fmt.Errorf("lock layer %s: %w", filepath.Base(dir), err)
+		}
+	}
+	return dirs, release, nil
+}
+
+// isStored reports whether an image and all its layers are stored
+func isStored(imageID string) bool {
+	dirs, err := LayerDirs(imageID)
+	if err != nil {
+		return false
+	}
+	for _, dir := range dirs {
+		if !dirExists(dir) {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveImage removes a stored image, by reference or ID, and the layers
+// only it referenced, and returns its ID
+func RemoveImage(ref string) (string, error) {
+	unlock, err := lockStore()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	cache, err := loadImageCache()
+	if err != nil {
+		return "", fmt.Errorf("failed to load image cache: %w", err)
+	}
+	imageID, ok := cache.RefToID[ref]
+	if !ok {
+		if !isImageID(ref) || !dirExists(filepath.Join(paths.ImageDir(), ref)) {
+			return "", fmt.Errorf("no such image: %s", ref)
+		}
+		imageID = ref
+	}
+
+	if err := forceRemoveAll(filepath.Join(paths.ImageDir(), imageID)); err != nil {
+		return "", err
+	}
+	for cachedRef, cachedID := range cache.RefToID {
+		if cachedID == imageID {
+			delete(cache.RefToID, cachedRef)
+		}
+	}
+	if err := saveImageCache(cache); err != nil {
+		return "", fmt.Errorf("failed to save image cache: %w", err)
+	}
+	if _, err := collectGarbage(); err != nil {
+		return "", err
+	}
+	return imageID, nil
+}
+
+// CollectGarbage removes the layers no stored image references, unless a
+// running container uses them, and the images whose storing was
+// interrupted, and returns how many layers it removed
+func CollectGarbage() (int, error) {
+	unlock, err := lockStore()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	return collectGarbage()
+}
+
+// collectGarbage is CollectGarbage with the store locked, so that nothing
+// is being stored
+func collectGarbage() (int, error) {
+	refs, err := layerRefs()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, dir := range []string{paths.LayerDir(), paths.RootfsDir()} {
+		n, err := removeUnreferenced(dir, refs)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	// RootfsDir is only removed once the last flattened image is
+	_ = os.Remove(paths.RootfsDir())
+	return removed, nil
+}
+
+// removeUnreferenced removes the layers in parent that aren't referenced
+// or used, and the interrupted extractions, and returns how many layers it
+// removed
+func removeUnreferenced(parent string, refs map[string]int) (int, error) {
+	entries, err := os.ReadDir(parent)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		dir := filepath.Join(parent, entry.Name())
+		if strings.HasPrefix(entry.Name(), extractPrefix) {
+			if err := forceRemoveAll(dir); err != nil {
+				return removed, err
+			}
+			continue
+		}
+		if !entry.IsDir() || refs[entry.Name()] > 0 {
+			continue
+		}
+		ok, err := removeLayer(dir)
+		if err != nil {
+			return removed, fmt.Errorf("remove layer %s: %w", entry.Name(), err)
+		}
+		if ok {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// layerRefs counts the stored images referencing each layer, by the name
+// of its directory, and removes the images that were never completely
+// stored
+func layerRefs() (map[string]int, error) {
+	refs := make(map[string]int)
+	entries, err := os.ReadDir(paths.ImageDir())
+	if os.IsNotExist(err) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		dirs, err := LayerDirs(entry.Name())
+		if os.IsNotExist(err) {
+			if err := forceRemoveAll(filepath.Join(paths.ImageDir(), entry.Name())); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// Collecting layers of an image that can't be read would be unsafe
+		if err != nil {
+			return nil, fmt.Errorf("image %s: %w", entry.Name(), err)
+		}
+		for _, dir := range dirs {
+			refs[filepath.Base(dir)]++
+		}
+	}
+	return refs, nil
+}
+
+// removeLayer removes a layer unless a running container holds a lock on
+// it, and reports whether it did
+func removeLayer(dir string) (bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	err = unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, forceRemoveAll(dir)
+}
+
+// LookupFile returns the path of name, an absolute path in the rootfs, in
+// the top layer that has it, as the overlay of the layer directories shows
+// it. It returns "" when no layer has it or a whiteout deleted it. Symlinks
+// aren't followed.
+func LookupFile(layers []string, name string) string {
+	parts := strings.Split(strings.Trim(path.Clean(name), "/"), "/")
+	for _, layer := range layers {
+		current := layer
+		opaque := false
+		for i, part := range parts {
+			// The lower layers' files in an opaque directory are hidden
+			opaque = opaque || (i > 0 && isOpaque(current))
+			current = filepath.Join(current, part)
+			info, err := os.Lstat(current)
+			if err != nil {
+				break
+			}
+			if isWhiteout(info) || (i < len(parts)-1 && !info.IsDir()) {
+				return ""
+			}
+			if i == len(parts)-1 {
+				return current
+			}
+		}
+		if opaque {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isWhiteout(info os.FileInfo) bool {
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stat.Rdev == 0
+}
+
+func isOpaque(dir string) bool {
+	for _, attr := range opaqueXattrs {
+		value := make([]byte, 1)
+		if n, err := unix.Lgetxattr(dir, attr, value); err == nil && n == 1 && value[0] == 'y' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,376 @@
+package image
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/jmelahman/runtainer/internal/paths"
+)
+
+// useStateDir stores images in a new state directory for the test
+func useStateDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	// Read-only directories can't be cleaned up without root
+	t.Cleanup(func() {
+		_ = forceRemoveAll(dir)
+	})
+}
+
+func mustStoreImage(t *testing.T, img v1.Image) string {
+	t.Helper()
+	imageID, err := storeImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return imageID
+}
+
+// storedLayers lists the layers in the store
+func storedLayers(t *testing.T) []string {
+	t.Helper()
+	entries, err := os.ReadDir(paths.LayerDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var layers []string
+	for _, entry := range entries {
+		layers = append(layers, entry.Name())
+	}
+	sort.Strings(layers)
+	return layers
+}
+
+func layerNames(t *testing.T, images ...v1.Image) []string {
+	t.Helper()
+	seen := make(map[string]bool)
+	var names []string
+	for _, img := range images {
+		layers, err := img.Layers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, layer := range layers {
+			diffID, err := layer.DiffID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !seen[diffID.Hex] {
+				seen[diffID.Hex] = true
+				names = append(names, diffID.Hex)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestStoreDeduplicatesLayers(t *testing.T) {
+	useStateDir(t)
+	base := mustRandomImage(t)
+	first, err := mutate.AppendLayers(base, newLayer(t, file("first", "1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := mutate.AppendLayers(base, newLayer(t, file("second", "2")), newLayer(t, file("first", "1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstLower, err := LayerDirs(mustStoreImage(t, first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The shared layers aren't extracted again
+	if err := os.Remove(filepath.Join(firstLower[0], "first")); err != nil {
+		t.Fatal(err)
+	}
+	secondID := mustStoreImage(t, second)
+
+	if layers, expected := storedLayers(t), layerNames(t, first, second); !reflect.DeepEqual(layers, expected) {
+		t.Errorf("Expected the layers %v to be stored once, got %v", expected, layers)
+	}
+	if _, err := os.Stat(filepath.Join(firstLower[0], "first")); !os.IsNotExist(err) {
+		t.Errorf("Expected the stored layer to be reused, got %v", err)
+	}
+
+	lower, err := LayerDirs(secondID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, _ := second.Layers()
+	var expected []string
+	for i := len(layers) - 1; i >= 0; i-- {
+		diffID, _ := layers[i].DiffID()
+		expected = append(expected, layerPath(diffID))
+	}
+	if !reflect.DeepEqual(lower, expected) {
+		t.Errorf("Expected the layers from the top down %v, got %v", expected, lower)
+	}
+	if path := LookupFile(lower, "/second"); path != filepath.Join(lower[1], "second") {
+		t.Errorf("Expected /second in the layer below the top, got %q", path)
+	}
+}
+
+func TestStoreWhiteouts(t *testing.T) {
+	useStateDir(t)
+	img, err := mutate.AppendLayers(mustRandomImage(t),
+		newLayer(t, dir("etc"), file("etc/passwd", "root"), file("etc/group", "root"), dir("opt"), file("opt/old", "old"), file("keep", "keep")),
+		newLayer(t, file("etc/.wh.passwd", ""), dir("opt"), file("opt/.wh..wh..opq", ""), file("opt/new", "new")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lower, err := LayerDirs(mustStoreImage(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The whiteouts are in overlayfs' format
+	info, err := os.Lstat(filepath.Join(lower[0], "etc", "passwd"))
+	if err != nil || !isWhiteout(info) {
+		t.Errorf("Expected /etc/passwd to be a whiteout in the top layer, got %v (%v)", info, err)
+	}
+	if !isOpaque(filepath.Join(lower[0], "opt")) {
+		t.Error("Expected /opt to be opaque in the top layer")
+	}
+	if _, err := os.Lstat(filepath.Join(lower[0], "opt", opaqueWhiteout)); !os.IsNotExist(err) {
+		t.Errorf("Expected no %s in the top layer, got %v", opaqueWhiteout, err)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"/etc/passwd", ""},
+		{"/etc/group", filepath.Join(lower[1], "etc", "group")},
+		{"/opt/old", ""},
+		{"/opt/new", filepath.Join(lower[0], "opt", "new")},
+		{"/keep", filepath.Join(lower[1], "keep")},
+		{"/keep/file", ""},
+		{"/missing", ""},
+	}
+	for _, tt := range tests {
+		if path := LookupFile(lower, tt.name); path != tt.expected {
+			t.Errorf("Expected %s at %q, got %q", tt.name, tt.expected, path)
+		}
+	}
+}
+
+func TestStoreHardLinksToLowerLayers(t *testing.T) {
+	useStateDir(t)
+	img, err := mutate.AppendLayers(mustRandomImage(t),
+		newLayer(t, dir("etc"), file("etc/base", "old")),
+		newLayer(t, dir("etc"), file("etc/base", "base")),
+		newLayer(t, entry{hdr: tar.Header{Name: "etc/link", Typeflag: tar.TypeLink, Linkname: "etc/base"}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lower, err := LayerDirs(mustStoreImage(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The link is a copy of the top lower layer's file, which stays its own
+	link := LookupFile(lower, "/etc/link")
+	if link != filepath.Join(lower[0], "etc", "link") {
+		t.Fatalf("Expected /etc/link in the top layer, got %q", link)
+	}
+	if data, err := os.ReadFile(link); err != nil || string(data) != "base" {
+		t.Errorf("Expected /etc/link to have the content of /etc/base, got %q (%v)", data, err)
+	}
+	linkInfo, err := os.Stat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseInfo, err := os.Stat(filepath.Join(lower[1], "etc", "base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(linkInfo, baseInfo) {
+		t.Error("Expected /etc/link not to share the lower layer's file")
+	}
+	if linkInfo.Mode() != baseInfo.Mode() || !linkInfo.ModTime().Equal(baseInfo.ModTime()) {
+		t.Errorf("Expected the mode and time of /etc/base, got %v %v", linkInfo.Mode(), linkInfo.ModTime())
+	}
+
+	// A link to a file no layer has still fails
+	missing, err := mutate.AppendLayers(mustRandomImage(t),
+		newLayer(t, entry{hdr: tar.Header{Name: "link", Typeflag: tar.TypeLink, Linkname: "missing"}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storeImage(missing); err == nil {
+		t.Error("Expected storing a link to a missing file to fail")
+	}
+}
+
+func TestStoreHardLinksOverDifferentBases(t *testing.T) {
+	useStateDir(t)
+	top := newLayer(t, entry{hdr: tar.Header{Name: "etc/hosts2", Typeflag: tar.TypeLink, Linkname: "etc/hosts1"}})
+	var lowers [][]string
+	for _, content := range []string{"first", "second"} {
+		img, err := mutate.AppendLayers(mustRandomImage(t), newLayer(t, dir("etc"), file("etc/hosts1", content)), top)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lower, err := LayerDirs(mustStoreImage(t, img))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err := os.ReadFile(LookupFile(lower, "/etc/hosts2")); err != nil || string(data) != content {
+			t.Errorf("Expected /etc/hosts2 to be %q, got %q (%v)", content, data, err)
+		}
+		lowers = append(lowers, lower)
+	}
+
+	// The top layer depends on the layers below, so each image has its own
+	if lowers[0][0] == lowers[1][0] {
+		t.Errorf("Expected the top layers to be stored apart, got %s", lowers[0][0])
+	}
+	diffID, err := top.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirExists(layerPath(diffID)) {
+		t.Error("Expected the top layer not to be stored by its diff ID")
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	useStateDir(t)
+	base := mustRandomImage(t)
+	first, err := mutate.AppendLayers(base, newLayer(t, file("first", "1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := mutate.AppendLayers(base, newLayer(t, file("second", "2")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstID := mustStoreImage(t, first)
+	secondID := mustStoreImage(t, second)
+
+	// Only the layer no other image references is removed
+	if imageID, err := RemoveImage(firstID); err != nil || imageID != firstID {
+		t.Fatalf("Expected to remove %s, got %s (%v)", firstID, imageID, err)
+	}
+	if layers, expected := storedLayers(t), layerNames(t, second); !reflect.DeepEqual(layers, expected) {
+		t.Errorf("Expected the layers %v, got %v", expected, layers)
+	}
+	if _, err := RemoveImage(firstID); err == nil {
+		t.Error("Expected removing a removed image to fail")
+	}
+
+	// Layers in use aren't removed until they're released
+	_, release, err := UseLayers(secondID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RemoveImage(secondID); err != nil {
+		t.Fatal(err)
+	}
+	if layers, expected := storedLayers(t), layerNames(t, second); !reflect.DeepEqual(layers, expected) {
+		t.Errorf("Expected the layers in use %v, got %v", expected, layers)
+	}
+	release()
+
+	// Interrupted extractions and images are removed too
+	if err := os.Mkdir(filepath.Join(paths.LayerDir(), extractPrefix+"interrupted"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(paths.ImageDir(), "interrupted"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := CollectGarbage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := len(layerNames(t, second)); removed != expected {
+		t.Errorf("Expected %d layers removed, got %d", expected, removed)
+	}
+	if layers := storedLayers(t); len(layers) != 0 {
+		t.Errorf("Expected no layers, got %v", layers)
+	}
+	if entries, err := os.ReadDir(paths.ImageDir()); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no images, got %v (%v)", entries, err)
+	}
+}
+
+// storeFlattened stores an image like before the layer store, with its
+// rootfs flattened into a directory of RootfsDir
+func storeFlattened(t *testing.T, img v1.Image) string {
+	t.Helper()
+	manifest, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageID := manifest.Config.Digest.Hex[:12]
+	rootfs := filepath.Join(paths.RootfsDir(), imageID)
+	if err := os.MkdirAll(rootfs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootfs, "flattened"), []byte(imageID), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := img.RawConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageDir := filepath.Join(paths.ImageDir(), imageID)
+	if err := os.MkdirAll(imageDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(imageDir, "config.json"), config, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return imageID
+}
+
+func TestFlattenedImages(t *testing.T) {
+	useStateDir(t)
+	flattened := storeFlattened(t, mustRandomImage(t))
+	removed := storeFlattened(t, mustRandomImage(t))
+	stored := mustStoreImage(t, mustRandomImage(t))
+	if err := forceRemoveAll(filepath.Join(paths.ImageDir(), removed)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A flattened image is stored, with its rootfs as its only layer
+	rootfs := filepath.Join(paths.RootfsDir(), flattened)
+	if lower, err := LayerDirs(flattened); err != nil || !reflect.DeepEqual(lower, []string{rootfs}) {
+		t.Errorf("Expected the layers [%s], got %v (%v)", rootfs, lower, err)
+	}
+	if !isStored(flattened) {
+		t.Error("Expected the flattened image to be stored")
+	}
+
+	// Only the rootfs of the removed image is collected
+	if _, err := CollectGarbage(); err != nil {
+		t.Fatal(err)
+	}
+	if !dirExists(rootfs) {
+		t.Error("Expected the rootfs of the flattened image to be kept")
+	}
+	if dirExists(filepath.Join(paths.RootfsDir(), removed)) {
+		t.Error("Expected the rootfs of the removed image to be collected")
+	}
+	if !isStored(stored) {
+		t.Error("Expected the image in the layer store to be kept")
+	}
+
+	if _, err := RemoveImage(flattened); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(paths.RootfsDir()); !os.IsNotExist(err) {
+		t.Errorf("Expected no flattened images left, got %v", err)
+	}
+}
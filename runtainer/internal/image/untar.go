@@ -2,61 +2,422 @@ package image
 
 import (
 	"archive/tar"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
-func untarInto(r io.Reader, target string) error {
-	tr := tar.NewReader(r)
+const (
+	// whiteoutPrefix marks a file deleted from the lower layers
+	whiteoutPrefix = ".wh."
+	// opaqueWhiteout hides every lower file in its directory
+	opaqueWhiteout = ".wh..wh..opq"
+	// xattrPrefix prefixes the PAX records of extended attributes
+	xattrPrefix = "SCHILY.xattr."
+	// maxSymlinks is how many symlinks a path may go through, as in Linux
+	maxSymlinks = 40
+)
 
+// opaqueXattrs mark a directory opaque in an overlay: user.* with the
+// userxattr mount option that unprivileged mounts use, trusted.* otherwise
+var opaqueXattrs = []string{"user.overlay.opaque", "trusted.overlay.opaque"}
+
+// untarInto extracts a layer into target, an empty directory that's a layer
+// of an overlay of lower, the directories of the layers below it from the
+// top down. The layer's entries are created with their mode, ownership,
+// times and xattrs, and its OCI whiteouts, which delete files of the lower
+// layers, are converted to overlayfs' format. It reports whether files were
+// copied from lower, which makes target depend on them.
+func untarInto(r io.Reader, target string, lower []string) (bool, error) {
+	e := &extractor{
+		root:     target,
+		lower:    lower,
+		seen:     make(map[string]bool),
+		parents:  make(map[string]bool),
+		rootless: os.Geteuid() != 0,
+	}
+	tr := tar.NewReader(r)
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
 			break // done
 		}
+		if err != nil {
+			return false, err
+		}
+		if err := e.apply(hdr, tr); err != nil {
+			return false, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+	}
+	return e.copiedLower, e.finish()
+}
+
+// extractor applies the entries of a layer
+type extractor struct {
+	root string
+	// lower are the directories of the layers below in the overlay
+	lower []string
+	// copiedLower is set once a file of lower is copied into the layer
+	copiedLower bool
+	// seen are the entries of the layer, which its whiteouts don't delete
+	seen map[string]bool
+	// parents are the directories containing the seen entries
+	parents map[string]bool
+	// dirs are the directories of the layer, whose mode and times are set
+	// once their contents are written
+	dirs []*tar.Header
+	// rootless is set when files can't be given to other users, nor device
+	// nodes created
+	rootless bool
+}
+
+// apply applies an entry of the layer
+func (e *extractor) apply(hdr *tar.Header, r io.Reader) error {
+	name := path.Clean("/" + hdr.Name)
+	if name == "/" {
+		return nil
+	}
+	dir, base := path.Split(name)
+	dir = path.Clean(dir)
+
+	if base == opaqueWhiteout {
+		resolved, err := e.resolve(dir, true)
 		if err != nil {
 			return err
 		}
+		return e.markOpaque(resolved)
+	}
+	if strings.HasPrefix(base, whiteoutPrefix) {
+		deleted := path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+		// Whiteouts only apply to lower layers
+		if e.seen[deleted] || e.parents[deleted] {
+			return nil
+		}
+		resolved, err := e.resolve(deleted, false)
+		if err != nil {
+			return err
+		}
+		return e.whiteout(resolved)
+	}
+
+	e.seen[name] = true
+	for parent := dir; parent != "/"; parent = path.Dir(parent) {
+		e.parents[parent] = true
+	}
+	target, err := e.resolve(name, false)
+	if err != nil {
+		return err
+	}
+	if err := e.mkdirAll(filepath.Dir(target)); err != nil {
+		return err
+	}
 
-		path := filepath.Join(target, hdr.Name)
-		// Prevent directory traversal
-		if !strings.HasPrefix(path, filepath.Clean(target)+string(os.PathSeparator)) {
-			return os.ErrPermission
+	// Anything but a directory replaces what's there, and a directory
+	// merges with one
+	if info, err := os.Lstat(target); err == nil && !(info.IsDir() && hdr.Typeflag == tar.TypeDir) {
+		if err := e.removeAll(target); err != nil {
+			return err
 		}
+	}
 
-		switch hdr.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(path, os.FileMode(hdr.Mode)); err != nil {
-				return err
-			}
-		case tar.TypeReg:
-			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-				return err
-			}
-			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
-			if err != nil {
-				return err
-			}
-			if _, err := io.Copy(f, tr); err != nil {
-				_ = f.Close()
-				return err
-			}
-			if err := f.Close(); err != nil {
-				return err
-			}
-		case tar.TypeSymlink:
-			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-				return err
-			}
-			if err := os.Symlink(hdr.Linkname, path); err != nil {
-				return err
-			}
-		default:
-			// ignore other types for now
+	mode := hdr.FileInfo().Mode()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(target, 0755); err != nil && !os.IsExist(err) {
+			return err
 		}
+		e.dirs = append(e.dirs, hdr)
+		return nil
+	case tar.TypeReg:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		// Hard links are to paths in the rootfs, not the host
+		source, err := e.resolve(path.Clean("/"+hdr.Linkname), false)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(source); os.IsNotExist(err) {
+			return e.copyLower(path.Clean("/"+hdr.Linkname), target)
+		}
+		return os.Link(source, target)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		kind := uint32(unix.S_IFIFO)
+		if hdr.Typeflag == tar.TypeChar {
+			kind = unix.S_IFCHR
+		} else if hdr.Typeflag == tar.TypeBlock {
+			kind = unix.S_IFBLK
+		}
+		dev := unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))
+		err := unix.Mknod(target, kind|uint32(mode.Perm()), int(dev))
+		// Only root can create devices, and the host's /dev is mounted in
+		// containers anyway
+		if errors.Is(err, unix.EPERM) && hdr.Typeflag != tar.TypeFifo && e.rootless {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		// Other entries, such as PAX headers, have no file
+		return nil
+	}
+	return e.setMetadata(target, hdr)
+}
+
+// copyLower copies name from the top lower layer that has it to target. A
+// layer of an overlay only has its own files, so a hard link to a file of a
+// lower layer becomes a copy, as the layers can't share changes.
+func (e *extractor) copyLower(name, target string) error {
+	source := LookupFile(e.lower, name)
+	if source == "" {
+		return fmt.Errorf("link target %s not found", name)
+	}
+	e.copiedLower = true
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode().IsRegular():
+		if err := copyFile(source, target); err != nil {
+			return err
+		}
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(link, target); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("link target %s is not a regular file", name)
 	}
 
+	stat := info.Sys().(*syscall.Stat_t)
+	if !e.rootless {
+		if err := os.Lchown(target, int(stat.Uid), int(stat.Gid)); err != nil {
+			return err
+		}
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		if err := os.Chmod(target, info.Mode()); err != nil {
+			return err
+		}
+	}
+	times := []unix.Timespec{unix.Timespec(stat.Atim), unix.Timespec(stat.Mtim)}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, target, times, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// whiteout creates an overlayfs whiteout, a 0/0 character device, which
+// Linux lets anyone create since 5.8
+func (e *extractor) whiteout(target string) error {
+	if err := e.mkdirAll(filepath.Dir(target)); err != nil {
+		return err
+	}
+	return unix.Mknod(target, unix.S_IFCHR, 0)
+}
+
+// markOpaque makes dir hide the lower layers' files in an overlay
+func (e *extractor) markOpaque(dir string) error {
+	if err := e.mkdirAll(dir); err != nil {
+		return err
+	}
+	for _, attr := range opaqueXattrs {
+		err := unix.Lsetxattr(dir, attr, []byte("y"), 0)
+		// Only root can set trusted.* attributes
+		if errors.Is(err, unix.EPERM) && e.rootless {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("set xattr %s: %w", attr, err)
+		}
+	}
+	return nil
+}
+
+// setMetadata sets the ownership, mode, xattrs and times of an entry
+func (e *extractor) setMetadata(target string, hdr *tar.Header) error {
+	// Without root, everything belongs to the user, who is root in the
+	// container
+	if !e.rootless {
+		if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	// Setting the mode after the owner keeps setuid bits
+	if hdr.Typeflag != tar.TypeSymlink {
+		if err := os.Chmod(target, hdr.FileInfo().Mode()); err != nil {
+			return err
+		}
+	}
+	for key, value := range hdr.PAXRecords {
+		attr, ok := strings.CutPrefix(key, xattrPrefix)
+		if !ok {
+			continue
+		}
+		err := unix.Lsetxattr(target, attr, []byte(value), 0)
+		// Attributes outside the user namespace need privileges, and not
+		// every filesystem supports them
+		if errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOTSUP) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("set xattr %s: %w", attr, err)
+		}
+	}
+	return setTimes(target, hdr)
+}
+
+func setTimes(target string, hdr *tar.Header) error {
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = hdr.ModTime
+	}
+	times := []unix.Timespec{timespec(atime), timespec(hdr.ModTime)}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, target, times, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+func timespec(t time.Time) unix.Timespec {
+	if t.IsZero() {
+		return unix.Timespec{Nsec: unix.UTIME_OMIT}
+	}
+	return unix.NsecToTimespec(t.UnixNano())
+}
+
+// finish sets the metadata of the layer's directories, deepest first so
+// that setting it doesn't change their parents' times
+func (e *extractor) finish() error {
+	for i := len(e.dirs) - 1; i >= 0; i-- {
+		hdr := e.dirs[i]
+		target, err := e.resolve(path.Clean("/"+hdr.Name), false)
+		if err != nil {
+			return err
+		}
+		if err := e.setMetadata(target, hdr); err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+	}
 	return nil
 }
+
+// resolve returns the path of name in the rootfs, following symlinks in
+// the rootfs rather than on the host, and the last element's if follow is
+// set
+func (e *extractor) resolve(name string, follow bool) (string, error) {
+	current := "/"
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		if part == "" || part == "." {
+			continue
+		}
+		next := path.Join(current, part)
+		if len(parts) == 0 && !follow {
+			current = next
+			break
+		}
+		info, err := os.Lstat(filepath.Join(e.root, next))
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links")
+		}
+		link, err := os.Readlink(filepath.Join(e.root, next))
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(link) {
+			current = "/"
+		}
+		parts = append(strings.Split(link, "/"), parts...)
+	}
+	return filepath.Join(e.root, current), nil
+}
+
+// mkdirAll creates dir and the directories above it in the rootfs, which
+// have to be resolved already
+func (e *extractor) mkdirAll(dir string) error {
+	info, err := os.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if err := e.mkdirAll(filepath.Dir(dir)); err != nil {
+		return err
+	}
+	return os.Mkdir(dir, 0755)
+}
+
+// removeAll removes a file or directory, making read-only directories in
+// it writable first
+func (e *extractor) removeAll(target string) error {
+	err := os.RemoveAll(target)
+	if err == nil || !e.rootless {
+		return err
+	}
+	return forceRemoveAll(target)
+}
+
+// forceRemoveAll removes a file or directory like os.RemoveAll, even with
+// read-only directories in it
+func forceRemoveAll(target string) error {
+	_ = filepath.WalkDir(target, func(p string, entry os.DirEntry, err error) error {
+		if err == nil && entry.IsDir() {
+			_ = os.Chmod(p, 0700)
+		}
+		return nil
+	})
+	return os.RemoveAll(target)
+}
@@ -0,0 +1,353 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"golang.org/x/sys/unix"
+)
+
+// entry is a file of a layer
+type entry struct {
+	hdr     tar.Header
+	content string
+}
+
+func file(name, content string) entry {
+	return entry{hdr: tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}, content: content}
+}
+
+func dir(name string) entry {
+	return entry{hdr: tar.Header{Name: name + "/", Typeflag: tar.TypeDir, Mode: 0755}}
+}
+
+func symlink(name, target string) entry {
+	return entry{hdr: tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777}}
+}
+
+// newLayer builds a layer of the entries in memory
+func newLayer(t *testing.T, entries ...entry) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.content))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
+
+// applyImage extracts the layers of the image into new directories, which
+// it returns from the top down like LayerDirs
+func applyImage(t *testing.T, img v1.Image) []string {
+	t.Helper()
+	root := t.TempDir()
+	// Read-only directories can't be cleaned up without root
+	t.Cleanup(func() {
+		_ = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				_ = os.Chmod(path, 0755)
+			}
+			return nil
+		})
+	})
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lower []string
+	for i, layer := range layers {
+		r, err := layer.Uncompressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := filepath.Join(root, strconv.Itoa(i))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := untarInto(r, dir, lower); err != nil {
+			t.Fatal(err)
+		}
+		_ = r.Close()
+		lower = append([]string{dir}, lower...)
+	}
+	return lower
+}
+
+// listFiles describes the files of the overlay of the layers by path
+func listFiles(t *testing.T, layers []string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	for _, layer := range layers {
+		err := filepath.WalkDir(layer, func(path string, d os.DirEntry, err error) error {
+			if err != nil || path == layer {
+				return err
+			}
+			name, _ := filepath.Rel(layer, path)
+			if _, ok := files[name]; ok {
+				return nil
+			}
+			if file := LookupFile(layers, name); file != "" {
+				files[name], err = describeFile(file)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// describeFile describes a file by its type and content
+func describeFile(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case info.IsDir():
+		return "dir", nil
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		return "-> " + target, err
+	case info.Mode().IsRegular():
+		// The files of random layers have no permissions
+		content, err := os.ReadFile(path)
+		if os.IsPermission(err) {
+			return "unreadable", nil
+		}
+		return string(content), err
+	default:
+		return info.Mode().Type().String(), nil
+	}
+}
+
+func TestUntarWhiteouts(t *testing.T) {
+	base, err := random.Image(16, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var randomFiles []string
+	for name := range listFiles(t, applyImage(t, base)) {
+		randomFiles = append(randomFiles, name)
+	}
+	if len(randomFiles) != 2 {
+		t.Fatalf("Expected 2 random files, got %v", randomFiles)
+	}
+
+	img, err := mutate.AppendLayers(base,
+		newLayer(t,
+			dir("etc"), file("etc/keep", "keep"), file("etc/deleted", "deleted"),
+			dir("dir"), file("dir/old", "old"), dir("dir/sub"), file("dir/sub/old", "old"),
+		),
+		newLayer(t,
+			file(".wh."+randomFiles[0], ""),
+			file("etc/.wh.deleted", ""),
+			file("etc/.wh.missing", ""),
+			// Entries of the layer stay whether they come before or
+			// after its whiteouts
+			file("dir/new", "new"),
+			file("dir/.wh..wh..opq", ""),
+			file("dir/sub/new", "new"),
+			file("dir/same", "same"),
+			file("dir/.wh.same", ""),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := listFiles(t, applyImage(t, img))
+	expected := map[string]string{
+		randomFiles[1]: files[randomFiles[1]],
+		"etc":          "dir",
+		"etc/keep":     "keep",
+		"dir":          "dir",
+		"dir/new":      "new",
+		"dir/same":     "same",
+		"dir/sub":      "dir",
+		"dir/sub/new":  "new",
+	}
+	if _, ok := files[randomFiles[1]]; !ok {
+		t.Errorf("Expected %s to remain", randomFiles[1])
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+}
+
+func TestUntarEntries(t *testing.T) {
+	root := os.Geteuid() == 0
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	owned := file("owned", "owned")
+	owned.hdr.Uid, owned.hdr.Gid = 1234, 5678
+	setuid := file("bin/setuid", "setuid")
+	setuid.hdr.Mode = 04755
+	dated := file("dated", "dated")
+	dated.hdr.ModTime = mtime
+	datedDir := dir("dated-dir")
+	datedDir.hdr.ModTime = mtime
+	readOnly := dir("read-only")
+	readOnly.hdr.Mode = 0555
+	xattr := file("xattr", "xattr")
+	xattr.hdr.PAXRecords = map[string]string{xattrPrefix + "user.runtainer": "value"}
+	hardlink := entry{hdr: tar.Header{Name: "hardlink", Typeflag: tar.TypeLink, Linkname: "dated"}}
+	fifo := entry{hdr: tar.Header{Name: "fifo", Typeflag: tar.TypeFifo, Mode: 0644}}
+	device := entry{hdr: tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3}}
+
+	base, err := random.Image(16, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(base,
+		newLayer(t,
+			owned, setuid, dated, datedDir, file("dated-dir/child", "child"),
+			readOnly, file("read-only/file", "file"), xattr, hardlink, fifo, device,
+			symlink("link", "dated"), dir("replaced-by-file"), file("replaced-by-dir", "file"),
+		),
+		newLayer(t,
+			readOnly, file("read-only/added", "added"),
+			file("replaced-by-file", "file"),
+			dir("replaced-by-dir"),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lower := applyImage(t, img)
+
+	files := listFiles(t, lower)
+	for name, expected := range map[string]string{
+		"link":             "-> dated",
+		"read-only/file":   "file",
+		"read-only/added":  "added",
+		"replaced-by-file": "file",
+		"replaced-by-dir":  "dir",
+	} {
+		if files[name] != expected {
+			t.Errorf("Expected %s to be %q, got %q", name, expected, files[name])
+		}
+	}
+
+	stat := func(name string) *syscall.Stat_t {
+		t.Helper()
+		var st syscall.Stat_t
+		if err := syscall.Lstat(LookupFile(lower, name), &st); err != nil {
+			t.Fatal(err)
+		}
+		return &st
+	}
+	if dated, hardlink := stat("dated"), stat("hardlink"); dated.Ino != hardlink.Ino {
+		t.Error("Expected hardlink to be a hard link to dated")
+	}
+	for _, name := range []string{"dated", "dated-dir"} {
+		if modTime := time.Unix(stat(name).Mtim.Unix()); !modTime.Equal(mtime) {
+			t.Errorf("Expected %s to be modified at %s, got %s", name, mtime, modTime)
+		}
+	}
+	if mode := stat("bin/setuid").Mode; mode&07777 != 04755 {
+		t.Errorf("Expected bin/setuid to have mode 4755, got %o", mode&07777)
+	}
+	if mode := stat("read-only").Mode; mode&0777 != 0555 {
+		t.Errorf("Expected read-only to have mode 555, got %o", mode&0777)
+	}
+	if mode := stat("fifo").Mode; mode&syscall.S_IFMT != syscall.S_IFIFO {
+		t.Errorf("Expected fifo to be a FIFO, got %o", mode)
+	}
+	if root {
+		if st := stat("owned"); st.Uid != 1234 || st.Gid != 5678 {
+			t.Errorf("Expected owned to be owned by 1234:5678, got %d:%d", st.Uid, st.Gid)
+		}
+		if st := stat("dev/null"); st.Mode&syscall.S_IFMT != syscall.S_IFCHR || st.Rdev != unix.Mkdev(1, 3) {
+			t.Errorf("Expected dev/null to be device 1:3, got %o %d", st.Mode, st.Rdev)
+		}
+	}
+
+	value := make([]byte, 16)
+	n, err := unix.Lgetxattr(LookupFile(lower, "xattr"), "user.runtainer", value)
+	if errors.Is(err, unix.ENOTSUP) {
+		t.Log("Skipping xattrs, which the filesystem doesn't support")
+	} else if err != nil || string(value[:n]) != "value" {
+		t.Errorf("Expected xattr user.runtainer to be value, got %q (%v)", value[:n], err)
+	}
+}
+
+func TestUntarStaysInRootfs(t *testing.T) {
+	outside := t.TempDir()
+	tests := []struct {
+		name    string
+		entries []entry
+		path    string
+	}{
+		{"parent", []entry{file("../../escaped", "x")}, "escaped"},
+		{"absolute symlink", []entry{symlink("escape", outside), file("escape/escaped", "x")}, filepath.Join(strings.TrimPrefix(outside, "/"), "escaped")},
+		{"relative symlink", []entry{symlink("escape", "../../../../../.."+outside), file("escape/escaped", "x")}, filepath.Join(strings.TrimPrefix(outside, "/"), "escaped")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := mutate.AppendLayers(mustRandomImage(t), newLayer(t, tt.entries...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			lower := applyImage(t, img)
+			if content, err := os.ReadFile(LookupFile(lower, tt.path)); err != nil || string(content) != "x" {
+				t.Errorf("Expected %s in the rootfs, got %q (%v)", tt.path, content, err)
+			}
+			if _, err := os.Stat(filepath.Join(outside, "escaped")); err == nil {
+				t.Error("Expected nothing to be written outside the rootfs")
+			}
+		})
+	}
+
+	// Hard links to the host's files resolve in the rootfs, where there's
+	// nothing to link to
+	hardlink := entry{hdr: tar.Header{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "/etc/passwd"}}
+	img, err := mutate.AppendLayers(mustRandomImage(t), newLayer(t, hardlink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, _ := img.Layers()
+	r, _ := layers[len(layers)-1].Uncompressed()
+	if _, err := untarInto(r, t.TempDir(), nil); err == nil {
+		t.Error("Expected a hard link to a file outside the rootfs to fail")
+	}
+}
+
+func mustRandomImage(t *testing.T) v1.Image {
+	t.Helper()
+	img, err := random.Image(16, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
@@ -30,6 +30,11 @@ func ImageDir() string {
 	return filepath.Join(StateDir(), "images")
 }
 
+func LayerDir() string {
+	return filepath.Join(StateDir(), "layers")
+}
+
+// RootfsDir is where images were flattened before the layer store
 func RootfsDir() string {
 	return filepath.Join(StateDir(), "roots")
 }
@@ -0,0 +1,249 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultPath is searched for commands when PATH isn't set
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// hostMounts are bind mounted from the host into the container
+var hostMounts = []string{"/proc", "/sys", "/dev"}
+
+// Init sets up the container at containerDir and runs its command. It runs
+// as root of the user and mount namespaces created by RunCommand: it mounts
+// an overlay of the image's rootfs under the container's upper dir, pivots
+// into it and execs the command.
+func Init(containerDir string) error {
+	spec, err := loadSpec(containerDir)
+	if err != nil {
+		return fmt.Errorf("load container config: %w", err)
+	}
+	if len(spec.Args) == 0 {
+		return fmt.Errorf("no command given")
+	}
+	// Keep the container's mounts out of the host's namespace
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+
+	merged := mergedDir(containerDir)
+	lower, err := linkLowerDirs(containerDir, spec.Lower)
+	if err != nil {
+		return err
+	}
+	fuse, err := mountOverlay(lowerLinkDir(containerDir), lower, upperDir(containerDir), workDir(containerDir), merged)
+	if err != nil {
+		return err
+	}
+	for _, dir := range hostMounts {
+		target := filepath.Join(merged, dir)
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		if err := syscall.Mount(dir, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind mount %s: %w", dir, err)
+		}
+	}
+	if err := pivotRoot(merged); err != nil {
+		return err
+	}
+
+	// Like docker, the working directory is created if it's missing
+	if err := os.MkdirAll(spec.WorkingDir, 0755); err != nil {
+		return err
+	}
+	if err := os.Chdir(spec.WorkingDir); err != nil {
+		return err
+	}
+	path, err := lookPath(spec.Args[0], getEnv(spec.Env, "PATH"))
+	if err != nil {
+		return err
+	}
+	root := spec.UID == 0 && spec.GID == 0
+	if root && fuse == nil {
+		return syscall.Exec(path, spec.Args, spec.Env)
+	}
+
+	cmd := exec.Command(path)
+	cmd.Args = spec.Args
+	cmd.Env = spec.Env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if !root {
+		// Only the user running the container is mapped, to root, so other
+		// users get a nested namespace mapping them to it
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags: syscall.CLONE_NEWUSER,
+			UidMappings: []syscall.SysProcIDMap{
+				{ContainerID: spec.UID, HostID: 0, Size: 1},
+			},
+			GidMappings: []syscall.SysProcIDMap{
+				{ContainerID: spec.GID, HostID: 0, Size: 1},
+			},
+			GidMappingsEnableSetgroups: false,
+			Credential: &syscall.Credential{
+				Uid:         uint32(spec.UID),
+				Gid:         uint32(spec.GID),
+				NoSetGroups: true,
+			},
+		}
+	}
+	if fuse != nil {
+		// fuse-overlayfs serves the rootfs, so it has to outlive the command
+		defer func() {
+			_ = fuse.Process.Signal(syscall.SIGTERM)
+		}()
+	}
+	return supervise(cmd)
+}
+
+// linkLowerDirs links the lower directories into the container's lower link
+// directory by their index, and returns the lowerdir option naming them
+// relative to it. The mount data is limited to a page, which the paths of
+// a few dozen layers would exceed, like docker's overlay2 with its l/ links.
+func linkLowerDirs(containerDir string, lower []string) (string, error) {
+	dir := lowerLinkDir(containerDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	names := make([]string, len(lower))
+	for i, layer := range lower {
+		names[i] = strconv.Itoa(i)
+		if err := os.Symlink(layer, filepath.Join(dir, names[i])); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(names, ":"), nil
+}
+
+// mountOverlay mounts an overlay of lower, relative to dir, and upper at
+// merged. The kernel's overlayfs supports user namespaces since Linux 5.11,
+// and fuse-overlayfs is used where it doesn't, in which case its process is
+// returned.
+func mountOverlay(dir, lower, upper, work, merged string) (*exec.Cmd, error) {
+	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", lower, upper, work)
+	// The lower directories are looked up from the working directory
+	if err := os.Chdir(dir); err != nil {
+		return nil, err
+	}
+	// userxattr stores overlay attributes where an unprivileged user can
+	var kernelErr error
+	for _, data := range []string{options + ",userxattr", options} {
+		if kernelErr = syscall.Mount("overlay", merged, "overlay", 0, data); kernelErr == nil {
+			return nil, nil
+		}
+	}
+
+	fusePath, err := exec.LookPath("fuse-overlayfs")
+	if err != nil {
+		return nil, fmt.Errorf("mount overlay: %w, and fuse-overlayfs isn't installed", kernelErr)
+	}
+	parent, err := os.Stat(filepath.Dir(merged))
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(fusePath, "-f", "-o", options, merged)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	// Keep signals for the command, such as ^C, from stopping the mount
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start fuse-overlayfs: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	// merged is on another device once it's mounted
+	deadline := time.After(10 * time.Second)
+	for {
+		if info, err := os.Stat(merged); err == nil && device(info) != device(parent) {
+			return cmd, nil
+		}
+		select {
+		case err := <-exited:
+			return nil, fmt.Errorf("fuse-overlayfs: %v", err)
+		case <-deadline:
+			_ = cmd.Process.Kill()
+			return nil, fmt.Errorf("fuse-overlayfs didn't mount %s", merged)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func device(info os.FileInfo) uint64 {
+	return uint64(info.Sys().(*syscall.Stat_t).Dev)
+}
+
+// pivotRoot makes newRoot the root and detaches the old one
+func pivotRoot(newRoot string) error {
+	if err := os.Chdir(newRoot); err != nil {
+		return err
+	}
+	// Pivoting onto the same directory stacks the old root on the new one,
+	// without needing a directory in the image for it
+	if err := syscall.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := syscall.Unmount(".", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach the old root: %w", err)
+	}
+	return os.Chdir("/")
+}
+
+// lookPath finds name in path, the PATH of the container
+func lookPath(name, path string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	if path == "" {
+		path = defaultPath
+	}
+	for _, dir := range filepath.SplitList(path) {
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s: executable file not found in $PATH", name)
+}
+
+// getEnv returns the value of name in envs
+func getEnv(envs []string, name string) string {
+	for _, env := range envs {
+		if value, ok := strings.CutPrefix(env, name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// supervise runs the command, forwarding signals to it
+func supervise(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			// The terminal sends ^C and ^\ to the command too
+			if sig != syscall.SIGINT && sig != syscall.SIGQUIT {
+				_ = cmd.Process.Signal(sig)
+			}
+		}
+	}()
+
+	return cmd.Wait()
+}
@@ -1,43 +1,119 @@
 package runtime
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"github.com/jmelahman/runtainer/internal/paths"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+
+	"github.com/jmelahman/runtainer/internal/image"
+	"github.com/jmelahman/runtainer/internal/paths"
 )
 
-func RunCommand(imageID string, argv []string) error {
-	containerID := generateShortID()
-	containerDir := paths.ContainerDir(containerID)
-	upper := filepath.Join(containerDir, "upper")
-	work := filepath.Join(containerDir, "work")
-	merged := filepath.Join(containerDir, "merged")
-	lower := paths.RootfsDir()
+// RunCommand runs a new container of the image, with the image's config
+// applied to args and overridden by opts. The container's init runs as root
+// of a new user namespace, mapped to the current user like unshare
+// --map-root-user, with its own mount namespace for the overlay of the
+// image's layers.
+func RunCommand(imageID string, args []string, opts Options) error {
+	config, err := image.LoadConfig(imageID)
+	if err != nil {
+		return fmt.Errorf("config of image %s: %w", imageID, err)
+	}
+	// The layers are kept from garbage collection while the container runs
+	lower, release, err := image.UseLayers(imageID)
+	if err != nil {
+		return fmt.Errorf("layers of image %s: %w", imageID, err)
+	}
+	defer release()
+	spec, err := NewSpec(config.Config, lower, args, opts)
+	if err != nil {
+		return err
+	}
 
-	// Prepare directories
-	for _, dir := range []string{upper, work, merged} {
+	containerID, err := generateShortID()
+	if err != nil {
+		return err
+	}
+	containerDir := paths.ContainerDir(containerID)
+	// The container's changes in its upper directory go with it
+	defer func() {
+		_ = removeContainerDir(containerDir)
+	}()
+	for _, dir := range []string{upperDir(containerDir), workDir(containerDir), mergedDir(containerDir)} {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return err
 		}
 	}
+	if err := saveSpec(containerDir, spec); err != nil {
+		return err
+	}
 
-	// Mount overlay using fuse-overlayfs or similar (if available)
-	// OR use syscall.Mount if privileged.
-	// Placeholder: this is not implemented yet.
-	fmt.Printf("Would mount overlay: lower=%s, upper=%s, work=%s → merged=%s\n", lower, upper, work, merged)
-
-	// Unshare + chroot + exec
-	// cmd := exec.Command("unshare", "--mount", "--pid", "--fork", "--user", "--map-root-user", "chroot", merged, argv[0], argv[1:]...)
-	cmd := exec.Command("unshare", argv[1:]...)
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(self, "init", containerDir)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+		},
+		GidMappingsEnableSetgroups: false,
+	}
+	// The terminal sends ^C to the container too, which decides whether to
+	// exit
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGQUIT)
+	defer signal.Stop(signals)
 	return cmd.Run()
 }
 
-func generateShortID() string {
-	// Use first 6 chars of a random uuid or sha
-	return fmt.Sprintf("c%x", os.Getpid()) // quick placeholder
+// removeContainerDir removes the directory of an exited container, which
+// has directories the container made read-only and overlayfs' work
+// directory, which is left without permissions
+func removeContainerDir(containerDir string) error {
+	_ = filepath.WalkDir(containerDir, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && entry.IsDir() {
+			_ = os.Chmod(path, 0700)
+		}
+		return nil
+	})
+	return os.RemoveAll(containerDir)
+}
+
+func upperDir(containerDir string) string {
+	return filepath.Join(containerDir, "upper")
+}
+
+func workDir(containerDir string) string {
+	return filepath.Join(containerDir, "work")
+}
+
+// lowerLinkDir has the links to the lower directories of the container's
+// overlay
+func lowerLinkDir(containerDir string) string {
+	return filepath.Join(containerDir, "lower")
+}
+
+func mergedDir(containerDir string) string {
+	return filepath.Join(containerDir, "merged")
+}
+
+func generateShortID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
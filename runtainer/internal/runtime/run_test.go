@@ -0,0 +1,35 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveContainerDir(t *testing.T) {
+	containerDir := filepath.Join(t.TempDir(), "container")
+	readOnly := filepath.Join(upperDir(containerDir), "read-only")
+	// overlayfs leaves a work directory without permissions
+	work := filepath.Join(workDir(containerDir), "work")
+	for _, dir := range []string{readOnly, work, mergedDir(containerDir)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(readOnly, "file"), []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(work, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeContainerDir(containerDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(containerDir); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, got %v", containerDir, err)
+	}
+}
@@ -0,0 +1,140 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Options overrides the image config, like the flags of docker run
+type Options struct {
+	// Entrypoint replaces the image's entrypoint and clears its default
+	// command. An empty entrypoint resets it.
+	Entrypoint *string
+	// Env sets NAME=value, or NAME to the host's value if it's set
+	Env []string
+	// WorkingDir is an absolute path to run the command in
+	WorkingDir string
+	// User is a user and optional group, by name or ID: user[:group]
+	User string
+}
+
+// Spec is how a container runs, saved in its directory for its init
+type Spec struct {
+	// Lower are the directories of the rootfs, from the top layer down
+	Lower      []string `json:"lower"`
+	Args       []string `json:"args"`
+	Env        []string `json:"env"`
+	WorkingDir string   `json:"working_dir"`
+	UID        int      `json:"uid"`
+	GID        int      `json:"gid"`
+}
+
+// NewSpec combines the image config, the command and the options into a
+// Spec for running the rootfs at lower, where users are looked up
+func NewSpec(config v1.Config, lower []string, args []string, opts Options) (Spec, error) {
+	entrypoint, cmd := config.Entrypoint, config.Cmd
+	if opts.Entrypoint != nil {
+		entrypoint, cmd = nil, nil
+		if *opts.Entrypoint != "" {
+			entrypoint = []string{*opts.Entrypoint}
+		}
+	}
+	if len(args) > 0 {
+		cmd = args
+	}
+	spec := Spec{
+		Lower: lower,
+		Args:  append(append([]string{}, entrypoint...), cmd...),
+	}
+	if len(spec.Args) == 0 {
+		return Spec{}, fmt.Errorf("no command specified")
+	}
+
+	spec.WorkingDir = config.WorkingDir
+	if opts.WorkingDir != "" {
+		if !filepath.IsAbs(opts.WorkingDir) {
+			return Spec{}, fmt.Errorf("the working directory %q is invalid, it needs to be an absolute path", opts.WorkingDir)
+		}
+		spec.WorkingDir = opts.WorkingDir
+	}
+	if spec.WorkingDir == "" {
+		spec.WorkingDir = "/"
+	}
+
+	userSpec := config.User
+	if opts.User != "" {
+		userSpec = opts.User
+	}
+	user, err := lookupUser(lower, userSpec)
+	if err != nil {
+		return Spec{}, err
+	}
+	spec.UID, spec.GID = user.uid, user.gid
+
+	spec.Env = append([]string{}, config.Env...)
+	for _, env := range opts.Env {
+		if !strings.Contains(env, "=") {
+			value, ok := os.LookupEnv(env)
+			if !ok {
+				continue
+			}
+			env += "=" + value
+		}
+		spec.Env = setEnv(spec.Env, env)
+	}
+	if !hasEnv(spec.Env, "PATH") {
+		spec.Env = append(spec.Env, "PATH="+defaultPath)
+	}
+	if !hasEnv(spec.Env, "HOME") {
+		spec.Env = append(spec.Env, "HOME="+user.home)
+	}
+	return spec, nil
+}
+
+// setEnv sets the NAME=value env in envs
+func setEnv(envs []string, env string) []string {
+	name, _, _ := strings.Cut(env, "=")
+	for i, existing := range envs {
+		if strings.HasPrefix(existing, name+"=") {
+			envs[i] = env
+			return envs
+		}
+	}
+	return append(envs, env)
+}
+
+func hasEnv(envs []string, name string) bool {
+	for _, env := range envs {
+		if strings.HasPrefix(env, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+func specPath(containerDir string) string {
+	return filepath.Join(containerDir, "config.json")
+}
+
+func saveSpec(containerDir string, spec Spec) error {
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(specPath(containerDir), data, 0644)
+}
+
+func loadSpec(containerDir string) (Spec, error) {
+	var spec Spec
+	data, err := os.ReadFile(specPath(containerDir))
+	if err != nil {
+		return spec, err
+	}
+	err = json.Unmarshal(data, &spec)
+	return spec, err
+}
@@ -0,0 +1,278 @@
+package runtime
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/jmelahman/runtainer/internal/image"
+)
+
+const (
+	passwd = `root:x:0:0:root:/root:/bin/sh
+# comment
+app:x:1000:1000:App:/home/app:/bin/sh
+`
+	group = `root:x:0:
+app:x:1000:
+staff:x:50:app
+`
+)
+
+type file struct{ name, content string }
+
+// newLayer returns a layer of regular files
+func newLayer(t *testing.T, files ...file) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, file := range files {
+		hdr := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(file.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
+
+// buildImage writes an image tarball with the config, a layer with
+// /etc/passwd and /etc/group and the layers above it, and stores it
+func buildImage(t *testing.T, config v1.Config, layers ...v1.Layer) ([]string, *v1.ConfigFile) {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	base := newLayer(t, file{"etc/passwd", passwd}, file{"etc/group", group})
+	img, err := mutate.AppendLayers(empty.Image, append([]v1.Layer{base}, layers...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img, err = mutate.Config(img, config); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "image.tar")
+	if err := tarball.WriteToFile(path, name.MustParseReference("runtainer.test/image:latest"), img); err != nil {
+		t.Fatal(err)
+	}
+	imageID, err := image.ExtractImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile, err := image.LoadConfig(imageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lower, err := image.LayerDirs(imageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lower, configFile
+}
+
+func TestNewSpec(t *testing.T) {
+	lower, configFile := buildImage(t, v1.Config{
+		Entrypoint: []string{"/bin/entry", "--flag"},
+		Cmd:        []string{"serve"},
+		Env:        []string{"PATH=/app/bin:/bin", "MODE=image"},
+		WorkingDir: "/app",
+		User:       "app",
+	})
+	if configFile.Config.User != "app" {
+		t.Fatalf("Expected the stored config, got %+v", configFile.Config)
+	}
+	t.Setenv("HOST_VALUE", "host")
+	empty := ""
+	other := "/bin/other"
+
+	tests := []struct {
+		name     string
+		args     []string
+		opts     Options
+		expected Spec
+	}{
+		{
+			name: "image config",
+			expected: Spec{
+				Args:       []string{"/bin/entry", "--flag", "serve"},
+				Env:        []string{"PATH=/app/bin:/bin", "MODE=image", "HOME=/home/app"},
+				WorkingDir: "/app",
+				UID:        1000,
+				GID:        1000,
+			},
+		},
+		{
+			name: "command after the entrypoint",
+			args: []string{"migrate", "--all"},
+			expected: Spec{
+				Args:       []string{"/bin/entry", "--flag", "migrate", "--all"},
+				Env:        []string{"PATH=/app/bin:/bin", "MODE=image", "HOME=/home/app"},
+				WorkingDir: "/app",
+				UID:        1000,
+				GID:        1000,
+			},
+		},
+		{
+			name: "entrypoint clears the command",
+			opts: Options{Entrypoint: &other},
+			expected: Spec{
+				Args:       []string{"/bin/other"},
+				Env:        []string{"PATH=/app/bin:/bin", "MODE=image", "HOME=/home/app"},
+				WorkingDir: "/app",
+				UID:        1000,
+				GID:        1000,
+			},
+		},
+		{
+			name: "empty entrypoint",
+			args: []string{"sh"},
+			opts: Options{Entrypoint: &empty},
+			expected: Spec{
+				Args:       []string{"sh"},
+				Env:        []string{"PATH=/app/bin:/bin", "MODE=image", "HOME=/home/app"},
+				WorkingDir: "/app",
+				UID:        1000,
+				GID:        1000,
+			},
+		},
+		{
+			name: "overrides",
+			opts: Options{
+				Env:        []string{"MODE=flag", "HOST_VALUE", "UNSET_VALUE", "HOME=/tmp"},
+				WorkingDir: "/srv",
+				User:       "root:staff",
+			},
+			expected: Spec{
+				Args:       []string{"/bin/entry", "--flag", "serve"},
+				Env:        []string{"PATH=/app/bin:/bin", "MODE=flag", "HOST_VALUE=host", "HOME=/tmp"},
+				WorkingDir: "/srv",
+				UID:        0,
+				GID:        50,
+			},
+		},
+		{
+			name: "IDs without entries",
+			opts: Options{User: "2000:3000"},
+			expected: Spec{
+				Args:       []string{"/bin/entry", "--flag", "serve"},
+				Env:        []string{"PATH=/app/bin:/bin", "MODE=image", "HOME=/"},
+				WorkingDir: "/app",
+				UID:        2000,
+				GID:        3000,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := NewSpec(configFile.Config, lower, tt.args, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.expected.Lower = lower
+			if !reflect.DeepEqual(spec, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, spec)
+			}
+		})
+	}
+}
+
+func TestNewSpecDefaults(t *testing.T) {
+	lower, configFile := buildImage(t, v1.Config{Cmd: []string{"sh"}})
+
+	spec, err := NewSpec(configFile.Config, lower, nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Spec{
+		Lower:      lower,
+		Args:       []string{"sh"},
+		Env:        []string{"PATH=" + defaultPath, "HOME=/root"},
+		WorkingDir: "/",
+	}
+	if !reflect.DeepEqual(spec, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, spec)
+	}
+}
+
+func TestNewSpecErrors(t *testing.T) {
+	lower, configFile := buildImage(t, v1.Config{})
+	empty := ""
+
+	tests := []struct {
+		name string
+		args []string
+		opts Options
+	}{
+		{"no command", nil, Options{}},
+		{"entrypoint reset", nil, Options{Entrypoint: &empty}},
+		{"relative workdir", []string{"sh"}, Options{WorkingDir: "app"}},
+		{"unknown user", []string{"sh"}, Options{User: "nobody"}},
+		{"unknown group", []string{"sh"}, Options{User: "root:nogroup"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSpec(configFile.Config, lower, tt.args, tt.opts); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestNewSpecManyLayers(t *testing.T) {
+	var layers []v1.Layer
+	for i := 0; i < 63; i++ {
+		layers = append(layers, newLayer(t, file{fmt.Sprintf("layer/%d", i), fmt.Sprint(i)}))
+	}
+	lower, configFile := buildImage(t, v1.Config{Cmd: []string{"sh"}, User: "app"}, layers...)
+	if len(lower) != 64 {
+		t.Fatalf("Expected 64 layers, got %d", len(lower))
+	}
+
+	spec, err := NewSpec(configFile.Config, lower, nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.UID != 1000 {
+		t.Errorf("Expected the user from the bottom layer, got %d", spec.UID)
+	}
+
+	// The options have to fit in the page of mount data
+	containerDir := t.TempDir()
+	option, err := linkLowerDirs(containerDir, spec.Lower)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s,userxattr", option, upperDir(containerDir), workDir(containerDir))
+	if len(options) >= os.Getpagesize() {
+		t.Errorf("Expected the mount options to fit in a page, got %d bytes", len(options))
+	}
+	for i, name := range strings.Split(option, ":") {
+		target, err := os.Readlink(filepath.Join(lowerLinkDir(containerDir), name))
+		if err != nil || target != spec.Lower[i] {
+			t.Errorf("Expected %s to link to %s, got %s (%v)", name, spec.Lower[i], target, err)
+		}
+	}
+}
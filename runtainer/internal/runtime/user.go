@@ -0,0 +1,125 @@
+package runtime
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jmelahman/runtainer/internal/image"
+)
+
+// execUser is who a container's command runs as
+type execUser struct {
+	uid  int
+	gid  int
+	home string
+}
+
+// lookupUser resolves user[:group] against /etc/passwd and /etc/group of
+// the rootfs like docker does. Users and groups without entries can be
+// given by ID, and no user is root.
+func lookupUser(lower []string, spec string) (execUser, error) {
+	user := execUser{home: "/"}
+	userArg, groupArg, hasGroup := strings.Cut(spec, ":")
+	if userArg == "" {
+		userArg = "0"
+	}
+
+	entries, err := readDatabase(lower, "/etc/passwd")
+	if err != nil {
+		return user, err
+	}
+	uid, numeric := parseID(userArg)
+	found := false
+	for _, entry := range entries {
+		// name:password:uid:gid:gecos:home:shell
+		if len(entry) < 7 {
+			continue
+		}
+		entryUID, _ := parseID(entry[2])
+		if entry[0] != userArg && !(numeric && entryUID == uid) {
+			continue
+		}
+		entryGID, _ := parseID(entry[3])
+		user = execUser{uid: entryUID, gid: entryGID, home: entry[5]}
+		found = true
+		break
+	}
+	if !found {
+		if !numeric {
+			return user, fmt.Errorf("unable to find user %s: no matching entries in passwd file", userArg)
+		}
+		user.uid = uid
+	}
+
+	if !hasGroup {
+		return user, nil
+	}
+	entries, err = readDatabase(lower, "/etc/group")
+	if err != nil {
+		return user, err
+	}
+	gid, numeric := parseID(groupArg)
+	for _, entry := range entries {
+		// name:password:gid:members
+		if len(entry) < 3 {
+			continue
+		}
+		entryGID, _ := parseID(entry[2])
+		if entry[0] == groupArg || (numeric && entryGID == gid) {
+			user.gid = entryGID
+			return user, nil
+		}
+	}
+	if !numeric {
+		return user, fmt.Errorf("unable to find group %s: no matching entries in group file", groupArg)
+	}
+	user.gid = gid
+	return user, nil
+}
+
+// parseID parses a user or group ID
+func parseID(s string) (int, bool) {
+	id, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return int(id), true
+}
+
+// readDatabase reads the colon separated entries of a file like
+// /etc/passwd from the top layer of the rootfs that has it, if any
+func readDatabase(lower []string, name string) ([][]string, error) {
+	path := image.LookupFile(lower, name)
+	if path == "" {
+		return nil, nil
+	}
+	// A symlink would be resolved on the host rather than in the rootfs
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var entries [][]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, strings.Split(line, ":"))
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,267 @@
+package check
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/jmelahman/tag/git"
+	"github.com/jmelahman/tag/semver"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kind categorizes a finding
+type Kind string
+
+const (
+	// Untagged means HEAD has no tag to check
+	Untagged Kind = "untagged"
+	// SkippedVersion means the expected predecessor tag does not exist, and
+	// the tag is neither an initial version nor the first of its prefix and
+	// suffix
+	SkippedVersion Kind = "skipped-version"
+	// MissingPredecessor means the expected predecessor exists but is not an
+	// ancestor of the tag
+	MissingPredecessor Kind = "missing-predecessor"
+	// LargerAncestor means a larger stable version is an ancestor of the tag
+	LargerAncestor Kind = "larger-ancestor"
+)
+
+// Finding is a single problem found while checking a tag
+type Finding struct {
+	Kind    Kind   `json:"kind"`
+	Tag     string `json:"tag,omitempty"`
+	Related string `json:"related,omitempty"`
+	Message string `json:"message"`
+}
+
+// TagResult records the outcome of checking a single tag
+type TagResult struct {
+	Tag         string `json:"tag"`
+	Predecessor string `json:"predecessor,omitempty"`
+	// Retracted lists the retracted versions skipped to reach Predecessor
+	Retracted []string `json:"retracted,omitempty"`
+	Valid     bool     `json:"valid"`
+}
+
+// Report collects the results of a check run
+type Report struct {
+	Tags     []TagResult `json:"tags"`
+	Findings []Finding   `json:"findings"`
+}
+
+// OK reports whether the check found no problems
+func (r *Report) OK() bool {
+	return len(r.Findings) == 0
+}
+
+// Repository is the subset of git operations the checks depend on
+type Repository interface {
+	TagExists(tag string) (bool, error)
+	// MergedTags lists the tags reachable from ref
+	MergedTags(ref string) ([]string, error)
+}
+
+type gitRepository struct{}
+
+func (gitRepository) TagExists(tag string) (bool, error) {
+	return git.TagExists(tag)
+}
+
+func (gitRepository) MergedTags(ref string) ([]string, error) {
+	return git.MergedTags(ref)
+}
+
+// Checker validates tags against the other tags in the repository
+type Checker struct {
+	Repo Repository
+	// AllTags are the tags considered when looking for larger versions
+	AllTags []string
+	// Retracted are deleted tags whose absence is not reported as a skipped
+	// version. The check continues with the retracted tag's own predecessor.
+	Retracted []string
+
+	// merged caches the tags reachable from each ref checked
+	merged map[string]map[string]bool
+}
+
+// New returns a Checker backed by the git repository in the working directory
+func New(allTags []string) *Checker {
+	return &Checker{Repo: gitRepository{}, AllTags: allTags}
+}
+
+// UntaggedReport returns a report for a HEAD without a tag
+func UntaggedReport() *Report {
+	return &Report{
+		Tags: []TagResult{},
+		Findings: []Finding{{
+			Kind:    Untagged,
+			Tag:     "HEAD",
+			Message: "HEAD is not tagged",
+		}},
+	}
+}
+
+// Check validates each of tags and collects the findings into a single report
+func (c *Checker) Check(tags []string) (*Report, error) {
+	report := &Report{Tags: []TagResult{}, Findings: []Finding{}}
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		result, findings, err := c.CheckTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		report.Tags = append(report.Tags, result)
+		report.Findings = append(report.Findings, findings...)
+	}
+	return report, nil
+}
+
+// CheckHistory validates tags, such as every tag reachable from HEAD, and
+// reports a HEAD without a tag unless allowUntagged is set. head is the tag
+// at HEAD, or empty if there is none.
+func (c *Checker) CheckHistory(head string, tags []string, allowUntagged bool) (*Report, error) {
+	report, err := c.Check(tags)
+	if err != nil {
+		return nil, err
+	}
+	if head == "" && !allowUntagged {
+		report.Findings = append(UntaggedReport().Findings, report.Findings...)
+	}
+	return report, nil
+}
+
+// mergedTags returns the set of tags reachable from ref, which is loaded
+// once so that ancestry is checked in memory
+func (c *Checker) mergedTags(ref string) (map[string]bool, error) {
+	if tags, ok := c.merged[ref]; ok {
+		return tags, nil
+	}
+	tags, err := c.Repo.MergedTags(ref)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	if c.merged == nil {
+		c.merged = make(map[string]map[string]bool)
+	}
+	c.merged[ref] = set
+	return set, nil
+}
+
+// isFirst reports whether no smaller version with the same prefix and suffix
+// as tag is among ancestors, so the tag starts its version history
+func isFirst(tag string, ancestors map[string]bool) bool {
+	version, err := semver.ParseSemver(tag)
+	if err != nil {
+		return false
+	}
+	for ancestor := range ancestors {
+		other, err := semver.ParseSemver(ancestor)
+		if err != nil || other.Prefix != version.Prefix || other.PreRelease != version.PreRelease {
+			continue
+		}
+		if semver.CompareSemver(version, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckTag validates that the previous version of tag is its ancestor and
+// that no larger version is
+func (c *Checker) CheckTag(tag string) (TagResult, []Finding, error) {
+	return c.CheckRef(tag, tag)
+}
+
+// CheckRef validates tag as if it pointed at ref. This allows checking a tag
+// before it is created.
+func (c *Checker) CheckRef(tag, ref string) (TagResult, []Finding, error) {
+	log.WithFields(log.Fields{
+		"tag": tag,
+		"ref": ref,
+	}).Debug("CheckRef")
+	result := TagResult{Tag: tag}
+	var findings []Finding
+
+	ancestors, err := c.mergedTags(ref)
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to check ancestry: %w", err)
+	}
+
+	largerTags, err := semver.FindLargerVersions(tag, c.AllTags)
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to find larger versions: %w", err)
+	}
+	for _, largerTag := range largerTags {
+		if ancestors[largerTag] {
+			findings = append(findings, Finding{
+				Kind:    LargerAncestor,
+				Tag:     tag,
+				Related: largerTag,
+				Message: fmt.Sprintf("Larger tag '%s' is an ancestor of current tag '%s'", largerTag, tag),
+			})
+		}
+	}
+
+	expectedPred, err := semver.GetExpectedPredecessor(tag)
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to get expected predecessor: %w", err)
+	}
+
+	// Retracted versions are skipped-but-allowed, so expect their predecessor instead
+	predExists := false
+	for expectedPred != "" {
+		predExists = ancestors[expectedPred]
+		if !predExists {
+			predExists, err = c.Repo.TagExists(expectedPred)
+			if err != nil {
+				return result, nil, fmt.Errorf("failed to check tag existence: %w", err)
+			}
+		}
+		if predExists || !slices.Contains(c.Retracted, expectedPred) {
+			break
+		}
+		log.WithField("tag", expectedPred).Debug("CheckRef: skipping retracted predecessor")
+		result.Retracted = append(result.Retracted, expectedPred)
+		expectedPred, err = semver.GetExpectedPredecessor(expectedPred)
+		if err != nil {
+			return result, nil, fmt.Errorf("failed to get expected predecessor: %w", err)
+		}
+	}
+	result.Predecessor = expectedPred
+
+	// v0.0.0 or similar - no predecessor expected
+	if expectedPred != "" {
+		// A project starts at an initial version or wherever its first tag is
+		if !predExists && (semver.IsInitialVersion(tag) || isFirst(tag, ancestors)) {
+			log.WithField("tag", tag).Debug("CheckRef: no predecessor required")
+			result.Predecessor = ""
+		} else if !predExists {
+			findings = append(findings, Finding{
+				Kind:    SkippedVersion,
+				Tag:     tag,
+				Related: expectedPred,
+				Message: fmt.Sprintf("Expected predecessor tag '%s' does not exist (version skipped)", expectedPred),
+			})
+		} else if !ancestors[expectedPred] {
+			findings = append(findings, Finding{
+				Kind:    MissingPredecessor,
+				Tag:     tag,
+				Related: expectedPred,
+				Message: fmt.Sprintf("Previous tag '%s' is not an ancestor of current tag '%s'", expectedPred, tag),
+			})
+		}
+	}
+
+	result.Valid = len(findings) == 0
+	log.WithFields(log.Fields{
+		"tag":      tag,
+		"findings": len(findings),
+	}).Debug("CheckRef: done")
+	return result, findings, nil
+}
@@ -0,0 +1,223 @@
+package check
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRepository models a linear history where each tag is an ancestor of
+// every tag that comes after it in history
+type fakeRepository struct {
+	history []string
+}
+
+func (r *fakeRepository) TagExists(tag string) (bool, error) {
+	return slices.Contains(r.history, tag), nil
+}
+
+func (r *fakeRepository) MergedTags(ref string) ([]string, error) {
+	return r.history[:slices.Index(r.history, ref)+1], nil
+}
+
+func TestCheck(t *testing.T) {
+	testCases := []struct {
+		name      string
+		history   []string
+		allTags   []string
+		retracted []string
+		tags      []string
+		expected  []Finding
+	}{
+		{
+			name:    "First version",
+			history: []string{"v0.0.0"},
+			tags:    []string{"v0.0.0"},
+		},
+		{
+			name:    "Valid history",
+			history: []string{"v0.0.0", "v0.0.1", "v0.1.0", "v1.0.0"},
+			tags:    []string{"v0.0.0", "v0.0.1", "v0.1.0", "v1.0.0"},
+		},
+		{
+			name:    "Initial patch versions",
+			history: []string{"v0.0.1", "v0.0.2"},
+			tags:    []string{"v0.0.1", "v0.0.2"},
+		},
+		{
+			name:    "Initial versions after others",
+			history: []string{"v0.0.1", "v0.1.0", "v0.2.0", "v1.0.0"},
+			tags:    []string{"v0.0.1", "v0.1.0", "v0.2.0", "v1.0.0"},
+		},
+		{
+			name:    "First tag of a prefix",
+			history: []string{"v0.0.1", "lib/v2.3.0", "lib/v2.3.1"},
+			tags:    []string{"lib/v2.3.0", "lib/v2.3.1"},
+		},
+		{
+			name:    "Skipped version",
+			history: []string{"v1.0.0", "v1.0.2"},
+			tags:    []string{"v1.0.0", "v1.0.2"},
+			expected: []Finding{
+				{Kind: SkippedVersion, Tag: "v1.0.2", Related: "v1.0.1", Message: "Expected predecessor tag 'v1.0.1' does not exist (version skipped)"},
+			},
+		},
+		{
+			name:    "Skipped version after the first tag",
+			history: []string{"v2.3.0", "v2.5.0"},
+			tags:    []string{"v2.3.0", "v2.5.0"},
+			expected: []Finding{
+				{Kind: SkippedVersion, Tag: "v2.5.0", Related: "v2.4.0", Message: "Expected predecessor tag 'v2.4.0' does not exist (version skipped)"},
+			},
+		},
+		{
+			name:    "Missing predecessor",
+			history: []string{"v0.0.0", "v0.0.2", "v0.0.1"},
+			allTags: []string{"v0.0.0", "v0.0.1", "v0.0.2"},
+			tags:    []string{"v0.0.2"},
+			expected: []Finding{
+				{Kind: MissingPredecessor, Tag: "v0.0.2", Related: "v0.0.1", Message: "Previous tag 'v0.0.1' is not an ancestor of current tag 'v0.0.2'"},
+			},
+		},
+		{
+			name:    "Larger ancestor",
+			history: []string{"v0.0.0", "v0.1.0", "v0.0.1"},
+			allTags: []string{"v0.0.0", "v0.0.1", "v0.1.0"},
+			tags:    []string{"v0.0.1"},
+			expected: []Finding{
+				{Kind: LargerAncestor, Tag: "v0.0.1", Related: "v0.1.0", Message: "Larger tag 'v0.1.0' is an ancestor of current tag 'v0.0.1'"},
+			},
+		},
+		{
+			name:      "Retracted predecessor",
+			history:   []string{"v1.0.0", "v1.0.3"},
+			retracted: []string{"v1.0.1", "v1.0.2"},
+			tags:      []string{"v1.0.3"},
+		},
+		{
+			name:      "Retracted predecessor of unrelated version",
+			history:   []string{"v1.0.0", "v1.0.3"},
+			retracted: []string{"v1.0.1"},
+			tags:      []string{"v1.0.3"},
+			expected: []Finding{
+				{Kind: SkippedVersion, Tag: "v1.0.3", Related: "v1.0.2", Message: "Expected predecessor tag 'v1.0.2' does not exist (version skipped)"},
+			},
+		},
+		{
+			name:    "Pre-release",
+			history: []string{"v1.0.0", "v1.0.1-rc.1"},
+			tags:    []string{"v1.0.1-rc.1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			allTags := tc.allTags
+			if allTags == nil {
+				allTags = tc.history
+			}
+			checker := &Checker{Repo: &fakeRepository{history: tc.history}, AllTags: allTags, Retracted: tc.retracted}
+
+			report, err := checker.Check(tc.tags)
+
+			require.NoError(t, err)
+			if tc.expected == nil {
+				tc.expected = []Finding{}
+			}
+			assert.Equal(t, tc.expected, report.Findings)
+			assert.Equal(t, len(tc.expected) == 0, report.OK())
+			assert.Len(t, report.Tags, len(tc.tags))
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	report := &Report{
+		Tags: []TagResult{
+			{Tag: "v1.0.0", Predecessor: "v0.0.0", Valid: true},
+			{Tag: "v1.0.2", Predecessor: "v1.0.1"},
+		},
+		Findings: []Finding{
+			{Kind: SkippedVersion, Tag: "v1.0.2", Related: "v1.0.1", Message: "Expected predecessor tag 'v1.0.1' does not exist (version skipped)"},
+		},
+	}
+
+	var text bytes.Buffer
+	require.NoError(t, report.Write(&text, FormatText))
+	assert.Equal(t, "Error: Expected predecessor tag 'v1.0.1' does not exist (version skipped)\nTag 'v1.0.0' is valid (previous version 'v0.0.0' is an ancestor)\n", text.String())
+
+	var github bytes.Buffer
+	require.NoError(t, report.Write(&github, FormatGitHub))
+	assert.Equal(t, "::error title=skipped-version::Expected predecessor tag 'v1.0.1' does not exist (version skipped)\n", github.String())
+
+	var encoded bytes.Buffer
+	require.NoError(t, report.Write(&encoded, FormatJSON))
+	var decoded Report
+	require.NoError(t, json.Unmarshal(encoded.Bytes(), &decoded))
+	assert.Equal(t, *report, decoded)
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("github")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatGitHub, format)
+
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestCheckRef(t *testing.T) {
+	checker := &Checker{
+		Repo:    &fakeRepository{history: []string{"v1.3.0", "v1.4.0-rc.1", "HEAD"}},
+		AllTags: []string{"v1.3.0", "v1.4.0-rc.1"},
+	}
+
+	result, findings, err := checker.CheckRef("v1.4.0", "HEAD")
+
+	require.NoError(t, err)
+	assert.Empty(t, findings)
+	assert.Equal(t, TagResult{Tag: "v1.4.0", Predecessor: "v1.3.0", Valid: true}, result)
+}
+
+func TestCheckHistory(t *testing.T) {
+	checker := &Checker{Repo: &fakeRepository{history: []string{"v1.0.0", "v1.0.2"}}, AllTags: []string{"v1.0.0", "v1.0.2"}}
+	untagged := UntaggedReport().Findings[0]
+	skipped := Finding{Kind: SkippedVersion, Tag: "v1.0.2", Related: "v1.0.1", Message: "Expected predecessor tag 'v1.0.1' does not exist (version skipped)"}
+
+	// Every tag is checked even when HEAD is untagged
+	report, err := checker.CheckHistory("", []string{"v1.0.0", "v1.0.2"}, true)
+	require.NoError(t, err)
+	assert.Len(t, report.Tags, 2)
+	assert.Equal(t, []Finding{skipped}, report.Findings)
+
+	report, err = checker.CheckHistory("", []string{"v1.0.2"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Finding{untagged, skipped}, report.Findings)
+
+	report, err = checker.CheckHistory("", nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Finding{untagged}, report.Findings)
+
+	report, err = checker.CheckHistory("v1.0.2", []string{"v1.0.2"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Finding{skipped}, report.Findings)
+}
+
+func TestCheckHistoryFromFirstTag(t *testing.T) {
+	// The first tags tag itself creates have no predecessor
+	history := []string{"v0.0.1", "v0.0.2"}
+	checker := &Checker{Repo: &fakeRepository{history: history}, AllTags: history}
+
+	report, err := checker.CheckHistory("", history, true)
+
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "findings: %v", report.Findings)
+	assert.Equal(t, []TagResult{
+		{Tag: "v0.0.1", Valid: true},
+		{Tag: "v0.0.2", Predecessor: "v0.0.1", Valid: true},
+	}, report.Tags)
+}
@@ -0,0 +1,100 @@
+package check
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format selects how a report is written
+type Format string
+
+const (
+	FormatText   Format = "text"
+	FormatJSON   Format = "json"
+	FormatGitHub Format = "github"
+)
+
+// Formats lists the supported output formats
+var Formats = []Format{FormatText, FormatJSON, FormatGitHub}
+
+// ParseFormat returns the Format named by s
+func ParseFormat(s string) (Format, error) {
+	for _, format := range Formats {
+		if string(format) == s {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format '%s' (expected one of: text, json, github)", s)
+}
+
+// Write writes the report to w in the given format
+func (r *Report) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatText:
+		return r.WriteText(w)
+	case FormatJSON:
+		return r.WriteJSON(w)
+	case FormatGitHub:
+		return r.WriteGitHub(w)
+	default:
+		return fmt.Errorf("unknown format '%s'", format)
+	}
+}
+
+// WriteText writes a human-readable summary of the report
+func (r *Report) WriteText(w io.Writer) error {
+	for _, finding := range r.Findings {
+		if _, err := fmt.Fprintf(w, "Error: %s\n", finding.Message); err != nil {
+			return err
+		}
+	}
+	for _, result := range r.Tags {
+		if !result.Valid {
+			continue
+		}
+		var err error
+		if len(result.Retracted) > 0 {
+			_, err = fmt.Fprintf(w, "Tag '%s' skips retracted version(s) %s\n", result.Tag, strings.Join(result.Retracted, ", "))
+			if err != nil {
+				return err
+			}
+		}
+		if result.Predecessor == "" {
+			_, err = fmt.Fprintf(w, "Tag '%s' is valid (first version)\n", result.Tag)
+		} else {
+			_, err = fmt.Fprintf(w, "Tag '%s' is valid (previous version '%s' is an ancestor)\n", result.Tag, result.Predecessor)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the report as a JSON document
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteGitHub writes each finding as a GitHub Actions error annotation
+func (r *Report) WriteGitHub(w io.Writer) error {
+	for _, finding := range r.Findings {
+		if _, err := fmt.Fprintf(w, "::error title=%s::%s\n", escapeProperty(string(finding.Kind)), escapeData(finding.Message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// See https://github.com/actions/toolkit/blob/main/packages/core/src/command.ts
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
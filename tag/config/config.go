@@ -0,0 +1,175 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/pelletier/go-toml/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// FileName is the dedicated config file looked up at the repository root
+	FileName = ".tag.toml"
+	// PyProjectFileName is the fallback file, read from its [tool.tag] table
+	PyProjectFileName = "pyproject.toml"
+)
+
+// Config holds the repository-level defaults and tagging policies
+type Config struct {
+	Prefix string `toml:"prefix"`
+	Suffix string `toml:"suffix"`
+	Remote string `toml:"remote"`
+	Push   bool   `toml:"push"`
+
+	// AllowedChannels restricts which pre-release suffixes may be used.
+	// An empty list allows any suffix.
+	AllowedChannels []string `toml:"allowed-channels"`
+	// RequireCleanTree refuses to tag when the working tree has changes
+	RequireCleanTree bool `toml:"require-clean-tree"`
+	// RequireBranch only allows tagging from a matching branch. It may be a
+	// glob such as "release/*".
+	RequireBranch string `toml:"require-branch"`
+	// Message is a text/template for the tag annotation. When set, annotated
+	// tags are created instead of lightweight ones.
+	Message string `toml:"message"`
+
+	// Source is the file the config was loaded from, if any
+	Source string `toml:"-"`
+}
+
+type pyProject struct {
+	Tool struct {
+		Tag *Config `toml:"tag"`
+	} `toml:"tool"`
+}
+
+// MessageData is passed to the message template
+type MessageData struct {
+	Tag      string
+	Previous string
+	Remote   string
+	Branch   string
+}
+
+// Load reads the config from root. The dedicated .tag.toml takes precedence
+// over the [tool.tag] table of pyproject.toml. An empty config is returned
+// when neither exists.
+func Load(root string) (*Config, error) {
+	configPath := filepath.Join(root, FileName)
+	data, err := os.ReadFile(configPath)
+	if err == nil {
+		log.WithField("path", configPath).Debug("Load: reading config")
+		cfg := &Config{}
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", configPath, err)
+		}
+		cfg.Source = configPath
+		return cfg, cfg.Validate()
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", configPath, err)
+	}
+
+	pyProjectPath := filepath.Join(root, PyProjectFileName)
+	data, err = os.ReadFile(pyProjectPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			log.WithField("root", root).Debug("Load: no config found")
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", pyProjectPath, err)
+	}
+
+	var project pyProject
+	if err := toml.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", pyProjectPath, err)
+	}
+	if project.Tool.Tag == nil {
+		log.WithField("path", pyProjectPath).Debug("Load: no [tool.tag] table found")
+		return &Config{}, nil
+	}
+	log.WithField("path", pyProjectPath).Debug("Load: reading [tool.tag] config")
+	cfg := project.Tool.Tag
+	cfg.Source = pyProjectPath
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the config values are well-formed
+func (c *Config) Validate() error {
+	if c.RequireBranch != "" {
+		if _, err := path.Match(c.RequireBranch, ""); err != nil {
+			return fmt.Errorf("invalid require-branch pattern %q: %w", c.RequireBranch, err)
+		}
+	}
+	if c.Message != "" {
+		if _, err := template.New("message").Parse(c.Message); err != nil {
+			return fmt.Errorf("invalid message template: %w", err)
+		}
+	}
+	if c.Suffix != "" {
+		if err := c.CheckChannel(c.Suffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckChannel returns an error if suffix is not one of the allowed channels
+func (c *Config) CheckChannel(suffix string) error {
+	if suffix == "" || len(c.AllowedChannels) == 0 {
+		return nil
+	}
+	if !slices.Contains(c.AllowedChannels, suffix) {
+		return fmt.Errorf("pre-release channel '%s' is not allowed (allowed: %s)", suffix, strings.Join(c.AllowedChannels, ", "))
+	}
+	return nil
+}
+
+// CheckPolicy returns an error if tagging is not allowed from the given
+// branch and working tree state
+func (c *Config) CheckPolicy(branch string, clean bool) error {
+	if c.RequireCleanTree && !clean {
+		return errors.New("working tree has uncommitted changes (require-clean-tree is set)")
+	}
+	if c.RequireBranch != "" {
+		if branch == "" {
+			return fmt.Errorf("HEAD is detached but tagging requires branch '%s'", c.RequireBranch)
+		}
+		matched, err := path.Match(c.RequireBranch, branch)
+		if err != nil {
+			return fmt.Errorf("invalid require-branch pattern %q: %w", c.RequireBranch, err)
+		}
+		if !matched {
+			return fmt.Errorf("tagging is only allowed from branch '%s', not '%s'", c.RequireBranch, branch)
+		}
+	}
+	return nil
+}
+
+// RenderMessage executes the message template. It returns an empty string
+// when no template is configured.
+func (c *Config) RenderMessage(data MessageData) (string, error) {
+	if c.Message == "" {
+		return "", nil
+	}
+	tmpl, err := template.New("message").Parse(c.Message)
+	if err != nil {
+		return "", fmt.Errorf("invalid message template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render message template: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		name        string
+		files       map[string]string
+		expected    *Config
+		expectError bool
+	}{
+		{
+			name:     "No config",
+			expected: &Config{},
+		},
+		{
+			name: "Tag config file",
+			files: map[string]string{
+				FileName: `
+prefix = "api"
+remote = "upstream"
+push = true
+allowed-channels = ["beta", "rc"]
+require-clean-tree = true
+require-branch = "main"
+message = "Release {{ .Tag }}"
+`,
+			},
+			expected: &Config{
+				Prefix:           "api",
+				Remote:           "upstream",
+				Push:             true,
+				AllowedChannels:  []string{"beta", "rc"},
+				RequireCleanTree: true,
+				RequireBranch:    "main",
+				Message:          "Release {{ .Tag }}",
+				Source:           FileName,
+			},
+		},
+		{
+			name: "Pyproject tool table",
+			files: map[string]string{
+				PyProjectFileName: `
+[project]
+name = "example"
+
+[tool.tag]
+suffix = "rc"
+`,
+			},
+			expected: &Config{
+				Suffix: "rc",
+				Source: PyProjectFileName,
+			},
+		},
+		{
+			name: "Pyproject without tool table",
+			files: map[string]string{
+				PyProjectFileName: `
+[project]
+name = "example"
+`,
+			},
+			expected: &Config{},
+		},
+		{
+			name: "Tag config file takes precedence",
+			files: map[string]string{
+				FileName:          `prefix = "from-tag"`,
+				PyProjectFileName: "[tool.tag]\nprefix = \"from-pyproject\"\n",
+			},
+			expected: &Config{
+				Prefix: "from-tag",
+				Source: FileName,
+			},
+		},
+		{
+			name: "Unknown key",
+			files: map[string]string{
+				FileName: `prefixx = "api"`,
+			},
+			expectError: true,
+		},
+		{
+			name: "Suffix not in allowed channels",
+			files: map[string]string{
+				FileName: "suffix = \"alpha\"\nallowed-channels = [\"rc\"]\n",
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid message template",
+			files: map[string]string{
+				FileName: `message = "{{ .Tag"`,
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tc.files {
+				writeFile(t, dir, name, content)
+			}
+
+			cfg, err := Load(dir)
+
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.expected.Source != "" {
+				tc.expected.Source = filepath.Join(dir, tc.expected.Source)
+			}
+			assert.Equal(t, tc.expected, cfg)
+		})
+	}
+}
+
+func TestCheckChannel(t *testing.T) {
+	cfg := &Config{AllowedChannels: []string{"beta", "rc"}}
+	assert.NoError(t, cfg.CheckChannel(""))
+	assert.NoError(t, cfg.CheckChannel("rc"))
+	assert.Error(t, cfg.CheckChannel("alpha"))
+	assert.NoError(t, (&Config{}).CheckChannel("alpha"))
+}
+
+func TestCheckPolicy(t *testing.T) {
+	testCases := []struct {
+		name        string
+		cfg         *Config
+		branch      string
+		clean       bool
+		expectError bool
+	}{
+		{
+			name:   "No policies",
+			cfg:    &Config{},
+			branch: "feature",
+		},
+		{
+			name:        "Dirty tree",
+			cfg:         &Config{RequireCleanTree: true},
+			branch:      "main",
+			expectError: true,
+		},
+		{
+			name:   "Clean tree",
+			cfg:    &Config{RequireCleanTree: true},
+			branch: "main",
+			clean:  true,
+		},
+		{
+			name:        "Wrong branch",
+			cfg:         &Config{RequireBranch: "main"},
+			branch:      "feature",
+			expectError: true,
+		},
+		{
+			name:        "Detached HEAD",
+			cfg:         &Config{RequireBranch: "main"},
+			expectError: true,
+		},
+		{
+			name:   "Branch glob",
+			cfg:    &Config{RequireBranch: "release/*"},
+			branch: "release/1.2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.CheckPolicy(tc.branch, tc.clean)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRenderMessage(t *testing.T) {
+	cfg := &Config{Message: "Release {{ .Tag }} (previous: {{ .Previous }})"}
+	message, err := cfg.RenderMessage(MessageData{Tag: "v1.2.0", Previous: "v1.1.0"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Release v1.2.0 (previous: v1.1.0)", message)
+
+	message, err = (&Config{}).RenderMessage(MessageData{Tag: "v1.2.0"})
+	assert.NoError(t, err)
+	assert.Empty(t, message)
+}
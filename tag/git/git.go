@@ -1,6 +1,7 @@
 package git
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
@@ -167,6 +168,51 @@ func ListTags(prefix, suffix string) ([]string, error) {
 	return tagList, nil
 }
 
+// ListMergedTags lists the tags reachable from ref, filtered like ListTags
+func ListMergedTags(ref, prefix, suffix string) ([]string, error) {
+	tagPattern := genTagPattern(prefix, suffix)
+	log.WithFields(log.Fields{
+		"ref":     ref,
+		"pattern": tagPattern,
+	}).Debug("ListMergedTags")
+	cmd := exec.Command("git", "tag", "--merged", ref, "--list", tagPattern)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		log.WithError(err).Debug("ListMergedTags: error running git tag --merged")
+		return nil, fmt.Errorf("failed to list tags merged into %s: %w", ref, err)
+	}
+
+	var tagList []string
+	for _, tag := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if tag == "" {
+			continue
+		}
+		if suffix != "" {
+			version, err := semver.ParseSemver(tag)
+			if err != nil || version.PreRelease != suffix {
+				continue
+			}
+		}
+		tagList = append(tagList, tag)
+	}
+	log.WithField("count", len(tagList)).Debug("ListMergedTags: returning tags")
+	return tagList, nil
+}
+
+// MergedTags lists every tag reachable from ref, whatever its prefix or suffix
+func MergedTags(ref string) ([]string, error) {
+	log.WithField("ref", ref).Debug("MergedTags")
+	cmd := exec.Command("git", "tag", "--merged", ref)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		log.WithError(err).Debug("MergedTags: error running git tag --merged")
+		return nil, fmt.Errorf("failed to list tags merged into %s: %w", ref, err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
 func ListTagsAt(ref string) ([]string, error) {
 	cmd := exec.Command("git", "tag", "--points-at", ref)
 	cmd.Stderr = os.Stderr
@@ -196,9 +242,15 @@ func TagExists(tag string) (bool, error) {
 	return true, nil
 }
 
-func CreateAndPushTag(tag string, remote string) error {
+// CreateAndPushTag creates the tag at HEAD and pushes it to remote. A non-empty
+// message creates an annotated tag instead of a lightweight one.
+func CreateAndPushTag(tag string, remote string, message string) error {
 	log.WithField("tag", tag).Debug("CreateAndPushTag: creating tag")
-	cmd := exec.Command("git", "tag", tag)
+	args := []string{"tag", tag}
+	if message != "" {
+		args = []string{"tag", "--annotate", "--message", message, tag}
+	}
+	cmd := exec.Command("git", args...)
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
 		log.WithError(err).WithField("tag", tag).Debug("CreateAndPushTag: error creating tag")
@@ -223,6 +275,42 @@ func CreateAndPushTag(tag string, remote string) error {
 	return nil
 }
 
+// DeleteTag deletes the tag from remote, where it may not exist, and then
+// locally. A failure to reach remote leaves the local tag so that the deletion
+// can be retried.
+func DeleteTag(tag string, remote string) error {
+	log.WithFields(log.Fields{
+		"tag":    tag,
+		"remote": remote,
+	}).Debug("DeleteTag: deleting tag from remote")
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "push", "--quiet", "--delete", remote, fmt.Sprintf("refs/tags/%s", tag))
+	// The error is matched below, so it must not be translated
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// A tag that was never pushed, or is already deleted from the remote,
+		// only has to be deleted locally
+		if !strings.Contains(stderr.String(), "remote ref does not exist") {
+			_, _ = os.Stderr.Write(stderr.Bytes())
+			log.WithError(err).WithField("tag", tag).Debug("DeleteTag: error deleting remote tag")
+			return fmt.Errorf("failed to delete tag from %s: %w", remote, err)
+		}
+		log.WithField("tag", tag).Debug("DeleteTag: tag does not exist on remote")
+	}
+
+	log.WithField("tag", tag).Debug("DeleteTag: deleting local tag")
+	cmd = exec.Command("git", "tag", "--delete", tag)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.WithError(err).WithField("tag", tag).Debug("DeleteTag: error deleting local tag")
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+
+	log.WithField("tag", tag).Debug("DeleteTag: successfully deleted tag")
+	return nil
+}
+
 func FetchSemverTags(remote string, prefix, suffix string) error {
 	// When suffix is specified, greedily fetch all matching tags (git refspecs don't support
 	// wildcards in the middle like v*-suffix*). We'll filter by suffix in the code.
@@ -248,6 +336,7 @@ func FetchSemverTags(remote string, prefix, suffix string) error {
 }
 
 // GetLatestStableSemverTag returns the latest stable (non-pre-release) semver tag
+// reachable from HEAD
 func GetLatestStableSemverTag(prefix string) (string, error) {
 	// Get all tags matching the base pattern (without suffix)
 	tagPattern := "v[0-9]*.[0-9]*.[0-9]*"
@@ -259,7 +348,7 @@ func GetLatestStableSemverTag(prefix string) (string, error) {
 		"prefix":  prefix,
 	}).Debug("GetLatestStableSemverTag")
 
-	cmd := exec.Command("git", "tag", "-l", tagPattern)
+	cmd := exec.Command("git", "tag", "--merged", "HEAD", "-l", tagPattern)
 	cmd.Stderr = os.Stderr
 	output, err := cmd.Output()
 	if err != nil {
@@ -323,22 +412,37 @@ func GetLatestStableSemverTag(prefix string) (string, error) {
 
 // GetTagAtHEAD returns the semver tag at HEAD, or empty string if none exists
 func GetTagAtHEAD(prefix, suffix string) (string, error) {
+	return largestTagAtHEAD(prefix, suffix, func(version *semver.Version) bool {
+		return suffix == "" || version.PreRelease == suffix
+	})
+}
+
+// GetPreReleaseTagAtHEAD returns the largest pre-release tag at HEAD from the
+// channel, or from any channel if it's empty, ignoring stable tags at HEAD
+func GetPreReleaseTagAtHEAD(prefix, channel string) (string, error) {
+	return largestTagAtHEAD(prefix, channel, func(version *semver.Version) bool {
+		return version.PreRelease != "" && (channel == "" || version.PreRelease == channel)
+	})
+}
+
+// largestTagAtHEAD returns the largest tag at HEAD that matches
+func largestTagAtHEAD(prefix, suffix string, match func(*semver.Version) bool) (string, error) {
 	tagPattern := genTagPattern(prefix, suffix)
 	log.WithFields(log.Fields{
 		"pattern": tagPattern,
 		"prefix":  prefix,
 		"suffix":  suffix,
-	}).Debug("GetTagAtHEAD")
+	}).Debug("largestTagAtHEAD")
 	cmd := exec.Command("git", "tag", "--points-at", "HEAD", "--list", tagPattern)
 	cmd.Stderr = os.Stderr
 	output, err := cmd.Output()
 	if err != nil {
-		log.WithError(err).Debug("GetTagAtHEAD: error checking tags")
+		log.WithError(err).Debug("largestTagAtHEAD: error checking tags")
 		return "", fmt.Errorf("failed to check tags for HEAD: %w", err)
 	}
 	tags := strings.TrimSpace(string(output))
 	if tags == "" {
-		log.Debug("GetTagAtHEAD: no tags found at HEAD")
+		log.Debug("largestTagAtHEAD: no tags found at HEAD")
 		return "", nil
 	}
 
@@ -353,12 +457,11 @@ func GetTagAtHEAD(prefix, suffix string) (string, error) {
 		}
 		version, err := semver.ParseSemver(tag)
 		if err != nil {
-			log.WithError(err).WithField("tag", tag).Debug("GetTagAtHEAD: failed to parse tag")
+			log.WithError(err).WithField("tag", tag).Debug("largestTagAtHEAD: failed to parse tag")
 			continue
 		}
 
-		// Check suffix match if specified
-		if suffix != "" && version.PreRelease != suffix {
+		if !match(version) {
 			continue
 		}
 
@@ -368,7 +471,7 @@ func GetTagAtHEAD(prefix, suffix string) (string, error) {
 		}
 	}
 
-	log.WithField("tag", largestTag).Debug("GetTagAtHEAD: returning tag at HEAD")
+	log.WithField("tag", largestTag).Debug("largestTagAtHEAD: returning tag at HEAD")
 	return largestTag, nil
 }
 
@@ -443,3 +546,119 @@ func IsHEADAlreadyTagged(prefix, suffix string) (bool, error) {
 	log.Debug("IsHEADAlreadyTagged: HEAD is tagged (suffix not specified)")
 	return true, nil
 }
+
+// GetTopLevel returns the absolute path of the root of the working tree
+func GetTopLevel() (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	output, err := cmd.Output()
+	if err != nil {
+		log.WithError(err).Debug("GetTopLevel: error finding repository root")
+		return "", fmt.Errorf("failed to find repository root: %w", err)
+	}
+	topLevel := strings.TrimSpace(string(output))
+	log.WithField("topLevel", topLevel).Debug("GetTopLevel: found repository root")
+	return topLevel, nil
+}
+
+// GetCurrentBranch returns the short name of the checked out branch, or an
+// empty string if HEAD is detached
+func GetCurrentBranch() (string, error) {
+	cmd := exec.Command("git", "symbolic-ref", "--quiet", "--short", "HEAD")
+	output, err := cmd.Output()
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 1 {
+			log.Debug("GetCurrentBranch: HEAD is detached")
+			return "", nil
+		}
+		log.WithError(err).Debug("GetCurrentBranch: error reading HEAD")
+		return "", fmt.Errorf("failed to read current branch: %w", err)
+	}
+	branch := strings.TrimSpace(string(output))
+	log.WithField("branch", branch).Debug("GetCurrentBranch: found branch")
+	return branch, nil
+}
+
+// IsWorkingTreeClean reports whether there are no staged, unstaged or
+// untracked changes in the working tree
+func IsWorkingTreeClean() (bool, error) {
+	cmd := exec.Command("git", "status", "--porcelain")
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		log.WithError(err).Debug("IsWorkingTreeClean: error running git status")
+		return false, fmt.Errorf("failed to check working tree status: %w", err)
+	}
+	clean := strings.TrimSpace(string(output)) == ""
+	log.WithField("clean", clean).Debug("IsWorkingTreeClean")
+	return clean, nil
+}
+
+// NextTag returns the latest tag reachable from HEAD and the tag following it.
+// With a suffix, the next pre-release is based on the latest stable release if
+// that is newer. On a release branch such as release/1.2 only patch releases
+// of that line are made. Retracted versions are skipped.
+func NextTag(prefix, suffix string, major, minor, patch bool, retracted []string) (latest, next string, err error) {
+	latestTag, err := GetLatestSemverTag(prefix, suffix)
+	if err != nil {
+		return "", "", err
+	}
+
+	// When using a suffix, also check the latest stable tag to ensure we
+	// don't create a pre-release based on an older version than the latest stable
+	if suffix != "" {
+		latestStableTag, err := GetLatestStableSemverTag(prefix)
+		if err == nil && latestStableTag != "" {
+			stableVer, stableErr := semver.ParseSemver(latestStableTag)
+			currentVer, currentErr := semver.ParseSemver(latestTag)
+
+			if stableErr == nil && currentErr == nil {
+				// Compare base versions (major.minor.patch only)
+				stableBase := &semver.Version{Major: stableVer.Major, Minor: stableVer.Minor, Patch: stableVer.Patch}
+				currentBase := &semver.Version{Major: currentVer.Major, Minor: currentVer.Minor, Patch: currentVer.Patch}
+
+				// Use stable tag if it has a higher or equal base version
+				if semver.CompareSemver(stableBase, currentBase) || (stableBase.Major == currentBase.Major && stableBase.Minor == currentBase.Minor && stableBase.Patch == currentBase.Patch) {
+					log.WithFields(log.Fields{
+						"stableTag":     latestStableTag,
+						"preReleaseTag": latestTag,
+					}).Debug("Using stable tag as base (higher or equal base version)")
+					latestTag = latestStableTag
+				}
+			}
+		}
+	}
+
+	// Only tags reachable from HEAD are considered so that tags on other
+	// branches don't affect the numbering on this one
+	allTags, err := ListMergedTags("HEAD", prefix, suffix)
+	if err != nil {
+		return "", "", err
+	}
+
+	branch, err := GetCurrentBranch()
+	if err != nil {
+		return "", "", err
+	}
+
+	var nextVersion string
+	if line, ok := semver.ParseReleaseBranch(branch); ok {
+		if major || minor {
+			return "", "", fmt.Errorf("branch '%s' only receives %s releases", branch, line)
+		}
+		log.WithFields(log.Fields{
+			"branch": branch,
+			"line":   line.String(),
+		}).Debug("Calculating next version on release line")
+		nextVersion, err = semver.CalculateNextVersionOnLine(latestTag, allTags, line, patch, suffix)
+	} else {
+		nextVersion, err = semver.CalculateNextVersion(latestTag, allTags, major, minor, patch, suffix)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	nextVersion, err = semver.SkipRetracted(nextVersion, allTags, retracted)
+	if err != nil {
+		return "", "", err
+	}
+	return latestTag, nextVersion, nil
+}
@@ -0,0 +1,256 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmelahman/tag/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func run(t *testing.T, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git %v: %s", args, output)
+}
+
+// newRepo creates an empty repository in a temporary directory and changes
+// into it for the duration of the test
+func newRepo(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	run(t, "init", "--quiet", "--initial-branch=main")
+	run(t, "config", "user.name", "test")
+	run(t, "config", "user.email", "test@example.com")
+}
+
+// commits counts the commits made so that each has a unique message. Otherwise
+// empty commits made within the same second on different branches are identical.
+var commits int
+
+func commit(t *testing.T, tags ...string) {
+	t.Helper()
+	commits++
+	run(t, "commit", "--quiet", "--allow-empty", "--message", fmt.Sprintf("commit %d", commits))
+	for _, tag := range tags {
+		run(t, "tag", tag)
+	}
+}
+
+// newMultiBranchRepo creates the following history, with release/1.0 checked out:
+//
+//	main:        v1.0.0 -- v1.1.0-rc.1 -- v1.1.0
+//	release/1.0:       \-- v1.0.1-rc.1
+func newMultiBranchRepo(t *testing.T) {
+	t.Helper()
+	newRepo(t)
+	commit(t, "v1.0.0")
+	run(t, "branch", "release/1.0")
+	commit(t, "v1.1.0-rc.1")
+	commit(t, "v1.1.0")
+	run(t, "checkout", "--quiet", "release/1.0")
+	commit(t, "v1.0.1-rc.1")
+}
+
+func TestListMergedTags(t *testing.T) {
+	newMultiBranchRepo(t)
+
+	tags, err := ListMergedTags("HEAD", "", "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"v1.0.0", "v1.0.1-rc.1"}, tags)
+
+	tags, err = ListMergedTags("main", "", "rc")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"v1.1.0-rc.1"}, tags)
+
+	tags, err = ListMergedTags("HEAD", "", "beta")
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+}
+
+func TestGetLatestStableSemverTagIgnoresOtherBranches(t *testing.T) {
+	newMultiBranchRepo(t)
+
+	latest, err := GetLatestStableSemverTag("")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0", latest)
+
+	run(t, "checkout", "--quiet", "main")
+	latest, err = GetLatestStableSemverTag("")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0", latest)
+}
+
+func TestNextVersionOnBranches(t *testing.T) {
+	testCases := []struct {
+		name        string
+		branch      string
+		suffix      string
+		expectedTag string
+	}{
+		{
+			name:        "Release branch patch",
+			branch:      "release/1.0",
+			expectedTag: "v1.0.2",
+		},
+		{
+			name:        "Release branch pre-release",
+			branch:      "release/1.0",
+			suffix:      "rc",
+			expectedTag: "v1.0.1-rc.2",
+		},
+		{
+			name:        "Main patch",
+			branch:      "main",
+			expectedTag: "v1.1.1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			newMultiBranchRepo(t)
+			run(t, "checkout", "--quiet", tc.branch)
+			commit(t)
+
+			_, nextVersion, err := NextTag("", tc.suffix, false, false, false, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedTag, nextVersion)
+		})
+	}
+}
+
+func TestNextTagOnReleaseBranchRejectsMinor(t *testing.T) {
+	newMultiBranchRepo(t)
+	commit(t)
+
+	_, _, err := NextTag("", "", false, true, false, nil)
+	assert.EqualError(t, err, "branch 'release/1.0' only receives v1.0.x releases")
+}
+
+func TestNextTagSkipsRetracted(t *testing.T) {
+	// v0.0.1 was retracted, which deleted its tag
+	newRepo(t)
+	commit(t)
+
+	latest, next, err := NextTag("", "", false, false, true, []string{"v0.0.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "v0.0.0", latest)
+	assert.Equal(t, "v0.0.2", next)
+}
+
+func TestPreReleaseNumberingIgnoresUnmergedBranches(t *testing.T) {
+	// main:      v1.0.0 -- v1.1.0-beta.1 -- HEAD
+	// feature:                          \-- v1.1.0-rc.4
+	newRepo(t)
+	commit(t, "v1.0.0")
+	commit(t, "v1.1.0-beta.1")
+	run(t, "checkout", "--quiet", "-b", "feature")
+	commit(t, "v1.1.0-rc.4")
+	run(t, "checkout", "--quiet", "main")
+	commit(t)
+
+	allTags, err := ListMergedTags("HEAD", "", "rc")
+	require.NoError(t, err)
+	nextVersion, err := semver.CalculateNextVersion("v1.1.0-beta.1", allTags, false, false, false, "rc")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0-rc.1", nextVersion)
+
+	allTags, err = ListTags("", "rc")
+	require.NoError(t, err)
+	nextVersion, err = semver.CalculateNextVersion("v1.1.0-beta.1", allTags, false, false, false, "rc")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0-rc.5", nextVersion)
+}
+
+func TestGetCurrentBranch(t *testing.T) {
+	newRepo(t)
+	commit(t)
+
+	branch, err := GetCurrentBranch()
+	require.NoError(t, err)
+	assert.Equal(t, "main", branch)
+
+	run(t, "checkout", "--quiet", "--detach")
+	branch, err = GetCurrentBranch()
+	require.NoError(t, err)
+	assert.Empty(t, branch)
+}
+
+func TestIsWorkingTreeClean(t *testing.T) {
+	newRepo(t)
+	commit(t)
+
+	clean, err := IsWorkingTreeClean()
+	require.NoError(t, err)
+	assert.True(t, clean)
+
+	require.NoError(t, os.WriteFile(filepath.Join(".", "untracked"), []byte("untracked"), 0o644))
+	clean, err = IsWorkingTreeClean()
+	require.NoError(t, err)
+	assert.False(t, clean)
+}
+
+func TestGetPreReleaseTagAtHEAD(t *testing.T) {
+	newRepo(t)
+	commit(t, "v1.3.0")
+	commit(t, "v1.4.0-rc.2", "v1.4.0-rc.3", "v1.4.0")
+
+	tag, err := GetTagAtHEAD("", "")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.4.0", tag)
+
+	tag, err = GetPreReleaseTagAtHEAD("", "")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.4.0-rc.3", tag)
+
+	tag, err = GetPreReleaseTagAtHEAD("", "rc")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.4.0-rc.3", tag)
+
+	tag, err = GetPreReleaseTagAtHEAD("", "beta")
+	require.NoError(t, err)
+	assert.Empty(t, tag)
+
+	run(t, "checkout", "--quiet", "HEAD~")
+	tag, err = GetPreReleaseTagAtHEAD("", "")
+	require.NoError(t, err)
+	assert.Empty(t, tag)
+}
+
+func TestDeleteTag(t *testing.T) {
+	newRepo(t)
+	remote := t.TempDir()
+	run(t, "init", "--quiet", "--bare", remote)
+	run(t, "remote", "add", "origin", remote)
+	commit(t, "v1.0.0", "v1.0.1")
+	run(t, "push", "--quiet", "origin", "v1.0.0")
+
+	// v1.0.1 was never pushed
+	require.NoError(t, DeleteTag("v1.0.1", "origin"))
+	exists, err := TagExists("v1.0.1")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, DeleteTag("v1.0.0", "origin"))
+	exists, err = TagExists("v1.0.0")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	output, err := exec.Command("git", "ls-remote", "--tags", "origin").Output()
+	require.NoError(t, err)
+	assert.Empty(t, string(output))
+
+	// Other failures to delete from the remote are still errors, which keep
+	// the local tag so that the deletion can be retried
+	commit(t, "v1.0.2")
+	assert.Error(t, DeleteTag("v1.0.2", "missing"))
+	exists, err = TagExists("v1.0.2")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
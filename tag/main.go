@@ -6,9 +6,10 @@ import (
 	"os"
 	"strings"
 
+	"github.com/jmelahman/tag/check"
 	"github.com/jmelahman/tag/completion"
+	"github.com/jmelahman/tag/config"
 	"github.com/jmelahman/tag/git"
-	"github.com/jmelahman/tag/semver"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -19,9 +20,10 @@ var (
 )
 
 func main() {
-	var major, minor, patch, push, print, check bool
+	var major, minor, patch, push, print, checkTag bool
 	var metadata, prefix, suffix, remote string
-	var debug, noFetch, allowUntagged bool
+	var debug, noFetch, allowUntagged, headOnly bool
+	var format string
 
 	rootCmd := &cobra.Command{
 		Use:     "tag",
@@ -39,14 +41,24 @@ func main() {
 			if setFlags > 1 {
 				return fmt.Errorf("only one version increment flag (--major, --minor, or --patch) can be used at a time")
 			}
+			if _, err := check.ParseFormat(format); err != nil {
+				return err
+			}
 			return nil
 		},
-		Run: func(cmd *cobra.Command, args []string) {
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
 			if debug {
 				log.SetLevel(log.DebugLevel)
 			} else {
 				log.SetLevel(log.InfoLevel)
 			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := loadConfig(cmd, &prefix, &suffix, &remote, &push)
+			if err := cfg.CheckChannel(suffix); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 
 			log.WithFields(log.Fields{
 				"prefix":        prefix,
@@ -55,9 +67,10 @@ func main() {
 				"major":         major,
 				"minor":         minor,
 				"patch":         patch,
-				"check":         check,
+				"check":         checkTag,
 				"noFetch":       noFetch,
 				"allowUntagged": allowUntagged,
+				"config":        cfg.Source,
 			}).Debug("Configuration")
 
 			if !noFetch {
@@ -67,87 +80,10 @@ func main() {
 				}
 			}
 
-			// Handle --check flag: validate that the tag at HEAD has its previous version as an ancestor
-			// and no larger version is an ancestor
-			if check {
-				currentTag, err := git.GetTagAtHEAD(prefix, suffix)
-				if err != nil {
-					fmt.Printf("Error getting tag at HEAD: %v\n", err)
-					os.Exit(1)
-				}
-				if currentTag == "" {
-					if allowUntagged {
-						fmt.Println("HEAD is not tagged (allowed)")
-						os.Exit(0)
-					}
-					fmt.Println("Error: HEAD is not tagged")
-					os.Exit(1)
-				}
-
-				allTags, err := git.ListTags(prefix, suffix)
-				if err != nil {
-					fmt.Printf("Error listing tags: %v\n", err)
-					os.Exit(1)
-				}
-
-				// Check that no larger version is an ancestor of HEAD
-				largerTags, err := semver.FindLargerVersions(currentTag, allTags)
-				if err != nil {
-					fmt.Printf("Error finding larger versions: %v\n", err)
-					os.Exit(1)
-				}
-
-				for _, largerTag := range largerTags {
-					isAncestor, err := git.IsAncestor(largerTag, "HEAD")
-					if err != nil {
-						fmt.Printf("Error checking ancestry: %v\n", err)
-						os.Exit(1)
-					}
-					if isAncestor {
-						fmt.Printf("Error: Larger tag '%s' is an ancestor of current tag '%s'\n", largerTag, currentTag)
-						os.Exit(1)
-					}
-				}
-
-				// Check that the expected predecessor exists (no skipped versions)
-				expectedPred, err := semver.GetExpectedPredecessor(currentTag)
-				if err != nil {
-					fmt.Printf("Error getting expected predecessor: %v\n", err)
-					os.Exit(1)
-				}
-
-				if expectedPred == "" {
-					// v0.0.0 or similar - no predecessor expected
-					fmt.Printf("Tag '%s' is valid (first version)\n", currentTag)
-					os.Exit(0)
-				}
-
-				// Check if expected predecessor exists
-				predExists, err := git.TagExists(expectedPred)
-				if err != nil {
-					fmt.Printf("Error checking tag existence: %v\n", err)
-					os.Exit(1)
-				}
-
-				if !predExists {
-					fmt.Printf("Error: Expected predecessor tag '%s' does not exist (version skipped)\n", expectedPred)
-					os.Exit(1)
-				}
-
-				// Check that the expected predecessor is an ancestor
-				isAncestor, err := git.IsAncestor(expectedPred, "HEAD")
-				if err != nil {
-					fmt.Printf("Error checking ancestry: %v\n", err)
-					os.Exit(1)
-				}
-
-				if !isAncestor {
-					fmt.Printf("Error: Previous tag '%s' is not an ancestor of current tag '%s'\n", expectedPred, currentTag)
-					os.Exit(1)
-				}
-
-				fmt.Printf("Tag '%s' is valid (previous version '%s' is an ancestor)\n", currentTag, expectedPred)
-				os.Exit(0)
+			// Handle --check flag: validate that each tag reachable from HEAD has its previous version
+			// as an ancestor and no larger version is an ancestor
+			if checkTag {
+				os.Exit(runCheck(prefix, suffix, headOnly, allowUntagged, format))
 			}
 
 			// Check if HEAD is already tagged
@@ -161,44 +97,14 @@ func main() {
 				os.Exit(1)
 			}
 
-		latestTag, err := git.GetLatestSemverTag(prefix, suffix)
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
-		}
-
-		// When using a suffix, also check the latest stable tag to ensure we
-		// don't create a pre-release based on an older version than the latest stable
-		if suffix != "" {
-			latestStableTag, err := git.GetLatestStableSemverTag(prefix)
-			if err == nil && latestStableTag != "" {
-				stableVer, stableErr := semver.ParseSemver(latestStableTag)
-				currentVer, currentErr := semver.ParseSemver(latestTag)
-
-				if stableErr == nil && currentErr == nil {
-					// Compare base versions (major.minor.patch only)
-					stableBase := &semver.Version{Major: stableVer.Major, Minor: stableVer.Minor, Patch: stableVer.Patch}
-					currentBase := &semver.Version{Major: currentVer.Major, Minor: currentVer.Minor, Patch: currentVer.Patch}
-
-					// Use stable tag if it has a higher or equal base version
-					if semver.CompareSemver(stableBase, currentBase) || (stableBase.Major == currentBase.Major && stableBase.Minor == currentBase.Minor && stableBase.Patch == currentBase.Patch) {
-						log.WithFields(log.Fields{
-							"stableTag":     latestStableTag,
-							"preReleaseTag": latestTag,
-						}).Debug("Using stable tag as base (higher or equal base version)")
-						latestTag = latestStableTag
-					}
-				}
-			}
-		}
-
-		allTags, err := git.ListTags(prefix, suffix)
+			// Retracted versions may already be cached by consumers, so never reuse them
+			retracted, err := loadRetracted()
 			if err != nil {
-				fmt.Printf("Error: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
 
-			nextVersion, err := semver.CalculateNextVersion(latestTag, allTags, major, minor, patch, suffix)
+			latestTag, nextVersion, err := git.NextTag(prefix, suffix, major, minor, patch, retracted)
 			if err != nil {
 				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
@@ -224,24 +130,7 @@ func main() {
 				os.Exit(0)
 			}
 
-			if !push {
-				reader := bufio.NewReader(os.Stdin)
-				fmt.Printf("Push tag '%s' to %s? (y/N): ", nextVersion, remote)
-				response, _ := reader.ReadString('\n')
-				response = strings.TrimSpace(strings.ToLower(response))
-
-				if response == "" || response == "y" || response == "yes" {
-					push = true
-				}
-			}
-
-			if push {
-				if err := git.CreateAndPushTag(nextVersion, remote); err != nil {
-					fmt.Printf("Error: %v\n", err)
-					os.Exit(1)
-				}
-				fmt.Printf("Tag '%s' created and pushed to %s.\n", nextVersion, remote)
-			}
+			publishTag(cfg, nextVersion, latestTag, remote, push)
 		},
 	}
 
@@ -250,19 +139,159 @@ func main() {
 	rootCmd.Flags().BoolVar(&patch, "patch", false, "increment the patch version")
 	rootCmd.Flags().BoolVar(&push, "push", false, "create and push the tag to remote")
 	rootCmd.Flags().BoolVar(&print, "print-only", false, "print the next tag and exit")
-	rootCmd.Flags().BoolVar(&check, "check", false, "validate that the tag at HEAD has its previous version as an ancestor")
+	rootCmd.Flags().BoolVar(&checkTag, "check", false, "validate that each tag reachable from HEAD has its previous version as an ancestor")
 	rootCmd.Flags().BoolVar(&noFetch, "no-fetch", false, "skip fetching tags from remote")
 	rootCmd.Flags().BoolVar(&allowUntagged, "allow-untagged", false, "allow HEAD to be untagged when using --check")
-	rootCmd.Flags().BoolVar(&debug, "debug", false, "enable debug logging")
+	rootCmd.Flags().BoolVar(&headOnly, "head-only", false, "only validate the tag at HEAD when using --check")
+	rootCmd.Flags().StringVar(&format, "format", string(check.FormatText), "output format for --check (text, json, github)")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "enable debug logging")
 	rootCmd.Flags().StringVar(&prefix, "prefix", "", "set a prefix for the tag")
 	rootCmd.Flags().StringVar(&suffix, "suffix", "", "set the pre-release suffix (e.g., rc, alpha, beta)")
 	rootCmd.Flags().StringVar(&metadata, "metadata", "", "set the build metadata")
 	rootCmd.Flags().StringVar(&remote, "remote", "origin", "remote repository to push tag to")
 
 	rootCmd.AddCommand(completion.AddCompletionCmd(rootCmd))
+	rootCmd.AddCommand(newPromoteCmd())
+	rootCmd.AddCommand(newRetractCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// runCheck validates every tag reachable from HEAD, or only the tag at HEAD
+// if headOnly is set, and returns the process exit code
+func runCheck(prefix, suffix string, headOnly, allowUntagged bool, format string) int {
+	outputFormat, err := check.ParseFormat(format)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	currentTag, err := git.GetTagAtHEAD(prefix, suffix)
+	if err != nil {
+		fmt.Printf("Error getting tag at HEAD: %v\n", err)
+		return 1
+	}
+	var tags []string
+	if !headOnly {
+		tags, err = git.ListMergedTags("HEAD", prefix, suffix)
+		if err != nil {
+			fmt.Printf("Error listing tags: %v\n", err)
+			return 1
+		}
+	} else if currentTag != "" {
+		tags = []string{currentTag}
+	}
+	if len(tags) == 0 && allowUntagged && outputFormat == check.FormatText {
+		fmt.Println("HEAD is not tagged (allowed)")
+		return 0
+	}
+
+	allTags, err := git.ListTags(prefix, suffix)
+	if err != nil {
+		fmt.Printf("Error listing tags: %v\n", err)
+		return 1
+	}
+	checker := check.New(allTags)
+	checker.Retracted, err = loadRetracted()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	report, err := checker.CheckHistory(currentTag, tags, allowUntagged)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	if err := report.Write(os.Stdout, outputFormat); err != nil {
+		fmt.Printf("Error writing report: %v\n", err)
+		return 1
+	}
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// loadConfig reads the repository config and applies it to any of the given
+// flags that were not set on the command line
+func loadConfig(cmd *cobra.Command, prefix, suffix, remote *string, push *bool) *config.Config {
+	cfg := &config.Config{}
+	if topLevel, err := git.GetTopLevel(); err == nil {
+		cfg, err = config.Load(topLevel)
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Flags given on the command line take precedence over the config file
+	flags := cmd.Flags()
+	if prefix != nil && !flags.Changed("prefix") && cfg.Prefix != "" {
+		*prefix = cfg.Prefix
+	}
+	if suffix != nil && !flags.Changed("suffix") && cfg.Suffix != "" {
+		*suffix = cfg.Suffix
+	}
+	if remote != nil && !flags.Changed("remote") && cfg.Remote != "" {
+		*remote = cfg.Remote
+	}
+	if push != nil && !flags.Changed("push") && cfg.Push {
+		*push = true
+	}
+	return cfg
+}
+
+// publishTag enforces the config policies, confirms with the user unless push
+// is set, and then creates and pushes the tag
+func publishTag(cfg *config.Config, tag, previous, remote string, push bool) {
+	branch, err := git.GetCurrentBranch()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	clean, err := git.IsWorkingTreeClean()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := cfg.CheckPolicy(branch, clean); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !push {
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Printf("Push tag '%s' to %s? (y/N): ", tag, remote)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+
+		if response == "" || response == "y" || response == "yes" {
+			push = true
+		}
+	}
+
+	if !push {
+		return
+	}
+
+	message, err := cfg.RenderMessage(config.MessageData{
+		Tag:      tag,
+		Previous: previous,
+		Remote:   remote,
+		Branch:   branch,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := git.CreateAndPushTag(tag, remote, message); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Tag '%s' created and pushed to %s.\n", tag, remote)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jmelahman/tag/check"
+	"github.com/jmelahman/tag/git"
+	"github.com/jmelahman/tag/semver"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newPromoteCmd() *cobra.Command {
+	var push, print, noFetch bool
+	var from, to, prefix, remote string
+
+	promoteCmd := &cobra.Command{
+		Use:   "promote",
+		Short: "Promote the pre-release tag at HEAD to a stable release or another channel",
+		Long: `Promote the pre-release tag at HEAD by tagging the same commit.
+
+By default the pre-release is promoted to its stable release, e.g. v1.4.0-rc.3
+becomes v1.4.0. Pass --to to graduate to another pre-release channel instead,
+e.g. --from beta --to rc turns v1.4.0-beta.2 into the next v1.4.0-rc tag.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := loadConfig(cmd, &prefix, nil, &remote, &push)
+			if err := cfg.CheckChannel(to); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			log.WithFields(log.Fields{
+				"from":    from,
+				"to":      to,
+				"prefix":  prefix,
+				"remote":  remote,
+				"noFetch": noFetch,
+				"config":  cfg.Source,
+			}).Debug("Configuration")
+
+			if !noFetch {
+				if err := git.FetchSemverTags(remote, prefix, ""); err != nil {
+					fmt.Printf("Error fetching tags: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			// HEAD may already carry the stable release of a pre-release
+			currentTag, err := git.GetPreReleaseTagAtHEAD(prefix, from)
+			if err != nil {
+				fmt.Printf("Error getting tag at HEAD: %v\n", err)
+				os.Exit(1)
+			}
+			if currentTag == "" {
+				if from != "" {
+					fmt.Printf("Error: HEAD has no '%s' pre-release tag\n", from)
+				} else {
+					fmt.Println("Error: HEAD has no pre-release tag")
+				}
+				os.Exit(1)
+			}
+
+			allTags, err := git.ListTags(prefix, "")
+			if err != nil {
+				fmt.Printf("Error listing tags: %v\n", err)
+				os.Exit(1)
+			}
+
+			// Retracted versions may already be cached by consumers, so never reuse them
+			retracted, err := loadRetracted()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			promotedTag, err := semver.Promote(currentTag, allTags, to)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			promotedTag, err = semver.SkipRetracted(promotedTag, allTags, retracted)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			tagExists, err := git.TagExists(promotedTag)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if tagExists {
+				fmt.Printf("Promoted tag '%s' already exists.\n", promotedTag)
+				os.Exit(1)
+			}
+
+			// The promoted tag must satisfy the same rules as --check before it is created
+			checker := check.New(allTags)
+			checker.Retracted = retracted
+			_, findings, err := checker.CheckRef(promotedTag, "HEAD")
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if len(findings) > 0 {
+				for _, finding := range findings {
+					fmt.Printf("Error: %s\n", finding.Message)
+				}
+				os.Exit(1)
+			}
+
+			if print {
+				fmt.Println(promotedTag)
+				os.Exit(0)
+			}
+
+			publishTag(cfg, promotedTag, currentTag, remote, push)
+		},
+	}
+
+	promoteCmd.Flags().StringVar(&from, "from", "", "only promote a tag from this pre-release channel")
+	promoteCmd.Flags().StringVar(&to, "to", "", "promote to this pre-release channel instead of the stable release")
+	promoteCmd.Flags().BoolVar(&push, "push", false, "create and push the tag to remote")
+	promoteCmd.Flags().BoolVar(&print, "print-only", false, "print the promoted tag and exit")
+	promoteCmd.Flags().BoolVar(&noFetch, "no-fetch", false, "skip fetching tags from remote")
+	promoteCmd.Flags().StringVar(&prefix, "prefix", "", "set a prefix for the tag")
+	promoteCmd.Flags().StringVar(&remote, "remote", "origin", "remote repository to push tag to")
+
+	return promoteCmd
+}
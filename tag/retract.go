@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jmelahman/tag/git"
+	"github.com/jmelahman/tag/retract"
+	"github.com/jmelahman/tag/semver"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newRetractCmd() *cobra.Command {
+	var yes, noFetch, goMod bool
+	var prefix, remote, reason string
+
+	retractCmd := &cobra.Command{
+		Use:   "retract <version>",
+		Short: "Delete a published tag locally and on the remote",
+		Long: fmt.Sprintf(`Delete a published tag locally and on the remote.
+
+The retraction is recorded in %s at the repository root so that
+'tag --check' allows the retracted version to be skipped. Commit that file
+after retracting.
+
+For Go modules, --go-mod also adds a retract directive to the module's go.mod.
+The directive only takes effect once a newer version is published.`, retract.FileName),
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := loadConfig(cmd, &prefix, nil, &remote, nil)
+
+			tag := args[0]
+			if prefix != "" && !strings.HasPrefix(tag, prefix+"/") {
+				tag = fmt.Sprintf("%s/%s", prefix, tag)
+			}
+			if _, err := semver.ParseSemver(tag); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			log.WithFields(log.Fields{
+				"tag":     tag,
+				"remote":  remote,
+				"goMod":   goMod,
+				"noFetch": noFetch,
+				"config":  cfg.Source,
+			}).Debug("Configuration")
+
+			topLevel, err := git.GetTopLevel()
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if !noFetch {
+				if err := git.FetchSemverTags(remote, prefix, ""); err != nil {
+					fmt.Printf("Error fetching tags: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			tagExists, err := git.TagExists(tag)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if !tagExists {
+				fmt.Printf("Error: Tag '%s' does not exist\n", tag)
+				os.Exit(1)
+			}
+
+			if !yes {
+				reader := bufio.NewReader(os.Stdin)
+				fmt.Printf("Delete tag '%s' locally and from %s? (y/N): ", tag, remote)
+				response, _ := reader.ReadString('\n')
+				response = strings.TrimSpace(strings.ToLower(response))
+
+				if response != "y" && response != "yes" {
+					fmt.Println("Aborted.")
+					os.Exit(1)
+				}
+			}
+
+			// The retraction is recorded first, so that a failure to delete the
+			// tag can be retried, and recording it again is a no-op
+			retraction := retract.Retraction{Tag: tag, Rationale: reason}
+			if err := retract.Record(topLevel, retraction); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Recorded retraction in %s.\n", retract.FileName)
+
+			if goMod {
+				goModPath, err := retract.GoModPath(topLevel, tag)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				if err := retract.AddGoModRetraction(goModPath, retraction); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Added retract directive to %s.\n", goModPath)
+			}
+
+			if err := git.DeleteTag(tag, remote); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Tag '%s' deleted locally and from %s.\n", tag, remote)
+		},
+	}
+
+	retractCmd.Flags().BoolVarP(&yes, "yes", "y", false, "skip the confirmation prompt")
+	retractCmd.Flags().BoolVar(&goMod, "go-mod", false, "add a retract directive to the module's go.mod")
+	retractCmd.Flags().BoolVar(&noFetch, "no-fetch", false, "skip fetching tags from remote")
+	retractCmd.Flags().StringVar(&reason, "reason", "", "rationale recorded with the retraction")
+	retractCmd.Flags().StringVar(&prefix, "prefix", "", "set a prefix for the tag")
+	retractCmd.Flags().StringVar(&remote, "remote", "origin", "remote repository to delete the tag from")
+
+	return retractCmd
+}
+
+// loadRetracted returns the retracted tags recorded in the repository, or
+// none outside of a repository
+func loadRetracted() ([]string, error) {
+	topLevel, err := git.GetTopLevel()
+	if err != nil {
+		return nil, nil
+	}
+	retractions, err := retract.Load(topLevel)
+	if err != nil {
+		return nil, fmt.Errorf("loading retractions: %w", err)
+	}
+	return retract.Tags(retractions), nil
+}
@@ -0,0 +1,158 @@
+package retract
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmelahman/tag/semver"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/modfile"
+)
+
+// FileName is the file at the repository root that records retracted tags.
+// Each line holds a tag, optionally followed by a "# rationale" comment.
+const FileName = ".tag-retracted"
+
+// Retraction is a tag that was deleted after being published
+type Retraction struct {
+	Tag       string
+	Rationale string
+}
+
+// Load reads the retractions recorded in root. A missing file means no tags
+// have been retracted.
+func Load(root string) ([]Retraction, error) {
+	path := filepath.Join(root, FileName)
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var retractions []Retraction
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tag, rationale, _ := strings.Cut(line, "#")
+		retractions = append(retractions, Retraction{
+			Tag:       strings.TrimSpace(tag),
+			Rationale: strings.TrimSpace(rationale),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	log.WithField("count", len(retractions)).Debug("Load: found retractions")
+	return retractions, nil
+}
+
+// Tags returns the retracted tag names
+func Tags(retractions []Retraction) []string {
+	tags := make([]string, 0, len(retractions))
+	for _, retraction := range retractions {
+		tags = append(tags, retraction.Tag)
+	}
+	return tags
+}
+
+// Record appends the retraction to the file in root unless the tag is
+// already recorded
+func Record(root string, retraction Retraction) error {
+	retractions, err := Load(root)
+	if err != nil {
+		return err
+	}
+	for _, existing := range retractions {
+		if existing.Tag == retraction.Tag {
+			log.WithField("tag", retraction.Tag).Debug("Record: tag already recorded")
+			return nil
+		}
+	}
+
+	path := filepath.Join(root, FileName)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	line := retraction.Tag
+	if retraction.Rationale != "" {
+		line = fmt.Sprintf("%s # %s", line, retraction.Rationale)
+	}
+	if _, err := fmt.Fprintln(file, line); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	log.WithFields(log.Fields{
+		"tag":  retraction.Tag,
+		"path": path,
+	}).Debug("Record: recorded retraction")
+	return nil
+}
+
+// GoModPath returns the go.mod of the module versioned by tag. For a
+// prefixed tag such as api/v1.2.3 this is api/go.mod.
+func GoModPath(root, tag string) (string, error) {
+	version, err := semver.ParseSemver(tag)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, filepath.FromSlash(version.Prefix), "go.mod"), nil
+}
+
+// AddGoModRetraction adds a retract directive for the version of tag to the
+// go.mod at path. It is a no-op if the version is already retracted.
+func AddGoModRetraction(path string, retraction Retraction) error {
+	version, err := semver.ParseSemver(retraction.Tag)
+	if err != nil {
+		return err
+	}
+	// The module version excludes the tag prefix, which is the module directory
+	moduleVersion := strings.TrimPrefix(retraction.Tag, version.Prefix)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	file, err := modfile.Parse(path, data, nil)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for _, existing := range file.Retract {
+		if existing.Low == moduleVersion && existing.High == moduleVersion {
+			log.WithField("version", moduleVersion).Debug("AddGoModRetraction: version already retracted")
+			return nil
+		}
+	}
+
+	interval := modfile.VersionInterval{Low: moduleVersion, High: moduleVersion}
+	if err := file.AddRetract(interval, retraction.Rationale); err != nil {
+		return fmt.Errorf("failed to add retract directive: %w", err)
+	}
+	file.Cleanup()
+
+	formatted, err := file.Format()
+	if err != nil {
+		return fmt.Errorf("failed to format %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, formatted, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	log.WithFields(log.Fields{
+		"version": moduleVersion,
+		"path":    path,
+	}).Debug("AddGoModRetraction: added retract directive")
+	return nil
+}
@@ -0,0 +1,72 @@
+package retract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndLoad(t *testing.T) {
+	root := t.TempDir()
+
+	retractions, err := Load(root)
+	require.NoError(t, err)
+	assert.Empty(t, retractions)
+
+	require.NoError(t, Record(root, Retraction{Tag: "v1.0.1", Rationale: "published by mistake"}))
+	require.NoError(t, Record(root, Retraction{Tag: "api/v0.2.0"}))
+	require.NoError(t, Record(root, Retraction{Tag: "v1.0.1", Rationale: "duplicate"}))
+
+	data, err := os.ReadFile(filepath.Join(root, FileName))
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.1 # published by mistake\napi/v0.2.0\n", string(data))
+
+	retractions, err = Load(root)
+	require.NoError(t, err)
+	assert.Equal(t, []Retraction{
+		{Tag: "v1.0.1", Rationale: "published by mistake"},
+		{Tag: "api/v0.2.0"},
+	}, retractions)
+	assert.Equal(t, []string{"v1.0.1", "api/v0.2.0"}, Tags(retractions))
+}
+
+func TestLoadIgnoresComments(t *testing.T) {
+	root := t.TempDir()
+	content := "# Retracted tags\n\nv1.0.1\n  v1.0.2  #  broken build \n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, FileName), []byte(content), 0o644))
+
+	retractions, err := Load(root)
+	require.NoError(t, err)
+	assert.Equal(t, []Retraction{
+		{Tag: "v1.0.1"},
+		{Tag: "v1.0.2", Rationale: "broken build"},
+	}, retractions)
+}
+
+func TestGoModPath(t *testing.T) {
+	path, err := GoModPath("/repo", "v1.2.3")
+	require.NoError(t, err)
+	assert.Equal(t, "/repo/go.mod", path)
+
+	path, err = GoModPath("/repo", "tools/api/v1.2.3")
+	require.NoError(t, err)
+	assert.Equal(t, "/repo/tools/api/go.mod", path)
+
+	_, err = GoModPath("/repo", "invalid")
+	assert.Error(t, err)
+}
+
+func TestAddGoModRetraction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go.mod")
+	require.NoError(t, os.WriteFile(path, []byte("module example.com/api\n\ngo 1.24\n"), 0o644))
+
+	require.NoError(t, AddGoModRetraction(path, Retraction{Tag: "api/v1.0.1", Rationale: "published by mistake"}))
+	require.NoError(t, AddGoModRetraction(path, Retraction{Tag: "api/v1.0.1", Rationale: "published by mistake"}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "module example.com/api\n\ngo 1.24\n\n// published by mistake\nretract v1.0.1\n", string(data))
+}
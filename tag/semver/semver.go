@@ -3,7 +3,9 @@ package semver
 import (
 	"fmt"
 	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -129,6 +131,20 @@ func GetExpectedPredecessor(currentTag string) (string, error) {
 	return pred.String(), nil
 }
 
+// IsInitialVersion reports whether the tag is a version a project starts at,
+// v0.0.1, v0.1.0 or v1.0.0 or a pre-release of one, which needs no predecessor
+func IsInitialVersion(tag string) bool {
+	version, err := ParseSemver(tag)
+	if err != nil {
+		return false
+	}
+	switch [3]int{version.Major, version.Minor, version.Patch} {
+	case [3]int{0, 0, 1}, [3]int{0, 1, 0}, [3]int{1, 0, 0}:
+		return true
+	}
+	return false
+}
+
 // FindLargerVersions returns all stable version tags that are greater than the given tag
 func FindLargerVersions(currentTag string, allTags []string) ([]string, error) {
 	currentVersion, err := ParseSemver(currentTag)
@@ -175,6 +191,9 @@ func FindLargerVersions(currentTag string, allTags []string) ([]string, error) {
 	return largerTags, nil
 }
 
+// CalculateNextVersion returns the version following tag. allTags should only
+// contain the tags reachable from the commit being tagged so that pre-release
+// numbering on one branch is not affected by tags on another.
 func CalculateNextVersion(tag string, allTags []string, incMajor, incMinor, incPatch bool, suffix string) (string, error) {
 	log.WithFields(log.Fields{
 		"latest": tag,
@@ -206,7 +225,6 @@ func CalculateNextVersion(tag string, allTags []string, incMajor, incMinor, incP
 		version.Patch++
 		version.PreReleaseNum = 0
 	} else if version.PreRelease != suffix {
-		// TODO: This should probably only consider tags with HEAD as an ancestor.
 		// Find the largest PreReleaseNum for the given suffix with the same base version
 		largestPreReleaseNum := 0
 		for _, existingTag := range allTags {
@@ -233,3 +251,152 @@ func CalculateNextVersion(tag string, allTags []string, incMajor, incMinor, incP
 	log.WithField("nextVersion", nextVersion).Debug("Calculated next version")
 	return nextVersion, nil
 }
+
+// Promote returns the tag that graduates the pre-release tag to the given
+// channel on the same base version. An empty channel promotes to the stable
+// release, e.g. v1.4.0-rc.3 becomes v1.4.0. Otherwise the pre-release number
+// continues from the largest existing tag in that channel, e.g. v1.4.0-beta.2
+// becomes v1.4.0-rc.1 if v1.4.0-rc already exists.
+func Promote(tag string, allTags []string, channel string) (string, error) {
+	version, err := ParseSemver(tag)
+	if err != nil {
+		return "", err
+	}
+	if version.PreRelease == "" {
+		return "", fmt.Errorf("tag '%s' is not a pre-release", tag)
+	}
+	if channel == version.PreRelease {
+		return "", fmt.Errorf("tag '%s' is already in the '%s' channel", tag, channel)
+	}
+	// Pre-release identifiers are compared lexically, so moving to a smaller
+	// channel would produce a tag that sorts before the one it replaces
+	if channel != "" && channel < version.PreRelease {
+		return "", fmt.Errorf("cannot promote '%s' from '%s' to lower precedence channel '%s'", tag, version.PreRelease, channel)
+	}
+
+	promoted := &Version{
+		Prefix:     version.Prefix,
+		Major:      version.Major,
+		Minor:      version.Minor,
+		Patch:      version.Patch,
+		PreRelease: channel,
+	}
+
+	if channel != "" {
+		found := false
+		largestPreReleaseNum := 0
+		for _, existingTag := range allTags {
+			existingVersion, err := ParseSemver(existingTag)
+			if err != nil || existingVersion.Prefix != promoted.Prefix ||
+				existingVersion.PreRelease != channel ||
+				existingVersion.Major != promoted.Major ||
+				existingVersion.Minor != promoted.Minor ||
+				existingVersion.Patch != promoted.Patch {
+				continue
+			}
+			found = true
+			if existingVersion.PreReleaseNum > largestPreReleaseNum {
+				largestPreReleaseNum = existingVersion.PreReleaseNum
+			}
+		}
+		if found {
+			promoted.PreReleaseNum = largestPreReleaseNum + 1
+		}
+	}
+
+	promotedTag := promoted.String()
+	log.WithFields(log.Fields{
+		"tag":      tag,
+		"channel":  channel,
+		"promoted": promotedTag,
+	}).Debug("Promote")
+	return promotedTag, nil
+}
+
+// SkipRetracted returns tag, or the first version after it that was not
+// retracted. Retracted versions may already be cached by consumers, so a
+// retracted stable release is followed by the next patch release and a
+// retracted pre-release by the next pre-release in its channel.
+func SkipRetracted(tag string, allTags, retracted []string) (string, error) {
+	for slices.Contains(retracted, tag) {
+		version, err := ParseSemver(tag)
+		if err != nil {
+			return "", err
+		}
+		log.WithField("tag", tag).Debug("SkipRetracted: skipping retracted version")
+		if tag, err = CalculateNextVersion(tag, allTags, false, false, false, version.PreRelease); err != nil {
+			return "", err
+		}
+	}
+	return tag, nil
+}
+
+// ReleaseLine is a major.minor series maintained on its own branch, e.g.
+// release/1.2 only receives v1.2.x releases
+type ReleaseLine struct {
+	Major int
+	Minor int
+}
+
+func (l ReleaseLine) String() string {
+	return fmt.Sprintf("v%d.%d.x", l.Major, l.Minor)
+}
+
+var releaseBranchRe = regexp.MustCompile(`^release/v?(\d+)\.(\d+)(?:\.x)?$`)
+
+// ParseReleaseBranch returns the release line of a maintenance branch named
+// like release/1.2, release/v1.2 or release/1.2.x
+func ParseReleaseBranch(branch string) (ReleaseLine, bool) {
+	matches := releaseBranchRe.FindStringSubmatch(strings.TrimPrefix(branch, "refs/heads/"))
+	if matches == nil {
+		return ReleaseLine{}, false
+	}
+	major, _ := strconv.Atoi(matches[1])
+	minor, _ := strconv.Atoi(matches[2])
+	return ReleaseLine{Major: major, Minor: minor}, true
+}
+
+// CalculateNextVersionOnLine returns the next patch version on a release
+// line. If tag predates the line, the line's first release is returned.
+func CalculateNextVersionOnLine(tag string, allTags []string, line ReleaseLine, incPatch bool, suffix string) (string, error) {
+	version, err := ParseSemver(tag)
+	if err != nil {
+		return "", err
+	}
+
+	if version.Major > line.Major || (version.Major == line.Major && version.Minor > line.Minor) {
+		return "", fmt.Errorf("latest tag '%s' is newer than release line %s", tag, line)
+	}
+
+	if version.Major == line.Major && version.Minor == line.Minor {
+		return CalculateNextVersion(tag, allTags, false, false, incPatch, suffix)
+	}
+
+	first := &Version{
+		Prefix:     version.Prefix,
+		Major:      line.Major,
+		Minor:      line.Minor,
+		PreRelease: suffix,
+	}
+	if suffix != "" {
+		for _, existingTag := range allTags {
+			existingVersion, err := ParseSemver(existingTag)
+			if err == nil && existingVersion.Prefix == first.Prefix &&
+				existingVersion.PreRelease == suffix &&
+				existingVersion.Major == first.Major &&
+				existingVersion.Minor == first.Minor &&
+				existingVersion.Patch == 0 &&
+				existingVersion.PreReleaseNum >= first.PreReleaseNum {
+				first.PreReleaseNum = existingVersion.PreReleaseNum + 1
+			}
+		}
+	}
+
+	nextVersion := first.String()
+	log.WithFields(log.Fields{
+		"latest":      tag,
+		"line":        line.String(),
+		"nextVersion": nextVersion,
+	}).Debug("Calculated first version on release line")
+	return nextVersion, nil
+}
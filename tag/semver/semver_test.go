@@ -297,3 +297,199 @@ func TestCalculateNextVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestPromote(t *testing.T) {
+	testCases := []struct {
+		name        string
+		tag         string
+		channel     string
+		allTags     []string
+		expectedTag string
+		expectError bool
+	}{
+		{
+			name:        "Promote to stable",
+			tag:         "v1.4.0-rc.3",
+			expectedTag: "v1.4.0",
+		},
+		{
+			name:        "Promote prefixed tag to stable",
+			tag:         "org/v1.4.0-rc.3",
+			expectedTag: "org/v1.4.0",
+		},
+		{
+			name:        "Promote to new channel",
+			tag:         "v1.4.0-beta.2",
+			channel:     "rc",
+			allTags:     []string{"v1.4.0-beta", "v1.4.0-beta.1", "v1.4.0-beta.2"},
+			expectedTag: "v1.4.0-rc",
+		},
+		{
+			name:        "Promote to existing channel",
+			tag:         "v1.4.0-beta.2",
+			channel:     "rc",
+			allTags:     []string{"v1.3.0-rc.4", "v1.4.0-rc", "v1.4.0-rc.1", "other/v1.4.0-rc.5"},
+			expectedTag: "v1.4.0-rc.2",
+		},
+		{
+			name:        "Stable tag",
+			tag:         "v1.4.0",
+			expectError: true,
+		},
+		{
+			name:        "Same channel",
+			tag:         "v1.4.0-rc.1",
+			channel:     "rc",
+			expectError: true,
+		},
+		{
+			name:        "Lower precedence channel",
+			tag:         "v1.4.0-rc.1",
+			channel:     "beta",
+			expectError: true,
+		},
+		{
+			name:        "Invalid tag",
+			tag:         "invalid-tag",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			promoted, err := Promote(tc.tag, tc.allTags, tc.channel)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedTag, promoted)
+			}
+		})
+	}
+}
+
+func TestIsInitialVersion(t *testing.T) {
+	for _, tag := range []string{"v0.0.1", "v0.1.0", "v1.0.0", "lib/v1.0.0", "v1.0.0-rc.1"} {
+		assert.True(t, IsInitialVersion(tag), tag)
+	}
+	for _, tag := range []string{"v0.0.0", "v0.0.2", "v0.2.0", "v2.0.0", "v1.0.1", "invalid"} {
+		assert.False(t, IsInitialVersion(tag), tag)
+	}
+}
+
+func TestSkipRetracted(t *testing.T) {
+	testCases := []struct {
+		tag       string
+		retracted []string
+		expected  string
+	}{
+		{tag: "v1.0.0", expected: "v1.0.0"},
+		{tag: "v1.0.0", retracted: []string{"v0.9.0"}, expected: "v1.0.0"},
+		{tag: "v1.0.0", retracted: []string{"v1.0.0", "v1.0.1"}, expected: "v1.0.2"},
+		{tag: "v1.0.0-rc.1", retracted: []string{"v1.0.0-rc.1"}, expected: "v1.0.0-rc.2"},
+		{tag: "lib/v2.0.0", retracted: []string{"lib/v2.0.0"}, expected: "lib/v2.0.1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			tag, err := SkipRetracted(tc.tag, nil, tc.retracted)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, tag)
+		})
+	}
+}
+
+func TestParseReleaseBranch(t *testing.T) {
+	testCases := []struct {
+		branch       string
+		expectedLine ReleaseLine
+		expectedOk   bool
+	}{
+		{branch: "release/1.2", expectedLine: ReleaseLine{Major: 1, Minor: 2}, expectedOk: true},
+		{branch: "release/v1.2", expectedLine: ReleaseLine{Major: 1, Minor: 2}, expectedOk: true},
+		{branch: "release/1.2.x", expectedLine: ReleaseLine{Major: 1, Minor: 2}, expectedOk: true},
+		{branch: "refs/heads/release/10.0", expectedLine: ReleaseLine{Major: 10, Minor: 0}, expectedOk: true},
+		{branch: "main"},
+		{branch: "release/next"},
+		{branch: "feature/release/1.2"},
+		{branch: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.branch, func(t *testing.T) {
+			line, ok := ParseReleaseBranch(tc.branch)
+			assert.Equal(t, tc.expectedOk, ok)
+			assert.Equal(t, tc.expectedLine, line)
+		})
+	}
+}
+
+func TestCalculateNextVersionOnLine(t *testing.T) {
+	testCases := []struct {
+		name        string
+		currentTag  string
+		line        ReleaseLine
+		incPatch    bool
+		suffix      string
+		allTags     []string
+		expectedTag string
+		expectError bool
+	}{
+		{
+			name:        "Patch on line",
+			currentTag:  "v1.2.3",
+			line:        ReleaseLine{Major: 1, Minor: 2},
+			expectedTag: "v1.2.4",
+		},
+		{
+			name:        "Pre-release on line",
+			currentTag:  "v1.2.4-rc.1",
+			line:        ReleaseLine{Major: 1, Minor: 2},
+			suffix:      "rc",
+			allTags:     []string{"v1.2.4-rc.1"},
+			expectedTag: "v1.2.4-rc.2",
+		},
+		{
+			name:        "Patch pre-release on line",
+			currentTag:  "v1.2.3",
+			line:        ReleaseLine{Major: 1, Minor: 2},
+			incPatch:    true,
+			suffix:      "rc",
+			expectedTag: "v1.2.4-rc",
+		},
+		{
+			name:        "First release on line",
+			currentTag:  "v1.1.5",
+			line:        ReleaseLine{Major: 1, Minor: 2},
+			expectedTag: "v1.2.0",
+		},
+		{
+			name:        "First prefixed pre-release on line",
+			currentTag:  "org/v1.1.5",
+			line:        ReleaseLine{Major: 1, Minor: 2},
+			suffix:      "rc",
+			allTags:     []string{"org/v1.1.5", "org/v1.2.0-rc", "org/v1.2.0-rc.1", "v1.2.0-rc.7"},
+			expectedTag: "org/v1.2.0-rc.2",
+		},
+		{
+			name:        "Tag newer than line",
+			currentTag:  "v1.3.0",
+			line:        ReleaseLine{Major: 1, Minor: 2},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			nextVersion, err := CalculateNextVersionOnLine(tc.currentTag, tc.allTags, tc.line, tc.incPatch, tc.suffix)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedTag, nextVersion)
+			}
+		})
+	}
+}